@@ -0,0 +1,128 @@
+package net
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// AdminConfig operational endpoints of an admin server, endpoints whose
+// field is empty are not mounted
+type AdminConfig struct {
+	// Metrics served at /metrics
+	Metrics *Metrics
+	// Scheduler job metrics served at /metrics/jobs
+	Scheduler *Scheduler
+	// Config dumped, redacted, at /config, only mounted with Auth
+	Config func() *Config
+	// Pprof mounts the profiles under /debug/pprof, only with Auth
+	Pprof bool
+	// Auth guards every admin endpoint. The admin listener is usually only
+	// reachable from inside the network so nil leaves the read only ones
+	// open, toggling draining, the config dump and pprof then are not
+	// mounted.
+	Auth EndPointDecorator
+}
+
+// AdminServer server for operational endpoints of s, to be bound to a
+// port or interface apart from the public listener:
+//
+//	/healthz, /readyz  health of s
+//	/drain             GET reports, PUT {"draining":true} toggles draining
+//	                   when cfg has Auth
+//	/connections       connection counters of s
+//	/routes            routes of s with their documentation
+//
+// plus what cfg enables. Shutting s down shuts the admin server down after
+// the public listeners, so readiness stays observable while draining.
+func (s *Server) AdminServer(cfg AdminConfig, opts ...Option) *Server {
+	admin := NewServer(opts...)
+	auth := cfg.Auth
+	if auth == nil {
+		auth = func(e EndPoint) EndPoint { return e }
+		log.Print("admin: no auth, draining toggle, config dump and pprof not mounted")
+	}
+	admin.AddEndPoint(http.MethodGet, "/healthz", s.Liveness)
+	admin.AddEndPoint(http.MethodGet, "/readyz", s.Readiness)
+	s.enableDrain(admin, "/drain", auth, cfg.Auth != nil)
+	admin.AddEndPoint(http.MethodGet, "/connections", EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, s.ConnStats())
+		},
+	))
+	admin.AddEndPoint(http.MethodGet, "/routes", EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, s.DescribeRoutes())
+		},
+	))
+	if cfg.Metrics != nil {
+		admin.AddEndPoint(http.MethodGet, "/metrics", EndPointConfig{auth}.Apply(
+			func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				cfg.Metrics.ServeHTTP(w, r)
+			},
+		))
+	}
+	if cfg.Scheduler != nil {
+		admin.AddEndPoint(http.MethodGet, "/metrics/jobs", EndPointConfig{auth}.Apply(
+			func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				cfg.Scheduler.ServeHTTP(w, r)
+			},
+		))
+	}
+	if cfg.Config != nil && cfg.Auth != nil {
+		admin.EnableConfigDump("/config", cfg.Config, auth)
+	}
+	if cfg.Pprof && cfg.Auth != nil {
+		admin.EnablePprof("/debug/pprof", auth)
+	}
+	s.OnShutdown(admin.Shutdown)
+	return admin
+}
+
+// SetDraining take s out of (or back into) rotation, a draining server
+// fails readiness so load balancers stop sending it new requests while it
+// keeps serving the ones it gets
+func (s *Server) SetDraining(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	if atomic.SwapInt32(&s.draining, v) != v {
+		log.Printf("draining: %t", on)
+	}
+}
+
+// Draining reports whether s was taken out of rotation
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// DrainState body of the drain endpoint
+type DrainState struct {
+	Draining bool `json:"draining"`
+}
+
+// enableDrain mount the drain state of s on srv, with the toggle when
+// writable
+func (s *Server) enableDrain(srv *Server, path string, auth EndPointDecorator, writable bool) {
+	srv.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, DrainState{Draining: s.Draining()})
+		},
+	))
+	if !writable {
+		return
+	}
+	srv.AddEndPoint(http.MethodPut, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var state DrainState
+			if err := DecodeBody(r, &state); err != nil {
+				BadRequest(w, err)
+				return
+			}
+			s.SetDraining(state.Draining)
+			ResultResponse(w, state)
+		},
+	))
+}
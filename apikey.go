@@ -0,0 +1,340 @@
+package net
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader header carrying api keys, "Authorization: ApiKey <key>"
+// is accepted as well
+const APIKeyHeader = "X-Api-Key"
+
+// api key errors
+var (
+	ErrAPIKeyNotFound = fmt.Errorf("api key not found")
+	ErrAPIKeyInvalid  = fmt.Errorf("invalid api key")
+)
+
+// APIKey stored api key, the secret itself is only known to the client
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Subject   string    `json:"subject"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt zero never expires
+	ExpiresAt time.Time `json:"expires_at"`
+	// RevokedAt zero is not revoked
+	RevokedAt time.Time `json:"revoked_at"`
+	// RotatedTo id of the key that replaced this one
+	RotatedTo string `json:"rotated_to,omitempty"`
+}
+
+// Active reports whether the key authenticates at now
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt.IsZero() && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
+
+// APIKeyStore keeps api keys
+type APIKeyStore interface {
+	SaveAPIKey(ctx context.Context, k APIKey) error
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+	// ListAPIKeys keys of subject, every key when subject is empty
+	ListAPIKeys(ctx context.Context, subject string) ([]APIKey, error)
+}
+
+// MemoryAPIKeyStore in process APIKeyStore
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+// NewMemoryAPIKeyStore empty store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[string]APIKey)}
+}
+
+// SaveAPIKey store k
+func (m *MemoryAPIKeyStore) SaveAPIKey(ctx context.Context, k APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[k.ID] = k
+	return nil
+}
+
+// GetAPIKey key id
+func (m *MemoryAPIKeyStore) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.keys[id]
+	if !ok {
+		return k, ErrAPIKeyNotFound
+	}
+	return k, nil
+}
+
+// ListAPIKeys keys of subject, oldest first
+func (m *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context, subject string) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ret := make([]APIKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		if subject == "" || k.Subject == subject {
+			ret = append(ret, k)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+	})
+	return ret, nil
+}
+
+// APIKeys creates, rotates and revokes api keys and authenticates them.
+// Keys handed out are "<prefix>_<id>.<secret>", only a hash of the secret
+// is stored.
+type APIKeys struct {
+	Store  APIKeyStore
+	Prefix string
+}
+
+// NewAPIKeys key manager over store
+func NewAPIKeys(store APIKeyStore) *APIKeys {
+	return &APIKeys{Store: store, Prefix: "key"}
+}
+
+// Create a key for subject with scopes, ttl 0 never expires. The returned
+// secret key is the only copy.
+func (a *APIKeys) Create(ctx context.Context, name, subject string, scopes []string, ttl time.Duration) (APIKey, string, error) {
+	now := ClockFrom(ctx).Now()
+	id, secret := newRequestID()[:16], newRequestID()
+	k := APIKey{
+		ID:        id,
+		Name:      name,
+		Subject:   subject,
+		Scopes:    scopes,
+		Hash:      apiKeyHash(secret),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		k.ExpiresAt = now.Add(ttl)
+	}
+	if err := a.Store.SaveAPIKey(ctx, k); err != nil {
+		return APIKey{}, "", err
+	}
+	return k, a.Prefix + "_" + id + "." + secret, nil
+}
+
+// List keys of subject, every key when subject is empty
+func (a *APIKeys) List(ctx context.Context, subject string) ([]APIKey, error) {
+	return a.Store.ListAPIKeys(ctx, subject)
+}
+
+// Rotate replace key id by a new one with the same name, subject, scopes
+// and lifetime; the old key keeps working for grace
+func (a *APIKeys) Rotate(ctx context.Context, id string, grace time.Duration) (APIKey, string, error) {
+	old, err := a.Store.GetAPIKey(ctx, id)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	now := ClockFrom(ctx).Now()
+	if !old.Active(now) {
+		return APIKey{}, "", ErrAPIKeyInvalid
+	}
+	var ttl time.Duration
+	if !old.ExpiresAt.IsZero() {
+		ttl = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+	k, secret, err := a.Create(ctx, old.Name, old.Subject, old.Scopes, ttl)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	old.RotatedTo = k.ID
+	if end := now.Add(grace); old.ExpiresAt.IsZero() || end.Before(old.ExpiresAt) {
+		old.ExpiresAt = end
+	}
+	if err := a.Store.SaveAPIKey(ctx, old); err != nil {
+		return APIKey{}, "", err
+	}
+	return k, secret, nil
+}
+
+// Revoke key id immediately
+func (a *APIKeys) Revoke(ctx context.Context, id string) error {
+	k, err := a.Store.GetAPIKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if k.RevokedAt.IsZero() {
+		k.RevokedAt = ClockFrom(ctx).Now()
+	}
+	return a.Store.SaveAPIKey(ctx, k)
+}
+
+// Authenticate the stored key of a secret key, if it is active
+func (a *APIKeys) Authenticate(ctx context.Context, key string) (APIKey, error) {
+	key = strings.TrimPrefix(key, a.Prefix+"_")
+	i := strings.IndexByte(key, '.')
+	if i < 0 {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	k, err := a.Store.GetAPIKey(ctx, key[:i])
+	if err == ErrAPIKeyNotFound {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKeyHash(key[i+1:])), []byte(k.Hash)) != 1 ||
+		!k.Active(ClockFrom(ctx).Now()) {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	return k, nil
+}
+
+// Decorate EndPointDecorator authenticating api keys, the identity is the
+// key's subject with its scopes
+func (a *APIKeys) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(APIKeyHeader)
+		if h := r.Header.Get("Authorization"); key == "" && len(h) > 7 && strings.EqualFold(h[:7], "apikey ") {
+			key = strings.TrimSpace(h[7:])
+		}
+		if key == "" {
+			NoAccess(w)
+			return
+		}
+		k, err := a.Authenticate(ctx, key)
+		if err == ErrAPIKeyInvalid {
+			NoAccess(w)
+			return
+		}
+		if err != nil {
+			ErrorResponse(w, err)
+			return
+		}
+		ctx = WithIdentity(ctx, Identity{Subject: k.Subject, Scopes: k.Scopes})
+		ctx = context.WithValue(ctx, apiKeyKey, k)
+		e(ctx, w, r.WithContext(ctx))
+	}
+}
+
+// APIKeyFrom api key the request authenticated with
+func APIKeyFrom(ctx context.Context) (APIKey, bool) {
+	k, ok := ctx.Value(apiKeyKey).(APIKey)
+	return k, ok
+}
+
+func apiKeyHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyRequest body of the create endpoint
+type APIKeyRequest struct {
+	Name    string   `json:"name"`
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+	// TTL lifetime like "720h", empty never expires
+	TTL string `json:"ttl"`
+}
+
+// APIKeyCreated answer of the create and rotate endpoints, Secret is
+// shown only once
+type APIKeyCreated struct {
+	Key    APIKey `json:"key"`
+	Secret string `json:"secret"`
+}
+
+// EnableAPIKeys mount key management behind auth: GET path lists keys,
+// optionally ?subject=, POST path creates one, POST path/:id/rotate
+// rotates one keeping the old key for ?grace= (default 24h) and
+// DELETE path/:id revokes one
+func (s *Server) EnableAPIKeys(path string, a *APIKeys, auth EndPointDecorator) {
+	s.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			keys, err := a.List(ctx, r.URL.Query().Get("subject"))
+			if err != nil {
+				ErrorResponse(w, err)
+				return
+			}
+			ResultResponse(w, keys)
+		},
+	))
+	s.AddEndPoint(http.MethodPost, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var req APIKeyRequest
+			if err := DecodeBody(r, &req); err != nil {
+				BadRequest(w, err)
+				return
+			}
+			var ttl time.Duration
+			if req.TTL != "" {
+				var err error
+				if ttl, err = time.ParseDuration(req.TTL); err != nil {
+					BadRequest(w, err)
+					return
+				}
+			}
+			if req.Subject == "" {
+				BadRequest(w, fmt.Errorf("subject is required"))
+				return
+			}
+			k, secret, err := a.Create(ctx, req.Name, req.Subject, req.Scopes, ttl)
+			if err != nil {
+				ErrorResponse(w, err)
+				return
+			}
+			ResultResponse(w, APIKeyCreated{Key: k, Secret: secret})
+		},
+	))
+	s.AddEndPoint(http.MethodPost, path+"/:id/rotate", EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			grace := 24 * time.Hour
+			if g := r.URL.Query().Get("grace"); g != "" {
+				var err error
+				if grace, err = time.ParseDuration(g); err != nil {
+					BadRequest(w, err)
+					return
+				}
+			}
+			params, _ := Params(ctx)
+			k, secret, err := a.Rotate(ctx, params.ByName("id"), grace)
+			if err != nil {
+				apiKeyError(w, err)
+				return
+			}
+			ResultResponse(w, APIKeyCreated{Key: k, Secret: secret})
+		},
+	))
+	s.AddEndPoint(http.MethodDelete, path+"/:id", EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			params, _ := Params(ctx)
+			if err := a.Revoke(ctx, params.ByName("id")); err != nil {
+				apiKeyError(w, err)
+				return
+			}
+			ResultResponse(w, nil)
+		},
+	))
+}
+
+func apiKeyError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrAPIKeyNotFound:
+		res := JSONResult{Success: false, StatusCode: http.StatusNotFound, Error: err.Error()}
+		res.Write(w)
+	case ErrAPIKeyInvalid:
+		BadRequest(w, fmt.Errorf("api key is revoked or expired"))
+	default:
+		ErrorResponse(w, err)
+	}
+}
@@ -0,0 +1,119 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuditEntry who did what when
+type AuditEntry struct {
+	Time       time.Time         `json:"time"`
+	Subject    string            `json:"subject"`
+	Roles      []string          `json:"roles,omitempty"`
+	Method     string            `json:"method"`
+	Route      string            `json:"route"`
+	Path       string            `json:"path"`
+	Params     map[string]string `json:"params,omitempty"`
+	Diff       string            `json:"diff,omitempty"`
+	Status     int               `json:"status"`
+	RemoteAddr string            `json:"remote_addr"`
+	Duration   time.Duration     `json:"duration"`
+}
+
+// AuditSink stores audit entries
+type AuditSink interface {
+	Audit(AuditEntry) error
+}
+
+// AuditSinkFunc func adapter for AuditSink
+type AuditSinkFunc func(AuditEntry) error
+
+// Audit calls f
+func (f AuditSinkFunc) Audit(e AuditEntry) error {
+	return f(e)
+}
+
+// auditNote diff hint set by the handler and the identity auth decorators
+// inside Audit established
+type auditNote struct {
+	diff     string
+	identity *Identity
+}
+
+// AuditDiff attach a description of the change to the audit entry
+func AuditDiff(ctx context.Context, diff string) {
+	if note, ok := ctx.Value(auditKey).(*auditNote); ok {
+		note.diff = diff
+	}
+}
+
+// Audit record every call of the endpoint to sink, with the identity
+// established by auth decorators before or after it. Panics are recorded
+// as 500 and passed on.
+func Audit(sink AuditSink) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			begin := time.Now()
+			note := &auditNote{}
+			ctx = context.WithValue(ctx, auditKey, note)
+			rec := newResponseRecorder(w)
+			defer func() {
+				recovered := recover()
+				entry := AuditEntry{
+					Time:       begin,
+					Method:     r.Method,
+					Route:      Route(ctx).Path,
+					Path:       r.URL.Path,
+					Diff:       note.diff,
+					Status:     requestStatus(ctx, rec, recovered),
+					RemoteAddr: r.RemoteAddr,
+					Duration:   time.Since(begin),
+				}
+				id, ok := IdentityFrom(ctx)
+				if note.identity != nil {
+					id, ok = *note.identity, true
+				}
+				if ok {
+					entry.Subject = id.Subject
+					entry.Roles = id.Roles
+				}
+				if params, err := Params(ctx); err == nil && len(params) > 0 {
+					entry.Params = make(map[string]string, len(params))
+					for _, p := range params {
+						entry.Params[p.Key] = p.Value
+					}
+				}
+				if err := sink.Audit(entry); err != nil {
+					log.Printf("audit: %s", err)
+				}
+				if recovered != nil {
+					panic(recovered)
+				}
+			}()
+			e(ctx, rec, r.WithContext(ctx))
+		}
+	}
+}
+
+// WriterAuditSink writes audit entries as json lines
+type WriterAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterAuditSink json lines audit sink
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{w: w}
+}
+
+// Audit write entry
+func (s *WriterAuditSink) Audit(e AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.NewEncoder(s.w).Encode(e)
+}
@@ -0,0 +1,341 @@
+package net
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// token defaults
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// auth errors
+var (
+	ErrInvalidCredentials = fmt.Errorf("invalid credentials")
+	// ErrRefreshReused a rotated refresh token was presented again, the
+	// whole login is revoked as it was likely stolen
+	ErrRefreshReused = fmt.Errorf("refresh token reused")
+)
+
+// Authenticator checks login credentials
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (Identity, error)
+}
+
+// AuthenticatorFunc func adapter for Authenticator
+type AuthenticatorFunc func(ctx context.Context, username, password string) (Identity, error)
+
+// Authenticate calls f
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, username, password string) (Identity, error) {
+	return f(ctx, username, password)
+}
+
+// RefreshToken stored refresh token, ID is the hash of the token handed
+// out. Family groups the tokens rotated from one login.
+type RefreshToken struct {
+	ID        string
+	Family    string
+	Identity  Identity
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// TokenStore keeps refresh tokens and revoked access tokens
+type TokenStore interface {
+	SaveRefresh(ctx context.Context, t RefreshToken) error
+	// UseRefresh mark the token used and return it as it was before,
+	// atomically so a token can be rotated only once
+	UseRefresh(ctx context.Context, id string) (RefreshToken, error)
+	RevokeFamily(ctx context.Context, family string) error
+	// RevokeAccess deny the access token id until it expires
+	RevokeAccess(ctx context.Context, id string, until time.Time) error
+	AccessRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// MemoryTokenStore in process TokenStore
+type MemoryTokenStore struct {
+	mu      sync.Mutex
+	refresh map[string]RefreshToken
+	revoked map[string]time.Time
+}
+
+// NewMemoryTokenStore empty store
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		refresh: make(map[string]RefreshToken),
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// SaveRefresh store t
+func (m *MemoryTokenStore) SaveRefresh(ctx context.Context, t RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh[t.ID] = t
+	return nil
+}
+
+// UseRefresh mark id used
+func (m *MemoryTokenStore) UseRefresh(ctx context.Context, id string) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.refresh[id]
+	if !ok {
+		return t, ErrInvalidToken
+	}
+	used := t
+	used.Used = true
+	m.refresh[id] = used
+	return t, nil
+}
+
+// RevokeFamily revoke the tokens of family
+func (m *MemoryTokenStore) RevokeFamily(ctx context.Context, family string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, t := range m.refresh {
+		if t.Family == family {
+			t.Revoked = true
+			m.refresh[id] = t
+		}
+	}
+	return nil
+}
+
+// RevokeAccess deny id until until
+func (m *MemoryTokenStore) RevokeAccess(ctx context.Context, id string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[id] = until
+	return nil
+}
+
+// AccessRevoked reports whether id is denied
+func (m *MemoryTokenStore) AccessRevoked(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.revoked[id]
+	return ok, nil
+}
+
+// Cleanup drop expired refresh tokens and revocations of expired access
+// tokens
+func (m *MemoryTokenStore) Cleanup(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, t := range m.refresh {
+		if now.After(t.ExpiresAt) {
+			delete(m.refresh, id)
+		}
+	}
+	for id, until := range m.revoked {
+		if now.After(until) {
+			delete(m.revoked, id)
+		}
+	}
+}
+
+// TokenPair tokens handed out on login and refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// TokenIssuer issues JWT access tokens with rotating refresh tokens
+type TokenIssuer struct {
+	Key        []byte
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Auth       Authenticator
+	Store      TokenStore
+}
+
+// NewTokenIssuer issuer signing with key, checking logins with auth
+func NewTokenIssuer(key []byte, auth Authenticator, store TokenStore) *TokenIssuer {
+	return &TokenIssuer{
+		Key:        key,
+		AccessTTL:  AccessTokenTTL,
+		RefreshTTL: RefreshTokenTTL,
+		Auth:       auth,
+		Store:      store,
+	}
+}
+
+// JWTAuth verifier for the access tokens of t, honouring revocations
+func (t *TokenIssuer) JWTAuth() *JWTAuth {
+	return &JWTAuth{Key: t.Key, Issuer: t.Issuer, Revoked: t.Store.AccessRevoked}
+}
+
+// Decorate EndPointDecorator requiring an access token of t
+func (t *TokenIssuer) Decorate(e EndPoint) EndPoint {
+	return t.JWTAuth().Decorate(e)
+}
+
+// Login check the credentials and start a new token family
+func (t *TokenIssuer) Login(ctx context.Context, username, password string) (TokenPair, error) {
+	id, err := t.Auth.Authenticate(ctx, username, password)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return t.issue(ctx, id, newRequestID())
+}
+
+// Refresh rotate refresh for a new pair, presenting a rotated token again
+// revokes its family
+func (t *TokenIssuer) Refresh(ctx context.Context, refresh string) (TokenPair, error) {
+	old, err := t.Store.UseRefresh(ctx, refreshID(refresh))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	switch {
+	case old.Revoked:
+		return TokenPair{}, ErrTokenRevoked
+	case old.Used:
+		if err := t.Store.RevokeFamily(ctx, old.Family); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrRefreshReused
+	case !ClockFrom(ctx).Now().Before(old.ExpiresAt):
+		return TokenPair{}, ErrTokenExpired
+	}
+	return t.issue(ctx, old.Identity, old.Family)
+}
+
+// Logout revoke the family of refresh and, when given, the access token
+func (t *TokenIssuer) Logout(ctx context.Context, refresh, access string) error {
+	if refresh != "" {
+		old, err := t.Store.UseRefresh(ctx, refreshID(refresh))
+		if err != nil {
+			return err
+		}
+		if err := t.Store.RevokeFamily(ctx, old.Family); err != nil {
+			return err
+		}
+	}
+	if access != "" {
+		claims, err := ParseJWT(t.Key, access, ClockFrom(ctx).Now())
+		if err != nil || claims.ID == "" {
+			return nil
+		}
+		return t.Store.RevokeAccess(ctx, claims.ID, time.Unix(claims.ExpiresAt, 0))
+	}
+	return nil
+}
+
+func (t *TokenIssuer) issue(ctx context.Context, id Identity, family string) (TokenPair, error) {
+	now := ClockFrom(ctx).Now()
+	access, err := SignJWT(t.Key, JWTClaims{
+		ID:        newRequestID(),
+		Subject:   id.Subject,
+		Issuer:    t.Issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.AccessTTL).Unix(),
+		Roles:     id.Roles,
+		Scopes:    id.Scopes,
+		Tenant:    id.Tenant,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh := newRequestID() + newRequestID()
+	err = t.Store.SaveRefresh(ctx, RefreshToken{
+		ID:        refreshID(refresh),
+		Family:    family,
+		Identity:  id,
+		ExpiresAt: now.Add(t.RefreshTTL),
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(t.AccessTTL / time.Second),
+	}, nil
+}
+
+// refreshID store key of a refresh token, the token itself is not kept
+func refreshID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MountAuth add POST prefix/login, prefix/refresh and prefix/logout.
+// Login takes {"username", "password"}, refresh and logout take
+// {"refresh_token"}; logout also revokes a bearer access token.
+func (s *Server) MountAuth(prefix string, t *TokenIssuer) {
+	s.AddEndPoint(http.MethodPost, prefix+"/login", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := DecodeBody(r, &req); err != nil {
+			BadRequest(w, err)
+			return
+		}
+		pair, err := t.Login(ctx, req.Username, req.Password)
+		if err != nil {
+			authError(w, err)
+			return
+		}
+		ResultResponse(w, pair)
+	})
+	s.AddEndPoint(http.MethodPost, prefix+"/refresh", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := DecodeBody(r, &req); err != nil {
+			BadRequest(w, err)
+			return
+		}
+		pair, err := t.Refresh(ctx, req.RefreshToken)
+		if err != nil {
+			authError(w, err)
+			return
+		}
+		ResultResponse(w, pair)
+	})
+	s.AddEndPoint(http.MethodPost, prefix+"/logout", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if r.ContentLength != 0 {
+			if err := DecodeBody(r, &req); err != nil {
+				BadRequest(w, err)
+				return
+			}
+		}
+		if err := t.Logout(ctx, req.RefreshToken, bearerToken(r)); err != nil {
+			authError(w, err)
+			return
+		}
+		ResultResponse(w, nil)
+	})
+}
+
+// authError 401 for credential and token errors, 500 otherwise
+func authError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvalidCredentials, ErrInvalidToken, ErrTokenExpired, ErrTokenRevoked, ErrRefreshReused:
+		res := JSONResult{
+			Success:    false,
+			StatusCode: http.StatusUnauthorized,
+			Error:      err.Error(),
+		}
+		res.Write(w)
+		return
+	}
+	ErrorResponse(w, err)
+}
@@ -0,0 +1,16 @@
+package net
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff delay before retry attempt, doubling base per attempt up to max
+// with half of it jittered so retrying clients spread out
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	delay := base << uint(attempt-1)
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
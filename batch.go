@@ -0,0 +1,127 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BatchMaxItems sub requests a batch may carry by default
+const BatchMaxItems = 20
+
+// batchHeaders credentials of the batch request passed on to every sub
+// request
+var batchHeaders = []string{"Authorization", "Cookie", APIKeyHeader}
+
+// BatchRequest one sub request of a batch
+type BatchRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse result of one sub request, json bodies are embedded as is,
+// others as a string
+type BatchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// EnableBatch mount POST path taking a json array of sub requests, which
+// are dispatched in order through the server's routes and answered as an
+// array of responses. Sub requests share the credentials and context of
+// the batch request, each still passes the decorators of its own route.
+// A batch holds at most max sub requests, BatchMaxItems when max is 0.
+func (s *Server) EnableBatch(path string, max int, auth EndPointDecorator) {
+	if max <= 0 {
+		max = BatchMaxItems
+	}
+	s.AddEndPoint(http.MethodPost, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var reqs []BatchRequest
+			if err := DecodeBody(r, &reqs); err != nil {
+				BadRequest(w, err)
+				return
+			}
+			if len(reqs) > max {
+				BadRequest(w, fmt.Errorf("batch holds %d requests, at most %d allowed", len(reqs), max))
+				return
+			}
+			for i, br := range reqs {
+				if err := validBatchRequest(br, path); err != nil {
+					BadRequest(w, fmt.Errorf("request %d: %s", i, err))
+					return
+				}
+			}
+			ret := make([]BatchResponse, len(reqs))
+			for i, br := range reqs {
+				ret[i] = s.serveBatchItem(ctx, r, br)
+			}
+			ResultResponse(w, ret)
+		},
+	))
+}
+
+func validBatchRequest(br BatchRequest, batchPath string) error {
+	if br.Method == "" {
+		return fmt.Errorf("method is required")
+	}
+	u, err := url.Parse(br.Path)
+	if err != nil {
+		return err
+	}
+	if u.IsAbs() || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		return fmt.Errorf("path must be absolute and local")
+	}
+	if u.Path == batchPath {
+		return fmt.Errorf("batches can not be nested")
+	}
+	return nil
+}
+
+// serveBatchItem run br through the routes, buffering its response
+func (s *Server) serveBatchItem(ctx context.Context, parent *http.Request, br BatchRequest) BatchResponse {
+	sub, err := http.NewRequest(strings.ToUpper(br.Method), br.Path, bytes.NewReader(br.Body))
+	if err != nil {
+		return BatchResponse{Status: http.StatusBadRequest}
+	}
+	sub = sub.WithContext(ctx)
+	sub.Host = parent.Host
+	sub.RemoteAddr = parent.RemoteAddr
+	sub.Proto, sub.ProtoMajor, sub.ProtoMinor = parent.Proto, parent.ProtoMajor, parent.ProtoMinor
+	for _, h := range batchHeaders {
+		if v := parent.Header.Values(h); len(v) > 0 {
+			sub.Header[h] = v
+		}
+	}
+	for k, v := range br.Headers {
+		sub.Header.Set(k, v)
+	}
+	if len(br.Body) > 0 && sub.Header.Get("Content-Type") == "" {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	buf := &bufferWriter{header: make(http.Header)}
+	s.route(&serverWriter{ResponseWriter: buf, server: s, request: sub}, sub)
+	res := BatchResponse{Status: buf.Status()}
+	for k := range buf.header {
+		if res.Headers == nil {
+			res.Headers = make(map[string]string)
+		}
+		res.Headers[k] = buf.header.Get(k)
+	}
+	body := bytes.TrimSpace(buf.body.Bytes())
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		res.Body = body
+	default:
+		res.Body, _ = json.Marshal(string(body))
+	}
+	return res
+}
@@ -0,0 +1,174 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrBlobNotFound no blob stored under the key
+var ErrBlobNotFound = fmt.Errorf("blob not found")
+
+// BlobInfo metadata of a stored blob
+type BlobInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+	// ETag as reported by the store, empty when it has none
+	ETag string `json:"etag,omitempty"`
+}
+
+// BlobStore object storage uploads are streamed into
+type BlobStore interface {
+	// Put store r under key, the returned info has the stored size
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (BlobInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// validBlobKey keys are slash separated relative names without . or ..
+// segments
+func validBlobKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) ||
+		strings.Contains(key, "\x00") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// DiskStore BlobStore keeping blobs as files under Root, content types
+// are derived from the key extension
+type DiskStore struct {
+	Root string
+}
+
+func (d DiskStore) path(key string) (string, error) {
+	if err := validBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(d.Root, filepath.FromSlash(key)), nil
+}
+
+// Put write r to a temporary file renamed into place once complete
+func (d DiskStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (BlobInfo, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return BlobInfo{}, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, ctxReader{ctx, r})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Key: key, Size: n, ContentType: contentType, ModTime: time.Now()}, nil
+}
+
+// Stat blob metadata
+func (d DiskStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return d.info(key, fi), nil
+}
+
+// GetRange open length bytes of the blob starting at offset
+func (d DiskStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, _, err := d.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	f := rc.(*os.File)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (d DiskStore) info(key string, fi os.FileInfo) BlobInfo {
+	return BlobInfo{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     fi.ModTime(),
+	}
+}
+
+// Get open the blob
+func (d DiskStore) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, BlobInfo{}, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BlobInfo{}, err
+	}
+	return f, d.info(key, fi), nil
+}
+
+// Delete remove the blob, missing blobs are not an error
+func (d DiskStore) Delete(ctx context.Context, key string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ctxReader stops reading once ctx is done, so abandoned uploads do not
+// keep writing
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
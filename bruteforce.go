@@ -0,0 +1,272 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AttemptState failed attempts of a key and its lockout
+type AttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore keeps attempt state per key, Update must be atomic per key
+type AttemptStore interface {
+	Get(ctx context.Context, key string) (AttemptState, error)
+	Update(ctx context.Context, key string, fn func(AttemptState) AttemptState) (AttemptState, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryAttemptStore in process AttemptStore
+type MemoryAttemptStore struct {
+	mu    sync.Mutex
+	state map[string]AttemptState
+}
+
+// NewMemoryAttemptStore empty store
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{state: make(map[string]AttemptState)}
+}
+
+// Get state of key
+func (m *MemoryAttemptStore) Get(ctx context.Context, key string) (AttemptState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state[key], nil
+}
+
+// Update state of key with fn
+func (m *MemoryAttemptStore) Update(ctx context.Context, key string, fn func(AttemptState) AttemptState) (AttemptState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := fn(m.state[key])
+	m.state[key] = s
+	return s, nil
+}
+
+// Delete state of key
+func (m *MemoryAttemptStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.state, key)
+	return nil
+}
+
+// Cleanup drop keys without failures since before
+func (m *MemoryAttemptStore) Cleanup(before time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, s := range m.state {
+		if s.LastFailure.Before(before) && s.LockedUntil.Before(before) {
+			delete(m.state, k)
+		}
+	}
+}
+
+// BruteForce tracks failed attempts on auth endpoints per account and per
+// client ip. Responses with 401 or 403 count as failures, 2xx responses
+// reset the account. Past the threshold a key is locked out for an
+// exponentially growing time and answered with 429. Attempts are counted
+// as failures before the endpoint runs, so parallel guesses can not get
+// past the threshold.
+type BruteForce struct {
+	Store AttemptStore
+	// Account name of the request, nil or empty only tracks the ip
+	Account func(r *http.Request) string
+	// AccountThreshold and IPThreshold failures allowed before lockout
+	AccountThreshold int
+	IPThreshold      int
+	// BaseLockout first lockout, doubled with every further failure up to
+	// MaxLockout
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// ResetAfter failures older than this are forgotten
+	ResetAfter time.Duration
+}
+
+// NewBruteForce protection with defaults
+func NewBruteForce(store AttemptStore) *BruteForce {
+	return &BruteForce{
+		Store:            store,
+		AccountThreshold: 5,
+		IPThreshold:      20,
+		BaseLockout:      time.Second,
+		MaxLockout:       15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+}
+
+// JSONAccount Account reading field of a json body, the body is restored
+// for the endpoint. Bodies over the route's read limit are answered with
+// 413 by Decorate.
+func JSONAccount(field string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if r.Body == nil {
+			return ""
+		}
+		body, err := readBody(r)
+		if err == ErrBodyTooLarge {
+			r.Body = oversizedBody{}
+			return ""
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+		var v map[string]interface{}
+		if json.Unmarshal(body, &v) != nil {
+			return ""
+		}
+		s, _ := v[field].(string)
+		return s
+	}
+}
+
+// oversizedBody replaces a body JSONAccount found too large
+type oversizedBody struct{}
+
+func (oversizedBody) Read(p []byte) (int, error) { return 0, ErrBodyTooLarge }
+func (oversizedBody) Close() error               { return nil }
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Decorate EndPointDecorator enforcing lockouts
+func (b *BruteForce) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		now := ClockFrom(ctx).Now()
+		var account string
+		if b.Account != nil {
+			account = b.Account(r)
+			if _, ok := r.Body.(oversizedBody); ok {
+				res := JSONResult{
+					Success:    false,
+					StatusCode: http.StatusRequestEntityTooLarge,
+					Error:      ErrBodyTooLarge.Error(),
+				}
+				res.Write(w)
+				return
+			}
+		}
+		keys := []string{"ip:" + clientIP(r)}
+		thresholds := []int{b.IPThreshold}
+		if account != "" {
+			keys = append(keys, "account:"+account)
+			thresholds = append(thresholds, b.AccountThreshold)
+		}
+		var held []attempt
+		release := func() {
+			for _, a := range held {
+				b.release(ctx, a)
+			}
+		}
+		for i, key := range keys {
+			a, locked, err := b.reserve(ctx, key, thresholds[i], now)
+			if err != nil {
+				release()
+				ErrorResponse(w, err)
+				return
+			}
+			if locked > 0 {
+				release()
+				b.locked(w, locked)
+				return
+			}
+			held = append(held, a)
+		}
+		rec := newResponseRecorder(w)
+		e(ctx, rec, r)
+		switch status := rec.Status(); {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			// counted already
+		case status >= 200 && status < 300 && account != "":
+			// a login to another account says nothing about the ip
+			b.release(ctx, held[0])
+			b.Store.Delete(ctx, keys[1])
+		default:
+			release()
+		}
+	}
+}
+
+// attempt failure counted for key ahead of the outcome, with the state it
+// replaced so it can be taken back
+type attempt struct {
+	key  string
+	prev AttemptState
+	set  AttemptState
+}
+
+// reserve count an attempt on key as failure unless key is locked out,
+// checking and counting in one atomic update. A locked key is reported
+// with the time left.
+func (b *BruteForce) reserve(ctx context.Context, key string, threshold int, now time.Time) (attempt, time.Duration, error) {
+	a := attempt{key: key}
+	var locked time.Duration
+	_, err := b.Store.Update(ctx, key, func(s AttemptState) AttemptState {
+		locked = 0
+		a.prev, a.set = s, AttemptState{}
+		if now.Before(s.LockedUntil) {
+			locked = s.LockedUntil.Sub(now)
+			return s
+		}
+		if b.ResetAfter > 0 && now.Sub(s.LastFailure) > b.ResetAfter {
+			s.Failures = 0
+		}
+		s.Failures++
+		s.LastFailure = now
+		if over := s.Failures - threshold; over > 0 {
+			lockout := b.MaxLockout
+			if over < 32 {
+				if d := b.BaseLockout << uint(over-1); d > 0 && d < lockout {
+					lockout = d
+				}
+			}
+			s.LockedUntil = now.Add(lockout)
+		}
+		a.set = s
+		return s
+	})
+	return a, locked, err
+}
+
+// release take back an attempt that turned out not to be a failure,
+// leaving failures counted meanwhile by other requests
+func (b *BruteForce) release(ctx context.Context, a attempt) {
+	b.Store.Update(ctx, a.key, func(s AttemptState) AttemptState {
+		if s.Failures > 0 {
+			s.Failures--
+		}
+		if s.LastFailure.Equal(a.set.LastFailure) && s.Failures == a.prev.Failures {
+			s.LastFailure = a.prev.LastFailure
+		}
+		if s.LockedUntil.Equal(a.set.LockedUntil) {
+			s.LockedUntil = a.prev.LockedUntil
+		}
+		return s
+	})
+}
+
+func (b *BruteForce) locked(w http.ResponseWriter, left time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((left+time.Second-1)/time.Second)))
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusTooManyRequests,
+		Error:      "too many failed attempts",
+	}
+	res.Write(w)
+}
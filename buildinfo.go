@@ -0,0 +1,71 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// BuildInfo identifies the running binary
+type BuildInfo struct {
+	Version   string            `json:"version,omitempty"`
+	GitSHA    string            `json:"git_sha,omitempty"`
+	BuildTime string            `json:"build_time,omitempty"`
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Modules   map[string]string `json:"modules,omitempty"`
+}
+
+// WithBuildInfo set version, git sha and build time, typically injected
+// with -ldflags "-X main.version=..." in the main package
+func WithBuildInfo(version, gitSHA, buildTime string) Option {
+	return func(s *Server) {
+		s.build.Version = version
+		s.build.GitSHA = gitSHA
+		s.build.BuildTime = buildTime
+	}
+}
+
+// BuildInfo build info of the running binary, values not set through
+// WithBuildInfo are filled from debug.ReadBuildInfo
+func (s *Server) BuildInfo() BuildInfo {
+	info := s.build
+	info.GoVersion = runtime.Version()
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Path = bi.Path
+	if info.Version == "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.GitSHA == "" {
+				info.GitSHA = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	info.Modules = make(map[string]string, len(bi.Deps))
+	for _, dep := range bi.Deps {
+		version := dep.Version
+		if dep.Replace != nil {
+			version = dep.Replace.Path + "@" + dep.Replace.Version
+		}
+		info.Modules[dep.Path] = version
+	}
+	return info
+}
+
+// EnableBuildInfo mount the build info endpoint at path
+func (s *Server) EnableBuildInfo(path string) {
+	s.AddEndPoint(http.MethodGet, path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ResultResponse(w, s.BuildInfo())
+	})
+}
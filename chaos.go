@@ -0,0 +1,186 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChaosConfig faults injected by Chaos, rates are probabilities between 0
+// and 1 checked independently per request
+type ChaosConfig struct {
+	Enabled     bool          `json:"enabled"`
+	LatencyRate float64       `json:"latency_rate"`
+	Latency     time.Duration `json:"latency"`
+	Jitter      time.Duration `json:"jitter"`
+	ErrorRate   float64       `json:"error_rate"`
+	// ErrorStatus answered for injected errors, defaults to 500
+	ErrorStatus  int     `json:"error_status,omitempty"`
+	DropRate     float64 `json:"drop_rate"`
+	TruncateRate float64 `json:"truncate_rate"`
+}
+
+// Chaos fault injection for resilience testing in staging: added latency,
+// error responses, dropped connections and truncated bodies. Never enable
+// it in production.
+type Chaos struct {
+	// Rand source of randomness, defaults to math/rand
+	Rand func() float64
+
+	mu     sync.RWMutex
+	config ChaosConfig
+}
+
+// NewChaos chaos injecting faults as configured
+func NewChaos(config ChaosConfig) *Chaos {
+	return &Chaos{Rand: rand.Float64, config: config}
+}
+
+// Config current configuration
+func (c *Chaos) Config() ChaosConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config
+}
+
+// Set replace the configuration at runtime
+func (c *Chaos) Set(config ChaosConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = config
+}
+
+// Enable turn fault injection on or off
+func (c *Chaos) Enable(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config.Enabled = on
+}
+
+func (c *Chaos) rand() float64 {
+	if c.Rand == nil {
+		return rand.Float64()
+	}
+	return c.Rand()
+}
+
+func (c *Chaos) roll(rate float64) bool {
+	return rate > 0 && c.rand() < rate
+}
+
+// Decorate EndPointDecorator injecting faults
+func (c *Chaos) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		cfg := c.Config()
+		if !cfg.Enabled {
+			e(ctx, w, r)
+			return
+		}
+		if c.roll(cfg.LatencyRate) {
+			d := cfg.Latency
+			if cfg.Jitter > 0 {
+				d += time.Duration(c.rand() * float64(cfg.Jitter))
+			}
+			select {
+			case <-ClockFrom(ctx).After(d):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if c.roll(cfg.DropRate) {
+			dropConnection(w)
+			return
+		}
+		if c.roll(cfg.ErrorRate) {
+			status := cfg.ErrorStatus
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			res := JSONResult{
+				Success:    false,
+				StatusCode: status,
+				Error:      "chaos: injected fault",
+			}
+			res.Write(w)
+			return
+		}
+		if c.roll(cfg.TruncateRate) {
+			tw := &truncateWriter{ResponseWriter: w, status: http.StatusOK}
+			e(ctx, tw, r)
+			tw.finish()
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+// dropConnection close the client connection without a response
+func dropConnection(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	// http/2 and wrapped writers, the server aborts the stream
+	panic(http.ErrAbortHandler)
+}
+
+// truncateWriter buffers the response, announces its full length and
+// sends only half of it before dropping the connection
+type truncateWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (t *truncateWriter) WriteHeader(status int) {
+	t.status = status
+}
+
+func (t *truncateWriter) Write(b []byte) (int, error) {
+	return t.buf.Write(b)
+}
+
+// Unwrap the underlying writer
+func (t *truncateWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func (t *truncateWriter) finish() {
+	body := t.buf.Bytes()
+	t.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	t.ResponseWriter.WriteHeader(t.status)
+	t.ResponseWriter.Write(body[:len(body)/2])
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	dropConnection(t.ResponseWriter)
+}
+
+// EnableChaos mount an endpoint at path reading (GET) and replacing (PUT)
+// the chaos configuration at runtime
+func (s *Server) EnableChaos(path string, c *Chaos, auth EndPointDecorator) {
+	s.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, c.Config())
+		},
+	))
+	s.AddEndPoint(http.MethodPut, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			var cfg ChaosConfig
+			if err := DecodeBody(r, &cfg); err != nil {
+				BadRequest(w, err)
+				return
+			}
+			c.Set(cfg)
+			log.Printf("chaos: configuration changed: %+v", cfg)
+			ResultResponse(w, cfg)
+		},
+	))
+}
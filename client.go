@@ -0,0 +1,269 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// client defaults
+const (
+	ClientTimeout    = 30 * time.Second
+	ClientMaxRetries = 3
+	ClientBackoff    = 100 * time.Millisecond
+	ClientMaxBackoff = 5 * time.Second
+)
+
+// ClientPool connection pooling of a client transport
+type ClientPool struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration
+}
+
+// DefaultClientPool pooling suited for service to service calls, keeping
+// more idle connections per host than net/http does
+var DefaultClientPool = ClientPool{
+	MaxIdleConns:        256,
+	MaxIdleConnsPerHost: 64,
+	IdleConnTimeout:     90 * time.Second,
+	DialTimeout:         5 * time.Second,
+	KeepAlive:           30 * time.Second,
+}
+
+// NewTransport transport pooling connections as configured
+func NewTransport(pool ClientPool) *http.Transport {
+	dialer := &net.Dialer{Timeout: pool.DialTimeout, KeepAlive: pool.KeepAlive}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          pool.MaxIdleConns,
+		MaxIdleConnsPerHost:   pool.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       pool.MaxConnsPerHost,
+		IdleConnTimeout:       pool.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+}
+
+// ClientError non success envelope returned by a server
+type ClientError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ClientError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client calls servers of this package, encoding bodies as json and
+// decoding the JSONResult envelope. Idempotent requests are retried with
+// backoff on connection errors, 429 and 502-504.
+type Client struct {
+	HTTP    *http.Client
+	BaseURL string
+	// Timeout per call including retries, when ctx has no earlier deadline.
+	// The remaining budget is sent in X-Request-Timeout.
+	Timeout    time.Duration
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// OnRequest is called before every attempt, e.g. to add auth headers
+	OnRequest func(r *http.Request)
+	// Signer signs every attempt after OnRequest, nil sends unsigned
+	Signer RequestSigner
+	// OnResponse is called after every attempt with its outcome
+	OnResponse func(r *http.Request, res *http.Response, dur time.Duration, err error)
+}
+
+// NewClient client for the server at baseURL
+func NewClient(baseURL string) *Client {
+	return &Client{
+		HTTP:       &http.Client{Transport: NewTransport(DefaultClientPool)},
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Timeout:    ClientTimeout,
+		MaxRetries: ClientMaxRetries,
+		Backoff:    ClientBackoff,
+		MaxBackoff: ClientMaxBackoff,
+	}
+}
+
+// Get decode the result of GET path into result
+func (c *Client) Get(ctx context.Context, path string, result interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, result)
+}
+
+// Post post body, decoding the result into result
+func (c *Client) Post(ctx context.Context, path string, body, result interface{}) error {
+	return c.Do(ctx, http.MethodPost, path, body, result)
+}
+
+// Put put body, decoding the result into result
+func (c *Client) Put(ctx context.Context, path string, body, result interface{}) error {
+	return c.Do(ctx, http.MethodPut, path, body, result)
+}
+
+// Delete delete path
+func (c *Client) Delete(ctx context.Context, path string, result interface{}) error {
+	return c.Do(ctx, http.MethodDelete, path, nil, result)
+}
+
+// Do call path, body is sent as json when not nil and the envelope result
+// is decoded into result when not nil. Servers answering without success
+// yield a *ClientError.
+func (c *Client) Do(ctx context.Context, method, path string, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	retries := 0
+	if idempotent(method) {
+		retries = c.MaxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := c.attempt(ctx, method, path, payload)
+		if attempt < retries && retryable(res, err) {
+			wait := backoff(c.Backoff, c.MaxBackoff, attempt+1)
+			if res != nil {
+				if after := retryAfter(res); after > 0 {
+					wait = after
+				}
+				drain(res)
+			}
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+				continue
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return decodeResult(res, result)
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if ms := time.Until(deadline).Milliseconds(); ms > 0 {
+			req.Header.Set(TimeoutHeader, strconv.FormatInt(ms, 10))
+		}
+	}
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	if c.OnRequest != nil {
+		c.OnRequest(req)
+	}
+	if c.Signer != nil {
+		if err := c.Signer.SignRequest(req, payload); err != nil {
+			return nil, err
+		}
+	}
+	begin := time.Now()
+	res, err := c.HTTP.Do(req)
+	if c.OnResponse != nil {
+		c.OnResponse(req, res, time.Since(begin), err)
+	}
+	return res, err
+}
+
+func decodeResult(res *http.Response, result interface{}) error {
+	defer drain(res)
+	var env struct {
+		Success bool            `json:"success"`
+		Error   string          `json:"error"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&env); err != nil {
+		if res.StatusCode >= 300 {
+			return &ClientError{StatusCode: res.StatusCode, Message: res.Status}
+		}
+		return err
+	}
+	if !env.Success || res.StatusCode >= 300 {
+		return &ClientError{StatusCode: res.StatusCode, Message: env.Error}
+	}
+	if result == nil || len(env.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(env.Result, result)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter delay asked for in a Retry-After header, in seconds or as a
+// http date
+func retryAfter(res *http.Response) time.Duration {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// drain read the rest of the body so the connection is reused
+func drain(res *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, READLIMIT))
+	res.Body.Close()
+}
@@ -0,0 +1,101 @@
+package net
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock source of time for decorators, tests swap in a fake clock to
+// control time instead of sleeping
+type Clock interface {
+	Now() time.Time
+	// After like time.After
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock the real clock, used when none is set
+var SystemClock Clock = systemClock{}
+
+// WithClock run the server on clock, it is passed to endpoints in the
+// request context
+func WithClock(c Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// ClockContext context carrying clock
+func ClockContext(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey, c)
+}
+
+// ClockFrom clock of the request, SystemClock when none is set
+func ClockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey).(Clock); ok {
+		return c
+	}
+	return SystemClock
+}
+
+// ClockTimeout like context.WithTimeout, but the deadline follows the
+// clock of ctx
+func ClockTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	clock := ClockFrom(ctx)
+	if _, ok := clock.(systemClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	c := &clockCtx{
+		Context:  ctx,
+		deadline: clock.Now().Add(d),
+		done:     make(chan struct{}),
+		cancel:   make(chan struct{}),
+	}
+	if parent, ok := ctx.Deadline(); ok && parent.Before(c.deadline) {
+		c.deadline = parent
+	}
+	go c.wait(clock.After(d))
+	var once sync.Once
+	return c, func() { once.Do(func() { close(c.cancel) }) }
+}
+
+// clockCtx context whose deadline fires on a Clock
+type clockCtx struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+	cancel   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *clockCtx) wait(expired <-chan time.Time) {
+	var err error
+	select {
+	case <-c.Context.Done():
+		err = c.Context.Err()
+	case <-expired:
+		err = context.DeadlineExceeded
+	case <-c.cancel:
+		err = context.Canceled
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *clockCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+func (c *clockCtx) Done() <-chan struct{}       { return c.done }
+
+func (c *clockCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
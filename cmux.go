@@ -0,0 +1,237 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Matcher inspects the first bytes of a connection
+type Matcher func(r io.Reader) bool
+
+// http2Preface client connection preface, grpc over cleartext starts with it
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// HTTP2 matches cleartext http/2 with prior knowledge, which is how grpc
+// clients talk to a plaintext server. Bytes are compared as they arrive,
+// so short http/1 requests are told apart without waiting for more.
+func HTTP2() Matcher {
+	return func(r io.Reader) bool {
+		buf := make([]byte, len(http2Preface))
+		for n := 0; n < len(buf); {
+			m, err := r.Read(buf[n:])
+			n += m
+			if !bytes.Equal(buf[:n], http2Preface[:n]) || err != nil && n < len(buf) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// HTTP1 matches http/1.x request lines
+func HTTP1() Matcher {
+	return func(r io.Reader) bool {
+		line, err := bufio.NewReaderSize(r, 4096).ReadSlice('\n')
+		if err != nil {
+			return false
+		}
+		return bytes.Contains(line, []byte(" HTTP/1."))
+	}
+}
+
+// Any matches every connection
+func Any() Matcher {
+	return func(io.Reader) bool { return true }
+}
+
+// ListenerMux splits one listener into several by sniffing the first bytes
+// of each connection, so protocols like grpc and http/1 can share a port
+type ListenerMux struct {
+	root net.Listener
+	// SniffTimeout bounds how long a new connection may take to identify
+	// itself
+	SniffTimeout time.Duration
+
+	mu        sync.Mutex
+	listeners []*muxListener
+	closed    chan struct{}
+	once      sync.Once
+}
+
+// NewListenerMux mux over l, call Serve after registering matchers
+func NewListenerMux(l net.Listener) *ListenerMux {
+	return &ListenerMux{
+		root:         l,
+		SniffTimeout: 5 * time.Second,
+		closed:       make(chan struct{}),
+	}
+}
+
+// Match listener receiving connections matched by any of matchers,
+// matchers are tried in registration order
+func (m *ListenerMux) Match(matchers ...Matcher) net.Listener {
+	l := &muxListener{
+		mux:      m,
+		matchers: matchers,
+		conns:    make(chan net.Conn),
+	}
+	m.mu.Lock()
+	m.listeners = append(m.listeners, l)
+	m.mu.Unlock()
+	return l
+}
+
+// Serve accept connections until the root listener fails or is closed
+func (m *ListenerMux) Serve() error {
+	defer m.Close()
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			select {
+			case <-m.closed:
+				return nil
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go m.dispatch(conn)
+	}
+}
+
+func (m *ListenerMux) dispatch(conn net.Conn) {
+	sc := &sniffConn{Conn: conn}
+	conn.SetReadDeadline(time.Now().Add(m.SniffTimeout))
+	m.mu.Lock()
+	listeners := m.listeners
+	m.mu.Unlock()
+	for _, l := range listeners {
+		for _, match := range l.matchers {
+			if !match(sc.sniff()) {
+				continue
+			}
+			conn.SetReadDeadline(time.Time{})
+			select {
+			case l.conns <- sc:
+			case <-m.closed:
+				conn.Close()
+			}
+			return
+		}
+	}
+	conn.Close()
+}
+
+// Close close the root listener and every matched listener
+func (m *ListenerMux) Close() error {
+	var err error
+	m.once.Do(func() {
+		close(m.closed)
+		err = m.root.Close()
+	})
+	return err
+}
+
+type muxListener struct {
+	mux      *ListenerMux
+	matchers []Matcher
+	conns    chan net.Conn
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.mux.closed:
+		return nil, fmt.Errorf("listener mux closed")
+	}
+}
+
+func (l *muxListener) Close() error {
+	return l.mux.Close()
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.mux.root.Addr()
+}
+
+// sniffConn replays the bytes read while sniffing
+type sniffConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+// sniff reader starting from the first byte of the connection, bytes read
+// from the connection are kept for later readers
+func (c *sniffConn) sniff() io.Reader {
+	return io.MultiReader(bytes.NewReader(c.buf.Bytes()), io.TeeReader(c.Conn, &c.buf))
+}
+
+func (c *sniffConn) Read(p []byte) (int, error) {
+	if c.buf.Len() > 0 {
+		return c.buf.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+// GRPCServer the part of *grpc.Server needed to share a listener
+type GRPCServer interface {
+	Serve(net.Listener) error
+	GracefulStop()
+	Stop()
+}
+
+// ServeWithGRPC serve http and grpc on l, cleartext http/2 goes to g and
+// everything else to the server; both are stopped on Shutdown. When one of
+// them fails the others are stopped before the error is returned.
+func (s *Server) ServeWithGRPC(l net.Listener, g GRPCServer) error {
+	mux := NewListenerMux(l)
+	grpcL := mux.Match(HTTP2())
+	httpL := mux.Match(Any())
+	hs := s.HTTPServer()
+	s.OnShutdown(func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			g.GracefulStop()
+			close(done)
+		}()
+		err := hs.Shutdown(ctx)
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		mux.Close()
+		return err
+	})
+	s.listening()
+	errs := make(chan error, 3)
+	go func() { errs <- g.Serve(grpcL) }()
+	go func() { errs <- hs.Serve(httpL) }()
+	go func() { errs <- mux.Serve() }()
+	err := <-errs
+	select {
+	case <-mux.closed:
+		// shut down
+		return nil
+	default:
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	mux.Close()
+	hs.Close()
+	g.Stop()
+	<-errs
+	<-errs
+	return err
+}
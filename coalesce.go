@@ -0,0 +1,152 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CoalesceHeaders request headers that are part of the default coalescing
+// key, requests differing in them never share a response
+var CoalesceHeaders = []string{"Authorization", "Cookie", "Accept", "Accept-Encoding", "Accept-Language"}
+
+// Coalescer collapses concurrent identical GET requests into one endpoint
+// execution whose response is sent to all of them. The response is
+// buffered, so it suits read endpoints, not streams.
+type Coalescer struct {
+	// Key identifies identical requests, defaults to the request uri and
+	// the CoalesceHeaders
+	Key func(*http.Request) string
+
+	mu     sync.Mutex
+	calls  map[string]*coalescedCall
+	shared uint64
+}
+
+type coalescedCall struct {
+	done     chan struct{}
+	status   int
+	header   http.Header
+	body     []byte
+	panicked bool
+}
+
+// NewCoalescer coalescer keyed on the default key
+func NewCoalescer() *Coalescer {
+	return &Coalescer{calls: make(map[string]*coalescedCall)}
+}
+
+// Shared number of requests served from another request's execution
+func (c *Coalescer) Shared() uint64 {
+	return atomic.LoadUint64(&c.shared)
+}
+
+func coalesceKey(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.URL.RequestURI())
+	for _, h := range CoalesceHeaders {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header[h], ","))
+	}
+	return b.String()
+}
+
+// Decorate EndPointDecorator coalescing GET requests
+func (c *Coalescer) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			e(ctx, w, r)
+			return
+		}
+		key := coalesceKey
+		if c.Key != nil {
+			key = c.Key
+		}
+		k := key(r)
+		c.mu.Lock()
+		if call, ok := c.calls[k]; ok {
+			c.mu.Unlock()
+			atomic.AddUint64(&c.shared, 1)
+			select {
+			case <-call.done:
+				call.write(w)
+			case <-ctx.Done():
+			}
+			return
+		}
+		call := &coalescedCall{done: make(chan struct{}), panicked: true}
+		c.calls[k] = call
+		c.mu.Unlock()
+		// followers are answered from this execution, which may outlive
+		// their own endpoints
+		Detach(ctx)
+		rec := &bufferWriter{ResponseWriter: w, header: http.Header{}}
+		defer func() {
+			c.mu.Lock()
+			delete(c.calls, k)
+			c.mu.Unlock()
+			close(call.done)
+		}()
+		e(ctx, rec, r)
+		call.status, call.header, call.body = rec.Status(), rec.header, rec.body.Bytes()
+		call.panicked = false
+		call.write(w)
+	}
+}
+
+func (call *coalescedCall) write(w http.ResponseWriter) {
+	if call.panicked {
+		ErrorResponse(w, fmt.Errorf("coalesced request failed"))
+		return
+	}
+	h := w.Header()
+	for k, v := range call.header {
+		if k == RequestIDHeader {
+			continue
+		}
+		h[k] = append([]string(nil), v...)
+	}
+	w.WriteHeader(call.status)
+	w.Write(call.body)
+}
+
+// bufferWriter response writer keeping the response in memory, settings
+// of the server are still found through Unwrap
+type bufferWriter struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferWriter) Header() http.Header { return b.header }
+
+func (b *bufferWriter) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferWriter) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// Status written status, 200 if nothing was written
+func (b *bufferWriter) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// Unwrap the writer the response is eventually written to
+func (b *bufferWriter) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
@@ -0,0 +1,190 @@
+package net
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigType value type of a config key, checked on load
+type ConfigType int
+
+// config value types
+const (
+	TypeString ConfigType = iota
+	TypeInt
+	TypeBool
+	TypeDuration
+	TypeURL
+)
+
+func (t ConfigType) String() string {
+	switch t {
+	case TypeInt:
+		return "int"
+	case TypeBool:
+		return "bool"
+	case TypeDuration:
+		return "duration"
+	case TypeURL:
+		return "url"
+	}
+	return "string"
+}
+
+// ConfigKey describes one configuration value
+type ConfigKey struct {
+	Name     string
+	Type     ConfigType
+	Default  string
+	Required bool
+	// Secret values are redacted wherever config is displayed
+	Secret      bool
+	Description string
+}
+
+// ConfigSpec the keys an application reads
+type ConfigSpec []ConfigKey
+
+// ConfigError every missing and invalid key found while loading
+type ConfigError struct {
+	Missing []string
+	Invalid map[string]error
+}
+
+func (e *ConfigError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		keys := make([]string, 0, len(e.Invalid))
+		for k := range e.Invalid {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		invalid := make([]string, len(keys))
+		for i, k := range keys {
+			invalid[i] = fmt.Sprintf("%s (%s)", k, e.Invalid[k])
+		}
+		parts = append(parts, "invalid: "+strings.Join(invalid, ", "))
+	}
+	return "config: " + strings.Join(parts, "; ")
+}
+
+// Config validated configuration values
+type Config struct {
+	spec   map[string]ConfigKey
+	values map[string]string
+	lookup func(string) (string, bool, error)
+}
+
+// LoadConfig read spec from the environment, all missing required keys
+// and malformed values are reported at once in a *ConfigError
+func LoadConfig(spec ConfigSpec) (*Config, error) {
+	return LoadConfigFrom(spec, EnvSource{})
+}
+
+// MustLoad LoadConfig panicking with every problem found
+func MustLoad(spec ConfigSpec) *Config {
+	c, err := LoadConfig(spec)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func loadConfig(spec ConfigSpec, lookup func(string) (string, bool, error)) (*Config, error) {
+	c := &Config{
+		spec:   make(map[string]ConfigKey, len(spec)),
+		values: make(map[string]string, len(spec)),
+		lookup: lookup,
+	}
+	cerr := &ConfigError{Invalid: make(map[string]error)}
+	for _, key := range spec {
+		c.spec[key.Name] = key
+		val, ok, err := lookup(key.Name)
+		if err != nil {
+			cerr.Invalid[key.Name] = err
+			continue
+		}
+		if !ok || val == "" {
+			if key.Required && key.Default == "" {
+				cerr.Missing = append(cerr.Missing, key.Name)
+				continue
+			}
+			val = key.Default
+		}
+		if val != "" {
+			if err := checkType(key.Type, val); err != nil {
+				cerr.Invalid[key.Name] = err
+				continue
+			}
+		}
+		c.values[key.Name] = val
+	}
+	if len(cerr.Missing) > 0 || len(cerr.Invalid) > 0 {
+		return nil, cerr
+	}
+	return c, nil
+}
+
+func checkType(t ConfigType, val string) error {
+	var err error
+	switch t {
+	case TypeInt:
+		_, err = strconv.Atoi(val)
+	case TypeBool:
+		_, err = strconv.ParseBool(val)
+	case TypeDuration:
+		_, err = time.ParseDuration(val)
+	case TypeURL:
+		_, err = url.Parse(val)
+	}
+	if err != nil {
+		return fmt.Errorf("not a valid %s", t)
+	}
+	return nil
+}
+
+// Lookup raw value of key
+func (c *Config) Lookup(key string) (string, bool) {
+	val, ok := c.values[key]
+	return val, ok
+}
+
+// String value of key, empty when unset
+func (c *Config) String(key string) string {
+	return c.values[key]
+}
+
+// Int value of key, 0 when unset
+func (c *Config) Int(key string) int {
+	i, _ := strconv.Atoi(c.values[key])
+	return i
+}
+
+// Bool value of key, false when unset
+func (c *Config) Bool(key string) bool {
+	b, _ := strconv.ParseBool(c.values[key])
+	return b
+}
+
+// Duration value of key, 0 when unset
+func (c *Config) Duration(key string) time.Duration {
+	d, _ := time.ParseDuration(c.values[key])
+	return d
+}
+
+// URL value of key, nil when unset
+func (c *Config) URL(key string) *url.URL {
+	val := c.values[key]
+	if val == "" {
+		return nil
+	}
+	u, _ := url.Parse(val)
+	return u
+}
@@ -0,0 +1,231 @@
+package net
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// Bind populate the struct v points to from the config sources. Fields are
+// matched through tags:
+//
+//	type AppConfig struct {
+//		DB      DBConfig      `config:"DB"`
+//		Port    int           `config:"PORT" default:"8080" validate:"min=1,max=65535"`
+//		Timeout time.Duration `config:"TIMEOUT" default:"5s"`
+//		Mode    string        `config:"MODE,required" validate:"oneof=dev|prod"`
+//	}
+//
+// Nested structs prefix their keys, DB.URL reads DB_URL. Every missing,
+// malformed or invalid value is reported in a single *ConfigError.
+func (c *Config) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Bind needs a pointer to a struct, got %T", v)
+	}
+	cerr := &ConfigError{Invalid: make(map[string]error)}
+	c.bindStruct(rv.Elem(), "", cerr)
+	if len(cerr.Missing) > 0 || len(cerr.Invalid) > 0 {
+		return cerr
+	}
+	return nil
+}
+
+func (c *Config) bindStruct(rv reflect.Value, prefix string, cerr *ConfigError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("config")
+		if !ok || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "" {
+			name = strings.ToUpper(field.Name)
+		}
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		fv := rv.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != urlType {
+			c.bindStruct(fv, name, cerr)
+			continue
+		}
+		required := false
+		for _, opt := range opts[1:] {
+			if opt == "required" {
+				required = true
+			}
+		}
+		val, found, err := c.value(name)
+		if err != nil {
+			cerr.Invalid[name] = err
+			continue
+		}
+		if !found {
+			val = field.Tag.Get("default")
+		}
+		if val == "" {
+			if required {
+				cerr.Missing = append(cerr.Missing, name)
+			}
+			continue
+		}
+		if err := setField(fv, val); err != nil {
+			cerr.Invalid[name] = err
+			continue
+		}
+		if rules := field.Tag.Get("validate"); rules != "" {
+			if err := validateField(fv, rules); err != nil {
+				cerr.Invalid[name] = err
+			}
+		}
+	}
+}
+
+// value of key from the loaded values or the sources
+func (c *Config) value(key string) (string, bool, error) {
+	if val, ok := c.values[key]; ok && val != "" {
+		return val, true, nil
+	}
+	if c.lookup == nil {
+		return "", false, nil
+	}
+	val, ok, err := c.lookup(key)
+	if err != nil || !ok || val == "" {
+		return "", false, err
+	}
+	return val, true, nil
+}
+
+func setField(fv reflect.Value, val string) error {
+	switch {
+	case fv.Type() == durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("not a valid duration")
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case fv.Type() == urlType:
+		u, err := url.Parse(val)
+		if err != nil {
+			return fmt.Errorf("not a valid url")
+		}
+		fv.Set(reflect.ValueOf(*u))
+		return nil
+	case fv.Kind() == reflect.Ptr:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setField(elem.Elem(), val); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("not a valid bool")
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("not a valid int")
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("not a valid uint")
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("not a valid float")
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(val, ",")
+		slice := reflect.MakeSlice(fv.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setField(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+// validateField apply comma separated rules: min=n and max=n bound numbers
+// and the length of strings and slices, oneof=a|b restricts values
+func validateField(fv reflect.Value, rules string) error {
+	for _, rule := range strings.Split(rules, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("malformed validation rule %q", rule)
+		}
+		switch parts[0] {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return fmt.Errorf("malformed validation rule %q", rule)
+			}
+			n, ok := fieldMagnitude(fv)
+			if !ok {
+				return fmt.Errorf("%s does not apply to %s", parts[0], fv.Type())
+			}
+			if parts[0] == "min" && n < limit {
+				return fmt.Errorf("must be at least %s", parts[1])
+			}
+			if parts[0] == "max" && n > limit {
+				return fmt.Errorf("must be at most %s", parts[1])
+			}
+		case "oneof":
+			val := fmt.Sprint(fv.Interface())
+			allowed := strings.Split(parts[1], "|")
+			match := false
+			for _, a := range allowed {
+				if a == val {
+					match = true
+				}
+			}
+			if !match {
+				return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+			}
+		default:
+			return fmt.Errorf("unknown validation rule %q", parts[0])
+		}
+	}
+	return nil
+}
+
+func fieldMagnitude(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	case reflect.String, reflect.Slice:
+		return float64(fv.Len()), true
+	}
+	return 0, false
+}
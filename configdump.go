@@ -0,0 +1,58 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted placeholder for secret config values
+const Redacted = "[REDACTED]"
+
+// secretHints key name fragments treated as secret even without the
+// Secret flag
+var secretHints = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "PRIVATE", "CREDENTIAL", "API_KEY"}
+
+// Redacted effective values with secrets masked, key flagged Secret or
+// named like one are replaced, passwords in urls are masked
+func (c *Config) Redacted() map[string]string {
+	ret := make(map[string]string, len(c.values))
+	for key, val := range c.values {
+		ret[key] = c.redact(key, val)
+	}
+	return ret
+}
+
+func (c *Config) redact(key, val string) string {
+	if val == "" {
+		return val
+	}
+	if c.spec[key].Secret {
+		return Redacted
+	}
+	upper := strings.ToUpper(key)
+	for _, hint := range secretHints {
+		if strings.Contains(upper, hint) {
+			return Redacted
+		}
+	}
+	if u, err := url.Parse(val); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			return u.String()
+		}
+	}
+	return val
+}
+
+// EnableConfigDump mount an endpoint at path returning the effective,
+// redacted configuration, config is called per request so reloaded
+// configs show up
+func (s *Server) EnableConfigDump(path string, config func() *Config, auth EndPointDecorator) {
+	s.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, config().Redacted())
+		},
+	))
+}
@@ -0,0 +1,154 @@
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigSource provides raw config values by key
+type ConfigSource interface {
+	Lookup(key string) (string, bool)
+}
+
+// EnvSource reads config from the environment
+type EnvSource struct{}
+
+// Lookup environment value of key
+func (EnvSource) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+// MapSource static config values
+type MapSource map[string]string
+
+// Lookup value of key
+func (m MapSource) Lookup(key string) (string, bool) {
+	val, ok := m[key]
+	return val, ok
+}
+
+// LoadConfigFrom read spec from sources, the first source holding a key
+// wins. A source holding KEY_FILE instead of KEY has the value read from
+// that file, the way docker and kubernetes mount secrets.
+func LoadConfigFrom(spec ConfigSpec, sources ...ConfigSource) (*Config, error) {
+	return loadConfig(spec, func(key string) (string, bool, error) {
+		for _, src := range sources {
+			if esrc, ok := src.(errConfigSource); ok {
+				val, ok, err := esrc.lookupErr(key)
+				if err != nil || (ok && val != "") {
+					return val, ok, err
+				}
+			} else if val, ok := src.Lookup(key); ok && val != "" {
+				return val, true, nil
+			}
+			if path, ok := src.Lookup(key + "_FILE"); ok && path != "" {
+				val, err := readSecretFile(path)
+				return val, err == nil, err
+			}
+		}
+		return "", false, nil
+	})
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading secret file: %s", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// LoadConfigFiles read spec from config files layered under the
+// environment, later files override earlier ones
+func LoadConfigFiles(spec ConfigSpec, paths ...string) (*Config, error) {
+	sources := []ConfigSource{EnvSource{}}
+	for i := len(paths) - 1; i >= 0; i-- {
+		src, err := ConfigFile(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return LoadConfigFrom(spec, sources...)
+}
+
+// ConfigFile parse a yaml, toml or json file by extension. Nested keys are
+// flattened to environment style names, {db: {url: x}} becomes DB_URL.
+func ConfigFile(path string) (MapSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	case ".json":
+		err = json.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config: unsupported file type %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %s", path, err)
+	}
+	src := make(MapSource)
+	flatten(src, "", tree)
+	return src, nil
+}
+
+func flatten(dst MapSource, prefix string, v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flatten(dst, configName(prefix, k), val[k])
+		}
+	case []interface{}:
+		items := make([]string, len(val))
+		for i, item := range val {
+			items[i] = configValue(item)
+		}
+		dst[prefix] = strings.Join(items, ",")
+	case nil:
+		dst[prefix] = ""
+	default:
+		dst[prefix] = configValue(val)
+	}
+}
+
+// configValue v as the settings parse it, floats without exponent so
+// integers from json files stay integers
+func configValue(v interface{}) string {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
+
+var configNameReplacer = strings.NewReplacer("-", "_", ".", "_", " ", "_")
+
+func configName(prefix, key string) string {
+	key = strings.ToUpper(configNameReplacer.Replace(key))
+	if prefix == "" {
+		return key
+	}
+	return prefix + "_" + key
+}
@@ -0,0 +1,71 @@
+package net
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+// FlagSource config values passed as command line flags, only flags set
+// explicitly are reported so lower sources still apply
+type FlagSource struct {
+	fs     *flag.FlagSet
+	values map[string]*string
+}
+
+// FlagName flag for a config key, DB_URL becomes db-url
+func FlagName(key string) string {
+	return strings.ToLower(strings.Replace(key, "_", "-", -1))
+}
+
+// NewFlagSource register a flag on fs for every key in spec
+func NewFlagSource(fs *flag.FlagSet, spec ConfigSpec) *FlagSource {
+	src := &FlagSource{
+		fs:     fs,
+		values: make(map[string]*string, len(spec)),
+	}
+	for _, key := range spec {
+		usage := key.Description
+		if usage == "" {
+			usage = key.Type.String() + " value of " + key.Name
+		}
+		usage += " (env " + key.Name + ")"
+		src.values[key.Name] = fs.String(FlagName(key.Name), key.Default, usage)
+	}
+	return src
+}
+
+// Lookup value of the flag for key when set on the command line
+func (f *FlagSource) Lookup(key string) (string, bool) {
+	val, ok := f.values[key]
+	if !ok {
+		return "", false
+	}
+	set := false
+	name := FlagName(key)
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return *val, set
+}
+
+// LoadConfigArgs read spec from command line args, falling back to the
+// environment and then to config files, see LoadConfigFiles
+func LoadConfigArgs(spec ConfigSpec, args []string, paths ...string) (*Config, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags := NewFlagSource(fs, spec)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	sources := []ConfigSource{flags, EnvSource{}}
+	for i := len(paths) - 1; i >= 0; i-- {
+		src, err := ConfigFile(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return LoadConfigFrom(spec, sources...)
+}
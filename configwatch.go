@@ -0,0 +1,132 @@
+package net
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigListener is told about a swapped in config
+type ConfigListener func(old, new *Config)
+
+// ConfigWatcher reloads config files when they change, a config that does
+// not validate is rejected and the active one stays in place
+type ConfigWatcher struct {
+	// Interval files are checked at, defaults to 2s
+	Interval time.Duration
+	// OnError receives rejected reloads, they are logged when nil
+	OnError func(error)
+
+	spec    ConfigSpec
+	paths   []string
+	current atomic.Value
+
+	mu        sync.Mutex
+	listeners []ConfigListener
+	stamps    []fileStamp
+}
+
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// NewConfigWatcher load spec from paths, see LoadConfigFiles
+func NewConfigWatcher(spec ConfigSpec, paths ...string) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{
+		Interval: 2 * time.Second,
+		spec:     spec,
+		paths:    paths,
+	}
+	w.stamps = w.stat()
+	c, err := LoadConfigFiles(spec, paths...)
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(c)
+	return w, nil
+}
+
+// Config the active config
+func (w *ConfigWatcher) Config() *Config {
+	return w.current.Load().(*Config)
+}
+
+// OnChange register a listener called after every successful reload
+func (w *ConfigWatcher) OnChange(l ConfigListener) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, l)
+}
+
+// Reload load and validate the files now, swapping the config in and
+// notifying listeners on success
+func (w *ConfigWatcher) Reload() error {
+	c, err := LoadConfigFiles(w.spec, w.paths...)
+	if err != nil {
+		return err
+	}
+	old := w.current.Load().(*Config)
+	w.current.Store(c)
+	w.mu.Lock()
+	listeners := w.listeners
+	w.mu.Unlock()
+	for _, l := range listeners {
+		l(old, c)
+	}
+	return nil
+}
+
+// Run poll the files until ctx is done
+func (w *ConfigWatcher) Run(ctx context.Context) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if !w.changed() {
+				continue
+			}
+			if err := w.Reload(); err != nil {
+				if w.OnError != nil {
+					w.OnError(err)
+				} else {
+					log.Printf("config reload rejected: %s", err)
+				}
+			}
+		}
+	}
+}
+
+func (w *ConfigWatcher) stat() []fileStamp {
+	stamps := make([]fileStamp, len(w.paths))
+	for i, path := range w.paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[i] = fileStamp{mod: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+func (w *ConfigWatcher) changed() bool {
+	stamps := w.stat()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed := false
+	for i := range stamps {
+		if stamps[i] != w.stamps[i] {
+			changed = true
+		}
+	}
+	w.stamps = stamps
+	return changed
+}
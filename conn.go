@@ -0,0 +1,112 @@
+package net
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ConnHook observes connection state transitions of the http.Server
+// serving s. Hooks run synchronously on the connection goroutine, closing
+// c from a hook drops the connection.
+type ConnHook func(c net.Conn, state http.ConnState)
+
+// ConnStats connection counters, Total counts transitions into each state
+// since the server started and Current the connections in each state now
+type ConnStats struct {
+	Total   map[string]uint64 `json:"total"`
+	Current map[string]int    `json:"current"`
+}
+
+type connTracker struct {
+	mu     sync.Mutex
+	hooks  []ConnHook
+	total  map[http.ConnState]uint64
+	states map[net.Conn]http.ConnState
+}
+
+// observe record the transition and run the hooks, the http.Server
+// ConnState callback
+func (t *connTracker) observe(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	if t.total == nil {
+		t.total = make(map[http.ConnState]uint64)
+		t.states = make(map[net.Conn]http.ConnState)
+	}
+	t.total[state]++
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(t.states, c)
+	default:
+		t.states[c] = state
+	}
+	hooks := t.hooks
+	t.mu.Unlock()
+	for _, hook := range hooks {
+		hook(c, state)
+	}
+}
+
+// OnConnState register hook called on every connection state transition
+func (s *Server) OnConnState(hook ConnHook) {
+	s.conns.mu.Lock()
+	defer s.conns.mu.Unlock()
+	s.conns.hooks = append(s.conns.hooks, hook)
+}
+
+// ConnStats snapshot of the connection counters
+func (s *Server) ConnStats() ConnStats {
+	states := []http.ConnState{
+		http.StateNew, http.StateActive, http.StateIdle,
+		http.StateHijacked, http.StateClosed,
+	}
+	ret := ConnStats{
+		Total:   make(map[string]uint64, len(states)),
+		Current: make(map[string]int, 3),
+	}
+	s.conns.mu.Lock()
+	defer s.conns.mu.Unlock()
+	for _, state := range states {
+		ret.Total[state.String()] = s.conns.total[state]
+	}
+	for _, state := range states[:3] {
+		ret.Current[state.String()] = 0
+	}
+	for _, state := range s.conns.states {
+		ret.Current[state.String()]++
+	}
+	return ret
+}
+
+// EnableConnStats mount an endpoint reporting the connection counters at
+// path
+func (s *Server) EnableConnStats(path string, auth EndPointDecorator) {
+	s.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, s.ConnStats())
+		},
+	))
+}
+
+// MaxConnRequests keep-alive policy closing connections once they served
+// n requests, so long lived clients get rebalanced across instances
+func MaxConnRequests(n int) ConnHook {
+	var mu sync.Mutex
+	served := make(map[net.Conn]int)
+	return func(c net.Conn, state http.ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch state {
+		case http.StateActive:
+			served[c]++
+		case http.StateIdle:
+			if served[c] >= n {
+				delete(served, c)
+				c.Close()
+			}
+		case http.StateClosed, http.StateHijacked:
+			delete(served, c)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package net
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectDialTimeout default timeout dialing CONNECT destinations
+const ConnectDialTimeout = 10 * time.Second
+
+// connectRule allowed destination, host is an exact name, a *.suffix
+// wildcard or a cidr; port "*" allows any port
+type connectRule struct {
+	host string
+	cidr *net.IPNet
+	port string
+}
+
+func (c connectRule) matchHost(host string) bool {
+	if c.cidr != nil || c.host == "*" {
+		return c.host == "*"
+	}
+	if strings.HasPrefix(c.host, "*.") {
+		return strings.HasSuffix(host, c.host[1:])
+	}
+	return strings.EqualFold(host, c.host)
+}
+
+func (c connectRule) matchPort(port string) bool {
+	return c.port == "*" || c.port == port
+}
+
+// ConnectProxy forward proxy tunneling CONNECT requests to allowlisted
+// destinations, for controlled egress of internal tooling
+type ConnectProxy struct {
+	rules []connectRule
+	// Authorize checks the Proxy-Authorization of a request, nil allows
+	// every client
+	Authorize func(r *http.Request) bool
+	// DialTimeout dialing the destination
+	DialTimeout time.Duration
+	// IdleTimeout closes tunnels without traffic for this long, 0 disables
+	IdleTimeout time.Duration
+	Resolver    *net.Resolver
+}
+
+// NewConnectProxy proxy allowing destinations formatted host:port, host is
+// an exact name, a *.suffix wildcard, * or a cidr matched against the
+// resolved addresses; port is a number or *
+func NewConnectProxy(allow ...string) (*ConnectProxy, error) {
+	p := &ConnectProxy{DialTimeout: ConnectDialTimeout, Resolver: net.DefaultResolver}
+	for _, a := range allow {
+		host, port, err := net.SplitHostPort(a)
+		if err != nil {
+			return nil, fmt.Errorf("connect rule %q: %s", a, err)
+		}
+		rule := connectRule{host: strings.ToLower(host), port: port}
+		if strings.Contains(host, "/") {
+			if _, rule.cidr, err = net.ParseCIDR(host); err != nil {
+				return nil, fmt.Errorf("connect rule %q: %s", a, err)
+			}
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// BasicProxyAuth Authorize func accepting user and password as proxy basic
+// auth
+func BasicProxyAuth(user, password string) func(r *http.Request) bool {
+	want := []byte("Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+	return func(r *http.Request) bool {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("Proxy-Authorization")), want) == 1
+	}
+}
+
+// Handler serve CONNECT requests, everything else goes to next
+func (p *ConnectProxy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP tunnel a CONNECT request
+func (p *ConnectProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.Authorize != nil && !p.Authorize(r) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+		http.Error(w, http.StatusText(http.StatusProxyAuthRequired), http.StatusProxyAuthRequired)
+		return
+	}
+	addr, err := p.destination(r.Context(), r.Host)
+	if err != nil {
+		log.Printf("connect %s: %s", r.Host, err)
+		forbidden(w)
+		return
+	}
+	dialer := net.Dialer{Timeout: p.DialTimeout}
+	upstream, err := dialer.DialContext(r.Context(), "tcp", addr)
+	if err != nil {
+		log.Printf("connect %s: %s", r.Host, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connect unsupported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		log.Printf("connect %s: %s", r.Host, err)
+		return
+	}
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+	// bytes the client sent ahead of the response
+	if n := buf.Reader.Buffered(); n > 0 {
+		ahead, _ := buf.Reader.Peek(n)
+		upstream.Write(ahead)
+	}
+	p.pipe(client, upstream)
+}
+
+// destination check the requested authority against the allowlist and
+// return the address to dial, names are resolved once so cidr rules cannot
+// be bypassed by dns rebinding
+func (p *ConnectProxy) destination(ctx context.Context, authority string) (string, error) {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		return "", err
+	}
+	host = strings.ToLower(host)
+	var byName []connectRule
+	var byNet []connectRule
+	for _, rule := range p.rules {
+		if !rule.matchPort(port) {
+			continue
+		}
+		if rule.cidr != nil {
+			byNet = append(byNet, rule)
+		} else if rule.matchHost(host) {
+			byName = append(byName, rule)
+		}
+	}
+	if len(byName) == 0 && len(byNet) == 0 {
+		return "", fmt.Errorf("destination not allowed")
+	}
+	ips, err := p.Resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if len(byName) > 0 {
+			return net.JoinHostPort(ip.String(), port), nil
+		}
+		for _, rule := range byNet {
+			if rule.cidr.Contains(ip.IP) {
+				return net.JoinHostPort(ip.String(), port), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("destination not allowed")
+}
+
+// pipe copy both directions until either side closes or the tunnel has
+// been idle for IdleTimeout
+func (p *ConnectProxy) pipe(a, b net.Conn) {
+	var last int64
+	touch := func() { atomic.StoreInt64(&last, time.Now().UnixNano()) }
+	touch()
+	var wg sync.WaitGroup
+	forward := func(dst, src net.Conn) {
+		defer wg.Done()
+		buf := make([]byte, 32*1024)
+		for {
+			if p.IdleTimeout > 0 {
+				src.SetReadDeadline(time.Now().Add(p.IdleTimeout))
+			}
+			n, err := src.Read(buf)
+			if n > 0 {
+				touch()
+				if _, werr := dst.Write(buf[:n]); werr != nil {
+					break
+				}
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() &&
+				time.Since(time.Unix(0, atomic.LoadInt64(&last))) < p.IdleTimeout {
+				// the other direction is active
+				continue
+			}
+			if err != nil {
+				break
+			}
+		}
+		// unblock the other direction
+		a.Close()
+		b.Close()
+	}
+	wg.Add(2)
+	go forward(a, b)
+	go forward(b, a)
+	wg.Wait()
+}
@@ -0,0 +1,243 @@
+package net
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// corsCacheSize most origins whose preflight answers are cached
+const corsCacheSize = 1024
+
+// CORSConfig origins, methods and headers a CORS layer allows
+type CORSConfig struct {
+	// AllowedOrigins exact origins, "https://*.example.com" for subdomains
+	// over https, "*.example.com" for subdomains over any scheme or "*" for
+	// any origin
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowedMethods []string
+	// AllowedHeaders request headers, "*" for any
+	AllowedHeaders []string
+	// ExposedHeaders response headers readable by scripts
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and auth, the origin is then echoed
+	// instead of "*"
+	AllowCredentials bool
+	// MaxAge browsers may cache a preflight for, 0 leaves it to them
+	MaxAge time.Duration
+}
+
+// CORS answers cross origin requests from a CORSConfig. Allowed sets and
+// header values are computed once, preflight answers are cached per origin.
+type CORS struct {
+	anyOrigin   bool
+	origins     map[string]struct{}
+	suffixes    []corsSuffix
+	methods     map[string]struct{}
+	anyHeader   bool
+	headers     map[string]struct{}
+	credentials bool
+
+	allowMethods []string
+	allowHeaders []string
+	expose       []string
+	maxAge       []string
+
+	mu        sync.RWMutex
+	preflight map[string]http.Header
+}
+
+// NewCORS cors layer for config
+func NewCORS(config CORSConfig) *CORS {
+	c := &CORS{
+		origins:     make(map[string]struct{}),
+		methods:     make(map[string]struct{}),
+		headers:     make(map[string]struct{}),
+		credentials: config.AllowCredentials,
+		preflight:   make(map[string]http.Header),
+	}
+	for _, o := range config.AllowedOrigins {
+		switch {
+		case o == "*":
+			c.anyOrigin = true
+		case strings.Contains(o, "*."):
+			i := strings.Index(o, "*.")
+			c.suffixes = append(c.suffixes, corsSuffix{
+				scheme: strings.ToLower(o[:i]),
+				domain: strings.ToLower(o[i+1:]),
+			})
+		default:
+			c.origins[strings.ToLower(o)] = struct{}{}
+		}
+	}
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{
+			http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodPatch, http.MethodDelete,
+		}
+	}
+	upper := make([]string, len(methods))
+	for i, m := range methods {
+		upper[i] = strings.ToUpper(m)
+		c.methods[upper[i]] = struct{}{}
+	}
+	c.allowMethods = []string{strings.Join(upper, ", ")}
+	var headers []string
+	for _, h := range config.AllowedHeaders {
+		if h == "*" {
+			c.anyHeader = true
+			continue
+		}
+		h = strings.ToLower(h)
+		c.headers[h] = struct{}{}
+		headers = append(headers, h)
+	}
+	if len(headers) > 0 {
+		c.allowHeaders = []string{strings.Join(headers, ", ")}
+	}
+	if len(config.ExposedHeaders) > 0 {
+		c.expose = []string{strings.Join(config.ExposedHeaders, ", ")}
+	}
+	if config.MaxAge > 0 {
+		c.maxAge = []string{strconv.Itoa(int(config.MaxAge / time.Second))}
+	}
+	return c
+}
+
+// permissiveCORS answers any origin, used for Server.PermissiveCORS and
+// CorsHandler
+var permissiveCORS = NewCORS(CORSConfig{
+	AllowedOrigins: []string{"*"},
+	AllowedHeaders: []string{"authorization", "content-type"},
+})
+
+// WithCORS answer cross origin requests as config allows
+func WithCORS(config CORSConfig) Option {
+	return func(s *Server) {
+		s.cors = NewCORS(config)
+	}
+}
+
+// Allowed reports whether origin may make cross origin requests
+func (c *CORS) Allowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := c.origins[origin]; ok {
+		return true
+	}
+	for _, suffix := range c.suffixes {
+		if strings.HasPrefix(origin, suffix.scheme) && strings.HasSuffix(origin, suffix.domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsSuffix subdomain origin pattern, the scheme is empty for any
+type corsSuffix struct {
+	scheme string
+	domain string
+}
+
+// allowOrigin value of Access-Control-Allow-Origin for an allowed origin
+func (c *CORS) allowOrigin(origin string) string {
+	if c.anyOrigin && !c.credentials {
+		return "*"
+	}
+	return origin
+}
+
+// Handler answer preflights and add cors headers to responses of next
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, r, next)
+	})
+}
+
+func (c *CORS) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	origin := r.Header.Get("Origin")
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		c.answerPreflight(w, r, origin)
+		return
+	}
+	if c.Allowed(origin) {
+		h["Access-Control-Allow-Origin"] = []string{c.allowOrigin(origin)}
+		if c.credentials {
+			h["Access-Control-Allow-Credentials"] = []string{"true"}
+		}
+		if c.expose != nil {
+			h["Access-Control-Expose-Headers"] = c.expose
+		}
+	}
+	next.ServeHTTP(w, r)
+}
+
+func (c *CORS) answerPreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if _, ok := c.methods[method]; !ok || !c.Allowed(origin) {
+		forbidden(w)
+		return
+	}
+	requested := r.Header.Get("Access-Control-Request-Headers")
+	if !c.anyHeader {
+		for _, name := range strings.Split(requested, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := c.headers[name]; !ok && name != "" {
+				forbidden(w)
+				return
+			}
+		}
+	}
+	for k, v := range c.preflightHeaders(origin) {
+		h[k] = v
+	}
+	if c.anyHeader && requested != "" {
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// preflightHeaders cached preflight answer for origin, the header values
+// are shared and must not be modified
+func (c *CORS) preflightHeaders(origin string) http.Header {
+	key := c.allowOrigin(origin)
+	c.mu.RLock()
+	h, ok := c.preflight[key]
+	c.mu.RUnlock()
+	if ok {
+		return h
+	}
+	h = http.Header{
+		"Access-Control-Allow-Origin":  {key},
+		"Access-Control-Allow-Methods": c.allowMethods,
+	}
+	if c.allowHeaders != nil {
+		h["Access-Control-Allow-Headers"] = c.allowHeaders
+	}
+	if c.credentials {
+		h["Access-Control-Allow-Credentials"] = []string{"true"}
+	}
+	if c.maxAge != nil {
+		h["Access-Control-Max-Age"] = c.maxAge
+	}
+	c.mu.Lock()
+	if len(c.preflight) < corsCacheSize {
+		c.preflight[key] = h
+	}
+	c.mu.Unlock()
+	return h
+}
@@ -0,0 +1,419 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule when a job runs next
+type Schedule interface {
+	// Next first activation after t
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parse a five field cron spec, minute hour day-of-month
+// month day-of-week with *, lists, ranges and steps, or one of @yearly,
+// @monthly, @weekly, @daily, @hourly and @every <duration>
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("cron: %s", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("cron: interval %s below a second", d)
+		}
+		return every(d), nil
+	}
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: %q needs 5 fields", spec)
+	}
+	var c cronSchedule
+	var err error
+	bounds := [5][2]uint{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := [5]*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, f := range fields {
+		if *sets[i], err = cronField(f, bounds[i][0], bounds[i][1]); err != nil {
+			return nil, err
+		}
+	}
+	// sunday is 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return c, nil
+}
+
+func cronField(field string, min, max uint) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("cron: bad step in %q", field)
+			}
+			step = uint(n)
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			n, err := strconv.ParseUint(bounds[0], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("cron: bad value in %q", field)
+			}
+			lo, hi = uint(n), uint(n)
+			if len(bounds) == 2 {
+				if n, err = strconv.ParseUint(bounds[1], 10, 8); err != nil {
+					return 0, fmt.Errorf("cron: bad range in %q", field)
+				}
+				hi = uint(n)
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron: %q out of range %d-%d", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e)).Truncate(time.Second)
+}
+
+// cronSchedule bit sets of the matching values per field
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func (c cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// a spec matching nothing, like february 30, gives up after 5 years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = nextHour(t)
+		case c.minute&(1<<uint(t.Minute())) == 0 && t.Minute() == 59:
+			t = nextHour(t)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// nextHour start of the hour after t on the wall clock of its location,
+// whole hours of absolute time are not whole hours in half hour zones.
+// When clocks go back the repeated hour is skipped, so a job runs once.
+func nextHour(t time.Time) time.Time {
+	n := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+	if !n.After(t) {
+		// ambiguous wall times may resolve to the earlier offset
+		n = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+	}
+	return n
+}
+
+// dayMatches either day field matches when both are restricted, like cron
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// JobStatus state and counters of a scheduled job
+type JobStatus struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`
+	Running   bool      `json:"running"`
+	Runs      uint64    `json:"runs"`
+	Failures  uint64    `json:"failures"`
+	Skipped   uint64    `json:"skipped"`
+	LastRun   time.Time `json:"last_run"`
+	LastError string    `json:"last_error,omitempty"`
+	// LastDuration how long the last run took
+	LastDuration time.Duration `json:"last_duration"`
+	Next         time.Time     `json:"next"`
+}
+
+type cronJob struct {
+	spec     string
+	schedule Schedule
+	run      func(ctx context.Context) error
+	status   JobStatus
+}
+
+// Scheduler runs jobs on cron schedules inside the server process. Jobs
+// start once the server listens and are cancelled on shutdown, a job still
+// running when its next activation comes is skipped for that activation.
+type Scheduler struct {
+	// Clock drives the schedules, defaults to the server clock
+	Clock Clock
+	// Location schedules are evaluated in, defaults to local time
+	Location *time.Location
+
+	mu      sync.Mutex
+	jobs    map[string]*cronJob
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	server  *Server
+}
+
+// NewScheduler scheduler started and stopped with s
+func NewScheduler(s *Server) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	sc := &Scheduler{
+		Location: time.Local,
+		jobs:     make(map[string]*cronJob),
+		ctx:      ctx,
+		cancel:   cancel,
+		server:   s,
+	}
+	if s != nil {
+		sc.Clock = s.clock
+		s.OnStart(sc.Start)
+		s.OnShutdown(sc.Stop)
+	}
+	if sc.Clock == nil {
+		sc.Clock = SystemClock
+	}
+	return sc
+}
+
+// Add schedule fn as name, see ParseSchedule for spec. Jobs added after
+// Start are scheduled right away.
+func (sc *Scheduler) Add(name, spec string, fn func(ctx context.Context) error) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, ok := sc.jobs[name]; ok {
+		return fmt.Errorf("cron: job %s exists", name)
+	}
+	j := &cronJob{
+		spec:     spec,
+		schedule: schedule,
+		run:      fn,
+		status:   JobStatus{Name: name, Schedule: spec},
+	}
+	sc.jobs[name] = j
+	if sc.started {
+		sc.loop(j)
+	}
+	return nil
+}
+
+// Start run the schedules, NewScheduler starts them once the server listens
+func (sc *Scheduler) Start() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.started || sc.ctx.Err() != nil {
+		return
+	}
+	sc.started = true
+	for _, j := range sc.jobs {
+		sc.loop(j)
+	}
+}
+
+// Stop cancel running jobs and wait for them until ctx is done
+func (sc *Scheduler) Stop(ctx context.Context) error {
+	sc.mu.Lock()
+	sc.cancel()
+	sc.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		sc.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler: %s", ctx.Err())
+	}
+}
+
+// loop wait for the activations of j, called with sc.mu held
+func (sc *Scheduler) loop(j *cronJob) {
+	sc.wg.Add(1)
+	go func() {
+		defer sc.wg.Done()
+		for {
+			now := sc.Clock.Now().In(sc.Location)
+			next := j.schedule.Next(now)
+			if next.IsZero() {
+				log.Printf("cron: job %s never runs again", j.status.Name)
+				return
+			}
+			sc.mu.Lock()
+			j.status.Next = next
+			sc.mu.Unlock()
+			select {
+			case <-sc.Clock.After(next.Sub(now)):
+			case <-sc.ctx.Done():
+				return
+			}
+			sc.fire(j)
+		}
+	}()
+}
+
+func (sc *Scheduler) fire(j *cronJob) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.ctx.Err() != nil {
+		return
+	}
+	if j.status.Running {
+		j.status.Skipped++
+		log.Printf("cron: job %s still running, skipped", j.status.Name)
+		return
+	}
+	j.status.Running = true
+	sc.wg.Add(1)
+	go sc.run(j)
+}
+
+func (sc *Scheduler) run(j *cronJob) {
+	defer sc.wg.Done()
+	begin := sc.Clock.Now()
+	err := sc.call(j)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastRun = begin
+	j.status.LastDuration = sc.Clock.Now().Sub(begin)
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+		log.Printf("cron: job %s: %s", j.status.Name, err)
+	}
+}
+
+func (sc *Scheduler) call(j *cronJob) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %+v", v)
+			if sc.server != nil {
+				sc.server.reportTaskPanic(v)
+			}
+		}
+	}()
+	return j.run(sc.ctx)
+}
+
+// Jobs status of every job ordered by name
+func (sc *Scheduler) Jobs() []JobStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	ret := make([]JobStatus, 0, len(sc.jobs))
+	for _, j := range sc.jobs {
+		ret = append(ret, j.status)
+	}
+	sort.Slice(ret, func(i, k int) bool { return ret[i].Name < ret[k].Name })
+	return ret
+}
+
+// WriteTo write per job metrics in the prometheus text format
+func (sc *Scheduler) WriteTo(w *bufio.Writer) {
+	jobs := sc.Jobs()
+	metric := func(name, kind, help string, value func(JobStatus) string) {
+		fmt.Fprintf(w, "# HELP cron_job_%s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE cron_job_%s %s\n", name, kind)
+		for _, j := range jobs {
+			fmt.Fprintf(w, "cron_job_%s{job=\"%s\"} %s\n", name, escapeLabel(j.Name), value(j))
+		}
+	}
+	metric("runs_total", "counter", "Finished job runs.", func(j JobStatus) string {
+		return strconv.FormatUint(j.Runs, 10)
+	})
+	metric("failures_total", "counter", "Job runs returning an error.", func(j JobStatus) string {
+		return strconv.FormatUint(j.Failures, 10)
+	})
+	metric("skipped_total", "counter", "Activations skipped while the job was still running.", func(j JobStatus) string {
+		return strconv.FormatUint(j.Skipped, 10)
+	})
+	metric("running", "gauge", "Whether the job is running.", func(j JobStatus) string {
+		if j.Running {
+			return "1"
+		}
+		return "0"
+	})
+	metric("last_duration_seconds", "gauge", "Duration of the last run.", func(j JobStatus) string {
+		return formatFloat(j.LastDuration.Seconds())
+	})
+	metric("last_run_timestamp_seconds", "gauge", "Start of the last run.", func(j JobStatus) string {
+		if j.LastRun.IsZero() {
+			return "0"
+		}
+		return strconv.FormatInt(j.LastRun.Unix(), 10)
+	})
+}
+
+// ServeHTTP serve job metrics in the prometheus text format
+func (sc *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	sc.WriteTo(bw)
+}
+
+// EnableScheduler mount an endpoint listing the jobs of sc with their
+// status
+func (s *Server) EnableScheduler(path string, sc *Scheduler, auth EndPointDecorator) {
+	s.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, sc.Jobs())
+		},
+	))
+}
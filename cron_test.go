@@ -0,0 +1,75 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	cases := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "half hour zone",
+			spec: "0 11 * * *",
+			from: time.Date(2024, 3, 10, 9, 0, 0, 0, kolkata),
+			want: time.Date(2024, 3, 10, 11, 0, 0, 0, kolkata),
+		},
+		{
+			name: "half hour zone every hour",
+			spec: "15 * * * *",
+			from: time.Date(2024, 3, 10, 9, 20, 0, 0, kolkata),
+			want: time.Date(2024, 3, 10, 10, 15, 0, 0, kolkata),
+		},
+		{
+			name: "after spring forward",
+			spec: "0 3 * * *",
+			from: time.Date(2024, 3, 10, 0, 0, 0, 0, newYork),
+			want: time.Date(2024, 3, 10, 3, 0, 0, 0, newYork),
+		},
+		{
+			name: "skipped by spring forward",
+			spec: "30 2 * * *",
+			from: time.Date(2024, 3, 10, 0, 0, 0, 0, newYork),
+			want: time.Date(2024, 3, 11, 2, 30, 0, 0, newYork),
+		},
+		{
+			name: "before fall back",
+			spec: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 0, 0, 0, 0, newYork),
+			want: time.Date(2024, 11, 3, 1, 30, 0, 0, newYork),
+		},
+		{
+			name: "repeated hour runs once",
+			spec: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 1, 30, 0, 0, newYork),
+			want: time.Date(2024, 11, 4, 1, 30, 0, 0, newYork),
+		},
+		{
+			name: "after fall back",
+			spec: "0 2 * * *",
+			from: time.Date(2024, 11, 3, 1, 10, 0, 0, newYork),
+			want: time.Date(2024, 11, 3, 2, 0, 0, 0, newYork),
+		},
+	}
+	for _, c := range cases {
+		sched, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if got := sched.Next(c.from); !got.Equal(c.want) {
+			t.Errorf("%s: Next(%s) = %s, want %s", c.name, c.from, got, c.want)
+		}
+	}
+}
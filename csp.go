@@ -0,0 +1,52 @@
+package net
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// StrictCSP nonce based policy without unsafe-inline, {nonce} is replaced
+// by the request's nonce
+const StrictCSP = "default-src 'self'; script-src 'nonce-{nonce}' 'strict-dynamic'; " +
+	"style-src 'self' 'nonce-{nonce}'; object-src 'none'; base-uri 'none'; frame-ancestors 'none'"
+
+// CSP generate a nonce per request, available to templates through
+// CSPNonce, and send policy with {nonce} replaced as Content-Security-Policy
+func CSP(policy string) EndPointDecorator {
+	return csp("Content-Security-Policy", policy)
+}
+
+// CSPReportOnly CSP sending Content-Security-Policy-Report-Only, to try a
+// policy without enforcing it
+func CSPReportOnly(policy string) EndPointDecorator {
+	return csp("Content-Security-Policy-Report-Only", policy)
+}
+
+func csp(header, policy string) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			nonce := newCSPNonce()
+			w.Header().Set(header, strings.Replace(policy, "{nonce}", nonce, -1))
+			ctx = context.WithValue(ctx, nonceKey, nonce)
+			e(ctx, w, r.WithContext(ctx))
+		}
+	}
+}
+
+// CSPNonce nonce of the request for script and style tags, empty outside
+// CSP
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey).(string)
+	return nonce
+}
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,50 @@
+package net
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// RequestLogger inject a logger tagged with request id, method, route and
+// authenticated user, place it after auth decorators so the user is known
+func RequestLogger(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ctx = context.WithValue(ctx, loggerKey, newRequestLogger(ctx, r.Method))
+		e(ctx, w, r.WithContext(ctx))
+	}
+}
+
+// LoggerFrom logger injected by RequestLogger, without one a logger is
+// tagged from what the context carries
+func LoggerFrom(ctx context.Context) *log.Logger {
+	if l, ok := ctx.Value(loggerKey).(*log.Logger); ok {
+		return l
+	}
+	return newRequestLogger(ctx, Route(ctx).Method)
+}
+
+func newRequestLogger(ctx context.Context, method string) *log.Logger {
+	var tags []string
+	if id := RequestID(ctx); id != "" {
+		tags = append(tags, "request_id="+id)
+	}
+	if method != "" {
+		tags = append(tags, "method="+method)
+	}
+	if route := Route(ctx).Path; route != "" {
+		tags = append(tags, "route="+route)
+	}
+	if id, ok := IdentityFrom(ctx); ok {
+		tags = append(tags, "user="+id.Subject)
+	}
+	if tenant := Tenant(ctx); tenant != "" {
+		tags = append(tags, "tenant="+tenant)
+	}
+	prefix := ""
+	if len(tags) > 0 {
+		prefix = "[" + strings.Join(tags, " ") + "] "
+	}
+	return log.New(log.Writer(), prefix, log.Flags()|log.Lmsgprefix)
+}
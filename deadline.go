@@ -0,0 +1,104 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// request timeout headers
+const (
+	TimeoutHeader     = "X-Request-Timeout"
+	GRPCTimeoutHeader = "Grpc-Timeout"
+)
+
+// ClientDeadline tightens the request context deadline to the budget the
+// caller sent in X-Request-Timeout or Grpc-Timeout, never exceeding max.
+// Without a header the max applies, a max of 0 means no server cap.
+func ClientDeadline(max time.Duration) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			d, ok, err := RequestTimeout(r)
+			if err != nil {
+				BadRequest(w, err)
+				return
+			}
+			if !ok || (max > 0 && d > max) {
+				d = max
+			}
+			if d <= 0 {
+				e(ctx, w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			e(ctx, w, r.WithContext(ctx))
+		}
+	}
+}
+
+// RequestTimeout client supplied timeout, X-Request-Timeout takes a go
+// duration ("1.5s") or plain milliseconds, Grpc-Timeout the grpc wire format
+func RequestTimeout(r *http.Request) (time.Duration, bool, error) {
+	if v := r.Header.Get(TimeoutHeader); v != "" {
+		d, err := parseTimeout(v)
+		return d, err == nil, err
+	}
+	if v := r.Header.Get(GRPCTimeoutHeader); v != "" {
+		d, err := parseGRPCTimeout(v)
+		return d, err == nil, err
+	}
+	return 0, false, nil
+}
+
+func parseTimeout(v string) (time.Duration, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if ms <= 0 {
+			return 0, fmt.Errorf("invalid %s: %s", TimeoutHeader, v)
+		}
+		return scaleTimeout(ms, time.Millisecond), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", TimeoutHeader, v)
+	}
+	return d, nil
+}
+
+var grpcUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("invalid %s: %s", GRPCTimeoutHeader, v)
+	}
+	unit, ok := grpcUnits[v[len(v)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid %s unit: %s", GRPCTimeoutHeader, v)
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", GRPCTimeoutHeader, v)
+	}
+	return scaleTimeout(n, unit), nil
+}
+
+// scaleTimeout n units, clamped to the longest duration instead of
+// overflowing so a huge timeout still gets capped by ClientDeadline
+func scaleTimeout(n int64, unit time.Duration) time.Duration {
+	if n > math.MaxInt64/int64(unit) {
+		return math.MaxInt64
+	}
+	return time.Duration(n) * unit
+}
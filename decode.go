@@ -0,0 +1,69 @@
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// MaxJSONDepth deepest nesting of arrays and objects DecodeJSON accepts
+const MaxJSONDepth = 100
+
+// json body errors
+var (
+	ErrBodyTooLarge = fmt.Errorf("body too large")
+	ErrInvalidUTF8  = fmt.Errorf("body is not valid utf-8")
+	ErrJSONTooDeep  = fmt.Errorf("json nested deeper than %d", MaxJSONDepth)
+)
+
+// DecodeJSON decode data into v, rejecting bodies over READLIMIT, invalid
+// utf-8 (encoding/json would silently replace it) and nesting over
+// MaxJSONDepth before decoding. It is the input side of DecodeBody and
+// takes plain bytes so it can be fuzzed directly.
+func DecodeJSON(data []byte, v interface{}) error {
+	if len(data) > READLIMIT {
+		return ErrBodyTooLarge
+	}
+	return decodeJSON(data, v)
+}
+
+// decodeJSON DecodeJSON after the size check
+func decodeJSON(data []byte, v interface{}) error {
+	if !utf8.Valid(data) {
+		return ErrInvalidUTF8
+	}
+	if jsonDepth(data) > MaxJSONDepth {
+		return ErrJSONTooDeep
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jsonDepth deepest nesting in data, ignoring brackets inside strings,
+// malformed input is left to the decoder
+func jsonDepth(data []byte) int {
+	depth, max := 0, 0
+	str, esc := false, false
+	for _, c := range data {
+		switch {
+		case esc:
+			esc = false
+		case str:
+			switch c {
+			case '\\':
+				esc = true
+			case '"':
+				str = false
+			}
+		case c == '"':
+			str = true
+		case c == '[' || c == '{':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return max
+}
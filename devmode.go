@@ -0,0 +1,58 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"runtime/debug"
+)
+
+// DebugInfo error details added to error responses in dev mode
+type DebugInfo struct {
+	Error     string            `json:"error"`
+	Stack     string            `json:"stack"`
+	Route     string            `json:"route,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Request   string            `json:"request,omitempty"`
+}
+
+// debugRedacted headers left out of request dumps
+var debugRedacted = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// debugInfo details of err for the request served by sw, nil unless the
+// server is in dev mode and does not hide errors
+func debugInfo(w http.ResponseWriter, err error) *DebugInfo {
+	sw := serverWriterFrom(w)
+	if sw == nil || !sw.server.DevMode || sw.server.HideErrors {
+		return nil
+	}
+	info := &DebugInfo{
+		Error: err.Error(),
+		Stack: string(debug.Stack()),
+	}
+	r := sw.request
+	if r == nil {
+		return info
+	}
+	ctx := r.Context()
+	if route := Route(ctx); route.Path != "" {
+		info.Route = route.Method + " " + route.Path
+	}
+	if params, err := Params(ctx); err == nil && len(params) > 0 {
+		info.Params = make(map[string]string, len(params))
+		for _, p := range params {
+			info.Params[p.Key] = p.Value
+		}
+	}
+	info.RequestID = RequestID(ctx)
+	dump := r.Clone(ctx)
+	for _, h := range debugRedacted {
+		if dump.Header.Get(h) != "" {
+			dump.Header.Set(h, "[redacted]")
+		}
+	}
+	if b, err := httputil.DumpRequest(dump, false); err == nil {
+		info.Request = string(b)
+	}
+	return info
+}
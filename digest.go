@@ -0,0 +1,123 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// digest errors
+var (
+	ErrDigestMissing  = fmt.Errorf("body digest required")
+	ErrDigestMismatch = fmt.Errorf("body digest mismatch")
+)
+
+// digestAlgorithms hashes digests are checked with, keyed by lower case
+// name
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+type bodyDigest struct {
+	alg string
+	sum []byte
+}
+
+// bodyDigests digests the request claims for its body, from Content-MD5,
+// Digest (RFC 3230) and Content-Digest (RFC 9530). Unknown algorithms are
+// skipped, malformed values fail.
+func bodyDigests(h http.Header) ([]bodyDigest, error) {
+	var ret []bodyDigest
+	add := func(alg, value string) error {
+		alg = strings.ToLower(strings.TrimSpace(alg))
+		if _, ok := digestAlgorithms[alg]; !ok {
+			return nil
+		}
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("malformed %s digest", alg)
+		}
+		ret = append(ret, bodyDigest{alg: alg, sum: sum})
+		return nil
+	}
+	if v := h.Get("Content-Md5"); v != "" {
+		if err := add("md5", v); err != nil {
+			return nil, err
+		}
+	}
+	for _, part := range strings.Split(h.Get("Digest"), ",") {
+		if i := strings.IndexByte(part, '='); i > 0 {
+			if err := add(part[:i], part[i+1:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, part := range strings.Split(h.Get("Content-Digest"), ",") {
+		if i := strings.IndexByte(part, '='); i > 0 {
+			v := strings.TrimSpace(part[i+1:])
+			if len(v) < 2 || v[0] != ':' || v[len(v)-1] != ':' {
+				return nil, fmt.Errorf("malformed content digest")
+			}
+			if err := add(part[:i], v[1:len(v)-1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ret, nil
+}
+
+// VerifyDigest EndPointDecorator checking the body against the digests in
+// Content-MD5, Digest and Content-Digest, every supported digest has to
+// match. Requests without a supported digest are rejected when required.
+// The body is read within the route's read limit and handed on to the
+// endpoint.
+func VerifyDigest(required bool) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			digests, err := bodyDigests(r.Header)
+			if err != nil {
+				BadRequest(w, err)
+				return
+			}
+			if len(digests) == 0 {
+				if required {
+					w.Header().Set("Want-Digest", "SHA-256")
+					BadRequest(w, ErrDigestMissing)
+					return
+				}
+				e(ctx, w, r)
+				return
+			}
+			body, err := readBody(r)
+			if err == ErrBodyTooLarge {
+				SizeResponse(w, err)
+				return
+			}
+			if err != nil {
+				BadRequest(w, err)
+				return
+			}
+			for _, d := range digests {
+				h := digestAlgorithms[d.alg]()
+				h.Write(body)
+				if subtle.ConstantTimeCompare(h.Sum(nil), d.sum) != 1 {
+					BadRequest(w, ErrDigestMismatch)
+					return
+				}
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			e(ctx, w, r)
+		}
+	}
+}
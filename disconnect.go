@@ -0,0 +1,63 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// StatusClientClosed recorded for requests whose client went away before
+// the response was done, nginx's 499
+const StatusClientClosed = 499
+
+// ClientGone reports whether the client of the request in ctx went away,
+// deadlines running out do not count
+func ClientGone(ctx context.Context) bool {
+	return ctx.Err() == context.Canceled
+}
+
+// AbortOnDisconnect stop the endpoint when the client went away: it
+// panics with http.ErrAbortHandler, which the server swallows without a
+// response, a report or a stack trace. Call it between steps of long
+// running work.
+func AbortOnDisconnect(ctx context.Context) {
+	if ClientGone(ctx) {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// requestStatus status to record for a finished request, recovered is the
+// panic value the endpoint ended with. Requests aborted or failed because
+// the client left are recorded as StatusClientClosed rather than as server
+// errors.
+func requestStatus(ctx context.Context, rec *responseRecorder, recovered interface{}) int {
+	if recovered == http.ErrAbortHandler {
+		return StatusClientClosed
+	}
+	if recovered != nil {
+		return http.StatusInternalServerError
+	}
+	status := rec.Status()
+	if ClientGone(ctx) && (rec.status == 0 || status >= http.StatusInternalServerError) {
+		return StatusClientClosed
+	}
+	return status
+}
+
+// clientCanceled reports whether err is the cancellation of the request
+// being answered on w
+func clientCanceled(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, context.Canceled) {
+		return false
+	}
+	sw := serverWriterFrom(w)
+	return sw != nil && ClientGone(sw.request.Context())
+}
+
+// clientClosed answer a request whose client left, nobody reads the
+// response but recorders see the status
+func clientClosed(w http.ResponseWriter, err error) {
+	log.Printf("client canceled: %s", err)
+	w.WriteHeader(StatusClientClosed)
+}
@@ -0,0 +1,326 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RangeStore BlobStore able to read metadata and byte ranges without
+// fetching whole blobs, ServeBlob falls back to Get for other stores
+type RangeStore interface {
+	BlobStore
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// byteRange offset and length of a requested range
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// errUnsatisfiable no requested range overlaps the content
+var errUnsatisfiable = fmt.Errorf("range not satisfiable")
+
+// MaxRanges ranges served in one response after merging, requests for more
+// get the whole content
+const MaxRanges = 16
+
+// parseRanges parse a Range header for content of size bytes, nil when the
+// header is empty or should be ignored. Overlapping and adjacent ranges are
+// merged.
+func parseRanges(header string, size int64) ([]byteRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, fmt.Errorf("invalid range")
+	}
+	var ranges []byteRange
+	var total int64
+	noOverlap := false
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid range")
+		}
+		first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		var r byteRange
+		if first == "" {
+			// suffix range, the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid range")
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, fmt.Errorf("invalid range")
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, fmt.Errorf("invalid range")
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		if r.length == 0 {
+			noOverlap = true
+			continue
+		}
+		ranges = append(ranges, r)
+		total += r.length
+	}
+	if len(ranges) == 0 && noOverlap {
+		return nil, errUnsatisfiable
+	}
+	if total > size {
+		// asking for more than the whole content, likely abuse
+		return nil, nil
+	}
+	if ranges = mergeRanges(ranges); len(ranges) > MaxRanges {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// mergeRanges sort ranges by offset and join the ones that overlap or
+// touch
+func mergeRanges(ranges []byteRange) []byteRange {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	ret := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &ret[len(ret)-1]
+		if end := last.start + last.length; r.start <= end {
+			if e := r.start + r.length; e > end {
+				last.length = e - last.start
+			}
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// ifRange reports whether ranges should be honoured, If-Range holds a
+// strong etag or a date that has to match the current representation
+func ifRange(r *http.Request, etag string, modTime time.Time) bool {
+	v := r.Header.Get("If-Range")
+	if v == "" {
+		return true
+	}
+	if strings.HasPrefix(v, `"`) {
+		return etag != "" && !strings.HasPrefix(etag, "W/") && v == etag
+	}
+	if strings.HasPrefix(v, "W/") {
+		return false
+	}
+	t, err := http.ParseTime(v)
+	return err == nil && !modTime.IsZero() && t.Equal(modTime.Truncate(time.Second))
+}
+
+// notModified answer conditional requests, true when the response is done
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	if im := r.Header.Get("If-Match"); im != "" && im != "*" && !etagListContains(im, etag, false) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if inm == "*" || etagListContains(inm, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !modTime.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// etagListContains look etag up in a comma separated header, weak
+// comparison ignores the W/ prefix
+func etagListContains(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if weak {
+			v = strings.TrimPrefix(v, "W/")
+		}
+		if v == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeBlob stream the blob at key, answering conditional and range
+// requests: single ranges, multiple ranges as multipart/byteranges and
+// If-Range revalidation. A non empty filename is sent as attachment.
+func ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, store BlobStore, key, filename string) {
+	info, open, err := blobSource(ctx, store, key)
+	if err == ErrBlobNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	etag := info.ETag
+	if etag == "" && !info.ModTime.IsZero() {
+		etag = fmt.Sprintf(`"%x-%x"`, info.Size, info.ModTime.UnixNano())
+	}
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !info.ModTime.IsZero() {
+		h.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if filename != "" {
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	if notModified(w, r, etag, info.ModTime) {
+		return
+	}
+	ctype := info.ContentType
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	var ranges []byteRange
+	if ifRange(r, etag, info.ModTime) {
+		if ranges, err = parseRanges(r.Header.Get("Range"), info.Size); err == errUnsatisfiable {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if err != nil {
+			// malformed ranges are ignored, as rfc 7233 allows
+			ranges = nil
+		}
+	}
+	switch len(ranges) {
+	case 0:
+		h.Set("Content-Type", ctype)
+		h.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			copyRange(w, open, byteRange{0, info.Size})
+		}
+	case 1:
+		h.Set("Content-Type", ctype)
+		h.Set("Content-Range", ranges[0].contentRange(info.Size))
+		h.Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method != http.MethodHead {
+			copyRange(w, open, ranges[0])
+		}
+	default:
+		mw := multipart.NewWriter(w)
+		h.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method == http.MethodHead {
+			return
+		}
+		for _, br := range ranges {
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {ctype},
+				"Content-Range": {br.contentRange(info.Size)},
+			})
+			if err != nil || copyRange(part, open, br) != nil {
+				return
+			}
+		}
+		mw.Close()
+	}
+}
+
+// blobSource metadata of key and a func opening byte ranges of it
+func blobSource(ctx context.Context, store BlobStore, key string) (BlobInfo, func(byteRange) (io.ReadCloser, error), error) {
+	if rs, ok := store.(RangeStore); ok {
+		info, err := rs.Stat(ctx, key)
+		return info, func(br byteRange) (io.ReadCloser, error) {
+			return rs.GetRange(ctx, key, br.start, br.length)
+		}, err
+	}
+	rc, info, err := store.Get(ctx, key)
+	if err != nil {
+		return info, nil, err
+	}
+	rc.Close()
+	return info, func(br byteRange) (io.ReadCloser, error) {
+		rc, _, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, rc, br.start); err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(rc, br.length), rc}, nil
+	}, nil
+}
+
+func copyRange(w io.Writer, open func(byteRange) (io.ReadCloser, error), br byteRange) error {
+	if br.length == 0 {
+		return nil
+	}
+	rc, err := open(br)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.CopyN(w, rc, br.length)
+	return err
+}
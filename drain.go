@@ -0,0 +1,63 @@
+package net
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// DrainLimit default most bytes of a request body left unread by the
+// endpoint that are drained to keep the connection reusable
+const DrainLimit = MB
+
+// WithDrainLimit drain at most n unread body bytes after the endpoint
+// returns, larger bodies close the connection; 0 disables draining
+func WithDrainLimit(n int64) Option {
+	return func(s *Server) {
+		s.drainLimit = n
+	}
+}
+
+// lazyBody request body tracking whether the endpoint consumed it. Nothing
+// is read until the endpoint does, so an "Expect: 100-continue" client is
+// only told to send its body when the endpoint binds it.
+type lazyBody struct {
+	io.ReadCloser
+	eof    bool
+	closed bool
+}
+
+func (b *lazyBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *lazyBody) Close() error {
+	b.closed = true
+	return b.ReadCloser.Close()
+}
+
+// trackBody wrap the body of r for drainBody, nil when r has none
+func (s *Server) trackBody(r *http.Request) *lazyBody {
+	if s.drainLimit <= 0 || r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+	b := &lazyBody{ReadCloser: r.Body}
+	r.Body = b
+	return b
+}
+
+// drainBody read what the endpoint left of b up to the drain limit and
+// close it, bodies announcing more are closed right away
+func (s *Server) drainBody(b *lazyBody, r *http.Request) {
+	if b == nil || b.eof || b.closed {
+		return
+	}
+	if r.ContentLength <= s.drainLimit {
+		io.CopyN(ioutil.Discard, b.ReadCloser, s.drainLimit)
+	}
+	b.ReadCloser.Close()
+}
@@ -0,0 +1,41 @@
+package net
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Encoder writes json responses, lets a server swap encoding/json for a
+// faster backend
+type Encoder interface {
+	Encode(w io.Writer, v interface{}) error
+}
+
+// EncoderFunc func adapter for Encoder
+type EncoderFunc func(w io.Writer, v interface{}) error
+
+// Encode calls f
+func (f EncoderFunc) Encode(w io.Writer, v interface{}) error {
+	return f(w, v)
+}
+
+// StdEncoder encoding/json, Indent is used for pretty output
+type StdEncoder struct {
+	Indent string
+}
+
+// Encode v as json followed by a newline
+func (e StdEncoder) Encode(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	if e.Indent != "" {
+		enc.SetIndent("", e.Indent)
+	}
+	return enc.Encode(v)
+}
+
+// WithEncoder encode json responses with enc, PrettyJSON is then up to enc
+func WithEncoder(enc Encoder) Option {
+	return func(s *Server) {
+		s.Encoder = enc
+	}
+}
@@ -2,14 +2,12 @@ package net
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -19,6 +17,22 @@ type paramKey int
 
 var pKey paramKey = 2
 
+const (
+	routeKey paramKey = iota + 3
+	identityKey
+	auditKey
+	requestIDKey
+	loggerKey
+	clockKey
+	scopeKey
+	bodyLimitKey
+	nonceKey
+	tenantKey
+	splitKey
+	localeKey
+	apiKeyKey
+)
+
 //READLIMIT read limit
 const (
 	MB        = 1 << 20
@@ -26,20 +40,80 @@ const (
 	BUFFERMAX = 5 * MB
 )
 
-func NewServer() *Server {
+// Option configures a Server
+type Option func(*Server)
+
+func NewServer(opts ...Option) *Server {
 	router := httprouter.New()
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
+	s := &Server{
+		Router:     router,
+		backend:    httprouterBackend{router},
+		health:     newHealthRegistry(),
+		inFlight:   newInFlight(),
+		httpConfig: DefaultHTTPConfig,
+		drainLimit: DrainLimit,
+	}
+	s.workers = newWorkerPool(s, Workers, WorkerQueueSize)
+	router.NotFound = http.HandlerFunc(s.notFound)
+	router.MethodNotAllowed = http.HandlerFunc(s.methodNotAllowed)
+	// registered first so it runs last, after the listeners stopped
+	s.OnShutdown(func(ctx context.Context) error {
+		return s.workers.close(ctx)
+	})
 	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		if v == http.ErrAbortHandler {
+			// aborted on purpose, the server drops the connection quietly
+			panic(v)
+		}
+		s.reportPanic(r, v)
 		ErrorResponse(w, fmt.Errorf("%+v", v))
 	}
-	return &Server{
-		Router: router,
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 type Server struct {
 	*httprouter.Router
+	// PanicReporter receives recovered panics, nil disables reporting
+	PanicReporter PanicReporter
+	// HideErrors replaces internal error messages in responses with a
+	// generic text, the error is still logged
+	HideErrors bool
+	// PrettyJSON indents json responses
+	PrettyJSON bool
+	// Encoder writes json responses, nil uses encoding/json
+	Encoder Encoder
+	// PermissiveCORS answers cors requests from any origin, WithCORS takes
+	// precedence
+	PermissiveCORS bool
+	// DevMode adds stack traces, the route and a request dump to error
+	// responses, ignored when HideErrors is set
+	DevMode bool
+	// Environment the server was preset for
+	Environment Environment
+
+	health     *healthRegistry
+	build      BuildInfo
+	inFlight   *inFlight
+	hooks      requestHooks
+	lifecycle  lifecycle
+	api        apiDoc
+	clock      Clock
+	pooled     bool
+	cors       *CORS
+	backend    RouterBackend
+	httpConfig HTTPConfig
+	drainLimit int64
+	workers    *workerPool
+	draining   int32
+	translator Translator
+	warmUp     warmUp
+	conns      connTracker
+	routes     routeTable
 }
 
 // ResultResponse json response
@@ -63,6 +137,9 @@ func NoAccess(w http.ResponseWriter) {
 
 // Params get params
 func Params(ctx context.Context) (httprouter.Params, error) {
+	if sc := scopeFrom(ctx); sc != nil {
+		return sc.params, nil
+	}
 	params, ok := ctx.Value(pKey).(httprouter.Params)
 	if !ok {
 		return httprouter.Params{}, fmt.Errorf("no params in context")
@@ -70,13 +147,23 @@ func Params(ctx context.Context) (httprouter.Params, error) {
 	return params, nil
 }
 
-// ErrorResponse error json response
+// ErrorResponse error json response, servers hiding errors only log the
+// message. Errors caused by the client going away are logged as such and
+// answered with StatusClientClosed.
 func ErrorResponse(w http.ResponseWriter, err error) {
+	if clientCanceled(w, err) {
+		clientClosed(w, err)
+		return
+	}
 	ret := JSONResult{
 		StatusCode: http.StatusInternalServerError,
 		Success:    false,
 		Error:      err.Error(),
 	}
+	if sw := serverWriterFrom(w); sw != nil && sw.server.HideErrors {
+		ret.Error = http.StatusText(http.StatusInternalServerError)
+	}
+	ret.Debug = debugInfo(w, err)
 	log.Print(err)
 	ret.Write(w)
 }
@@ -90,36 +177,71 @@ func SizeResponse(w http.ResponseWriter, err error) {
 	ret.Write(w)
 }
 
+// BadRequest malformed request json response
+func BadRequest(w http.ResponseWriter, err error) {
+	ret := JSONResult{
+		StatusCode: http.StatusBadRequest,
+		Success:    false,
+		Error:      err.Error(),
+	}
+	ret.Write(w)
+}
+
 // JSONResult json result struct
 type JSONResult struct {
 	Success    bool        `json:"success"`
 	StatusCode int         `json:"-"`
 	Error      string      `json:"error,omitempty"`
 	Result     interface{} `json:"result,omitempty"`
+	Debug      *DebugInfo  `json:"debug,omitempty"`
 }
 
 // Write write jsonresult to output
 func (r JSONResult) Write(w http.ResponseWriter) {
+	if r.Error != "" {
+		r.Error = translate(w, r.Error)
+	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(r.StatusCode)
-	if err := json.NewEncoder(w).Encode(r); err != nil {
+	var enc Encoder = StdEncoder{}
+	if sw := serverWriterFrom(w); sw != nil {
+		switch {
+		case sw.server.Encoder != nil:
+			enc = sw.server.Encoder
+		case sw.server.PrettyJSON:
+			enc = StdEncoder{Indent: "  "}
+		}
+	}
+	if err := enc.Encode(w, r); err != nil {
 		panic(err)
 	}
 }
 
-// DecodeJSONBody decode posted json body
+// DecodeBody decode posted json body, see DecodeJSON. The size limit is
+// READLIMIT unless the route sets one with ReadLimits.
 func DecodeBody(r *http.Request, v interface{}) error {
-	body, err := ioutil.ReadAll(io.LimitReader(r.Body, READLIMIT))
+	body, err := readBody(r)
 	if err != nil {
 		return err
 	}
+	return decodeJSON(body, v)
+}
+
+// readBody read and close the request body within the route's size limit
+func readBody(r *http.Request) ([]byte, error) {
+	bl := bodyLimitFrom(r.Context())
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, bl.limit+1))
+	if err != nil {
+		return nil, err
+	}
 	if err := r.Body.Close(); err != nil {
-		return err
+		return nil, err
 	}
-	if err := json.Unmarshal(body, v); err != nil {
-		return err
+	if int64(len(body)) > bl.limit {
+		bl.reject(r.Context())
+		return nil, ErrBodyTooLarge
 	}
-	return nil
+	return body, nil
 }
 
 // EndPointDecorator decorates endpoints
@@ -140,29 +262,30 @@ func (ed EndPointConfig) Apply(endpoint EndPoint) EndPoint {
 
 func Logger(e EndPoint) EndPoint {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		clock := ClockFrom(ctx)
 		defer func(begin time.Time) {
-			dur := time.Now().Sub(begin)
+			dur := clock.Now().Sub(begin)
+			if ClientGone(ctx) {
+				log.Printf("request took %d ms, client canceled\n", dur/time.Millisecond)
+				return
+			}
 			log.Printf("request took %d ms\n", dur/time.Millisecond)
-		}(time.Now())
+		}(clock.Now())
 		e(ctx, w, r)
 	}
 }
 
+// TimeOut give the endpoint a 50ms deadline, endpoints that ran past it
+// are logged once they return. The deadline is checked after the fact so
+// no goroutine is kept per request.
 func TimeOut(e EndPoint) EndPoint {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithDeadline(
-			ctx,
-			time.Now().Add(50*time.Millisecond),
-		)
+		ctx, cancel := ClockTimeout(ctx, 50*time.Millisecond)
 		defer cancel()
-		go func() {
-			select {
-			case <-ctx.Done():
-				log.Printf("error: %s", ctx.Err())
-				return
-			}
-		}()
 		e(ctx, w, r)
+		if err := ctx.Err(); err == context.DeadlineExceeded {
+			log.Printf("error: %s", err)
+		}
 	}
 }
 
@@ -179,47 +302,66 @@ func LimitUp(e EndPoint) EndPoint {
 	}
 }
 
+// CorsHandler answer cors requests from any origin, see CORS for a
+// configurable layer
 func CorsHandler(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Vary", "Origin")
-		w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
-		//w.Header().Set("Access-Control-Allow-Credentials", "true")
-		if r.Method == http.MethodOptions {
-			w.Header().Add("Vary", "Access-Control-Request-Method")
-			w.Header().Add("Vary", "Access-Control-Request-Headers")
-			w.Header().Set(
-				"Access-Control-Allow-Methods",
-				strings.ToUpper(r.Header.Get("Access-Control-Request-Method")),
-			)
-			w.Header().Set(
-				"Access-Control-Allow-Headers",
-				"authorization",
-			)
-			w.WriteHeader(http.StatusOK)
-			return
-
-		}
-		handler.ServeHTTP(w, r)
-	})
+	return permissiveCORS.Handler(handler)
 }
 
 func Context(ctx context.Context, params httprouter.Params) context.Context {
 	return context.WithValue(ctx, pKey, params)
 }
 
+// RouteContext context carrying the matched route pattern
+func RouteContext(ctx context.Context, method, path string) context.Context {
+	return context.WithValue(ctx, routeKey, RouteInfo{Method: method, Path: path})
+}
+
+// RouteInfo method and pattern an endpoint was registered with
+type RouteInfo struct {
+	Method string
+	Path   string
+}
+
+// Route get the matched route, zero when called outside AddEndPoint
+func Route(ctx context.Context) RouteInfo {
+	if sc := scopeFrom(ctx); sc != nil {
+		return sc.route
+	}
+	route, _ := ctx.Value(routeKey).(RouteInfo)
+	return route
+}
+
 // EndPoint http endpoint
 type EndPoint func(context.Context, http.ResponseWriter, *http.Request)
 
 // AddEndPoint add endpoint to server
 func (s *Server) AddEndPoint(method, path string, endpoint EndPoint) {
-	s.Handle(method, path, func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
-		//for now no timeout or cancel funcs
-		ctx := Context(req.Context(), p)
+	route := RouteInfo{Method: method, Path: path}
+	s.routes.add(route)
+	s.backend.Handle(method, path, func(w http.ResponseWriter, req *http.Request, p httprouter.Params) {
+		sc := s.newScope(req.Context())
+		sc.route = route
+		sc.params = p
+		sc.id = requestID(w, req)
+		var ctx context.Context = sc
+		body := s.trackBody(req)
 		req = req.WithContext(ctx)
-		endpoint(ctx, w, req)
+		if sw := serverWriterFrom(w); sw != nil {
+			// error responses in dev mode report the routed request
+			sw.request = req
+		}
+		defer s.inFlight.track(ctx, req)()
+		s.withHooks(ctx, w, req, endpoint)
+		s.drainBody(body, req)
+		s.releaseScope(sc)
 	})
 }
 
+// ConfigValue environment value of key, panics when unset.
+//
+// Deprecated: declare a ConfigSpec and use LoadConfig or MustLoad, which
+// report every missing key at once.
 func ConfigValue(key string) string {
 	val, ok := os.LookupEnv(key)
 	if !ok {
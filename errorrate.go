@@ -0,0 +1,142 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrorRateAlert threshold crossing of a route's error rate
+type ErrorRateAlert struct {
+	Route     string
+	Rate      float64
+	Threshold float64
+	Requests  uint64
+	Errors    uint64
+	// Firing is true when the rate went over the threshold, false when it
+	// recovered below it
+	Firing bool
+	Time   time.Time
+}
+
+// ErrorRateTracker rolling per route error rates with an alert callback
+type ErrorRateTracker struct {
+	// Threshold error fraction that triggers an alert, e.g. 0.05
+	Threshold float64
+	// Window the rate is computed over, defaults to a minute
+	Window time.Duration
+	// MinRequests in the window before alerts are considered
+	MinRequests uint64
+	// OnAlert is called when a route crosses the threshold in either
+	// direction
+	OnAlert func(ErrorRateAlert)
+
+	mu     sync.Mutex
+	routes map[string]*errorWindow
+}
+
+// error windows are kept in buckets of this width
+const errorBucket = 5 * time.Second
+
+type errorCount struct {
+	slot     int64
+	requests uint64
+	errors   uint64
+}
+
+type errorWindow struct {
+	buckets []errorCount
+	firing  bool
+}
+
+// NewErrorRateTracker tracker alerting through onAlert
+func NewErrorRateTracker(threshold float64, onAlert func(ErrorRateAlert)) *ErrorRateTracker {
+	return &ErrorRateTracker{
+		Threshold:   threshold,
+		Window:      time.Minute,
+		MinRequests: 10,
+		OnAlert:     onAlert,
+		routes:      make(map[string]*errorWindow),
+	}
+}
+
+func (t *ErrorRateTracker) window(route string) *errorWindow {
+	if t.routes == nil {
+		t.routes = make(map[string]*errorWindow)
+	}
+	win, ok := t.routes[route]
+	if !ok {
+		size := t.Window
+		if size <= 0 {
+			size = time.Minute
+		}
+		n := int(size / errorBucket)
+		if n < 1 {
+			n = 1
+		}
+		win = &errorWindow{buckets: make([]errorCount, n)}
+		t.routes[route] = win
+	}
+	return win
+}
+
+// Observe record the outcome of a request to route
+func (t *ErrorRateTracker) Observe(route string, status int) {
+	now := time.Now()
+	slot := now.UnixNano() / int64(errorBucket)
+	t.mu.Lock()
+	win := t.window(route)
+	b := &win.buckets[slot%int64(len(win.buckets))]
+	if b.slot != slot {
+		*b = errorCount{slot: slot}
+	}
+	b.requests++
+	if status >= http.StatusInternalServerError {
+		b.errors++
+	}
+	var requests, errors uint64
+	oldest := slot - int64(len(win.buckets)) + 1
+	for _, c := range win.buckets {
+		if c.slot >= oldest {
+			requests += c.requests
+			errors += c.errors
+		}
+	}
+	if requests < t.MinRequests {
+		t.mu.Unlock()
+		return
+	}
+	rate := float64(errors) / float64(requests)
+	firing := rate >= t.Threshold
+	changed := firing != win.firing
+	win.firing = firing
+	t.mu.Unlock()
+	if changed && t.OnAlert != nil {
+		t.OnAlert(ErrorRateAlert{
+			Route:     route,
+			Rate:      rate,
+			Threshold: t.Threshold,
+			Requests:  requests,
+			Errors:    errors,
+			Firing:    firing,
+			Time:      now,
+		})
+	}
+}
+
+// Decorate EndPointDecorator feeding response statuses to the tracker
+func (t *ErrorRateTracker) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+		defer func() {
+			err := recover()
+			status := requestStatus(ctx, rec, err)
+			if err != nil {
+				defer panic(err)
+			}
+			t.Observe(routeLabel(ctx), status)
+		}()
+		e(ctx, rec, r)
+	}
+}
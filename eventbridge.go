@@ -0,0 +1,186 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// event types published for request lifecycle events
+const (
+	EventRequestStarted  = "request.started"
+	EventRequestFinished = "request.finished"
+)
+
+// EventBridgeQueueSize default queue of an EventBridge
+const EventBridgeQueueSize = 4096
+
+// BrokerMessage message handed to a broker
+type BrokerMessage struct {
+	Topic string
+	// Key partitions messages, the request id for request events
+	Key     string
+	Headers map[string]string
+	Data    []byte
+}
+
+// Broker publishes messages to a message broker, adapt a nats or kafka
+// client to it
+type Broker interface {
+	Publish(ctx context.Context, msg BrokerMessage) error
+}
+
+// BrokerFunc func adapter for Broker
+type BrokerFunc func(ctx context.Context, msg BrokerMessage) error
+
+// Publish calls f
+func (f BrokerFunc) Publish(ctx context.Context, msg BrokerMessage) error {
+	return f(ctx, msg)
+}
+
+// BrokerEvent json body of published messages
+type BrokerEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Time      time.Time   `json:"time"`
+	RequestID string      `json:"request_id,omitempty"`
+	Route     string      `json:"route,omitempty"`
+	Payload   interface{} `json:"payload,omitempty"`
+}
+
+// EventBridge publishes request lifecycle and domain events to a broker
+// asynchronously, events are dropped rather than slowing requests down
+// when the queue is full
+type EventBridge struct {
+	broker Broker
+	// Topic events are published to, the event type is appended as
+	// Topic.type when set, otherwise the type is the topic
+	Topic string
+
+	queue   chan BrokerMessage
+	dropped uint64
+	mu      sync.RWMutex
+	closing bool
+	wg      sync.WaitGroup
+	done    chan struct{}
+}
+
+// NewEventBridge bridge publishing to broker, queued events are flushed on
+// server shutdown
+func NewEventBridge(s *Server, broker Broker) *EventBridge {
+	b := &EventBridge{
+		broker: broker,
+		queue:  make(chan BrokerMessage, EventBridgeQueueSize),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	if s != nil {
+		s.OnShutdown(b.Close)
+	}
+	return b
+}
+
+// RequestEvents publish a started and finished event for every request
+// served by s
+func (b *EventBridge) RequestEvents(s *Server) {
+	s.OnRequestStarted(func(ctx context.Context, ev RequestEvent) {
+		b.publish(ctx, EventRequestStarted, ev.ID, ev)
+	})
+	s.OnRequestFinished(func(ctx context.Context, ev RequestEvent) {
+		b.publish(ctx, EventRequestFinished, ev.ID, ev)
+	})
+}
+
+// Emit publish a domain event from an endpoint, the request id and route
+// are taken from ctx
+func (b *EventBridge) Emit(ctx context.Context, eventType string, payload interface{}) {
+	b.publish(ctx, eventType, RequestID(ctx), payload)
+}
+
+// Dropped events dropped because the queue was full or the bridge closed
+func (b *EventBridge) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+func (b *EventBridge) publish(ctx context.Context, eventType, key string, payload interface{}) {
+	ev := BrokerEvent{
+		ID:        newRequestID(),
+		Type:      eventType,
+		Time:      time.Now().UTC(),
+		RequestID: RequestID(ctx),
+		Route:     Route(ctx).Path,
+		Payload:   payload,
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("event bridge: %s", err)
+		return
+	}
+	topic := eventType
+	if b.Topic != "" {
+		topic = b.Topic + "." + eventType
+	}
+	msg := BrokerMessage{
+		Topic:   topic,
+		Key:     key,
+		Headers: map[string]string{"type": eventType},
+		Data:    data,
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closing {
+		atomic.AddUint64(&b.dropped, 1)
+		return
+	}
+	b.wg.Add(1)
+	select {
+	case b.queue <- msg:
+	default:
+		b.wg.Done()
+		atomic.AddUint64(&b.dropped, 1)
+	}
+}
+
+func (b *EventBridge) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-b.done
+		cancel()
+	}()
+	for msg := range b.queue {
+		if err := b.broker.Publish(ctx, msg); err != nil {
+			log.Printf("event bridge: publish %s: %s", msg.Topic, err)
+		}
+		b.wg.Done()
+	}
+}
+
+// Close stop accepting events and wait until queued events are published
+// or ctx expires, publishes in progress are then canceled
+func (b *EventBridge) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closing {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closing = true
+	close(b.queue)
+	b.mu.Unlock()
+	flushed := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		close(b.done)
+		return nil
+	case <-ctx.Done():
+		close(b.done)
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,30 @@
+package net
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExemplarSink MetricsSink able to link observations to traces
+type ExemplarSink interface {
+	MetricsSink
+	ObserveExemplar(route, method string, status int, dur time.Duration, size int64, traceID string)
+}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	time    time.Time
+}
+
+// TraceID id of the sampled trace the request belongs to, empty when
+// tracing is off or the span is not sampled
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() || !sc.IsSampled() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
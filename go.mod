@@ -1,5 +1,13 @@
 module github.com/mjolk/net
 
-go 1.12
+go 1.19
 
-require github.com/julienschmidt/httprouter v1.2.0
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/gorilla/websocket v1.5.3
+	github.com/julienschmidt/httprouter v1.2.0
+	go.opentelemetry.io/otel v1.16.0
+	go.opentelemetry.io/otel/metric v1.16.0
+	go.opentelemetry.io/otel/trace v1.16.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,197 @@
+package net
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// GraphQLRequest operation as posted by graphql clients
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLError graphql error entry
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLResponse graphql result, written as is instead of a JSONResult
+// since graphql clients expect the spec format
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLExecutor runs an operation against a schema, adapt the executor of
+// the graphql library in use to it
+type GraphQLExecutor interface {
+	Execute(ctx context.Context, req GraphQLRequest) GraphQLResponse
+}
+
+// GraphQLExecutorFunc func adapter for GraphQLExecutor
+type GraphQLExecutorFunc func(ctx context.Context, req GraphQLRequest) GraphQLResponse
+
+// Execute calls f
+func (f GraphQLExecutorFunc) Execute(ctx context.Context, req GraphQLRequest) GraphQLResponse {
+	return f(ctx, req)
+}
+
+// PersistedQueryStore keeps queries by their sha256 hash
+type PersistedQueryStore interface {
+	Get(hash string) (string, bool)
+	Put(hash, query string)
+}
+
+// MemoryQueryStore in memory PersistedQueryStore
+type MemoryQueryStore struct {
+	mu      sync.RWMutex
+	queries map[string]string
+}
+
+// NewMemoryQueryStore empty store
+func NewMemoryQueryStore() *MemoryQueryStore {
+	return &MemoryQueryStore{queries: make(map[string]string)}
+}
+
+// Get query by hash
+func (s *MemoryQueryStore) Get(hash string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q, ok := s.queries[hash]
+	return q, ok
+}
+
+// Put store query under hash
+func (s *MemoryQueryStore) Put(hash, query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries[hash] = query
+}
+
+// GraphQLConfig options of the graphql endpoint
+type GraphQLConfig struct {
+	// Queries enables automatic persisted queries when set
+	Queries PersistedQueryStore
+	// ResolverTimeout caps each resolver, see ResolverContext
+	ResolverTimeout time.Duration
+}
+
+type resolverKey struct{}
+
+// ResolverContext context for a single resolver, bounded by the
+// configured resolver timeout and the request deadline, whichever comes
+// first
+func ResolverContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	budget, ok := ctx.Value(resolverKey{}).(time.Duration)
+	if !ok || budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, budget)
+}
+
+// GraphQL endpoint executing operations from POST bodies or GET query
+// parameters
+func GraphQL(exec GraphQLExecutor, config GraphQLConfig) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		req, err := graphQLRequest(r)
+		if err != nil {
+			writeGraphQL(w, http.StatusBadRequest, GraphQLResponse{
+				Errors: []GraphQLError{{Message: err.Error()}},
+			})
+			return
+		}
+		if config.Queries != nil {
+			if gqlErr := persistedQuery(config.Queries, &req); gqlErr != nil {
+				writeGraphQL(w, http.StatusOK, GraphQLResponse{
+					Errors: []GraphQLError{*gqlErr},
+				})
+				return
+			}
+		}
+		if req.Query == "" {
+			writeGraphQL(w, http.StatusBadRequest, GraphQLResponse{
+				Errors: []GraphQLError{{Message: "no query"}},
+			})
+			return
+		}
+		if config.ResolverTimeout > 0 {
+			ctx = context.WithValue(ctx, resolverKey{}, config.ResolverTimeout)
+		}
+		writeGraphQL(w, http.StatusOK, exec.Execute(ctx, req))
+	}
+}
+
+// MountGraphQL mount endpoint on path for GET and POST
+func (s *Server) MountGraphQL(path string, endpoint EndPoint) {
+	s.AddEndPoint(http.MethodGet, path, endpoint)
+	s.AddEndPoint(http.MethodPost, path, endpoint)
+}
+
+func graphQLRequest(r *http.Request) (GraphQLRequest, error) {
+	var req GraphQLRequest
+	if r.Method == http.MethodPost {
+		return req, DecodeBody(r, &req)
+	}
+	q := r.URL.Query()
+	req.Query = q.Get("query")
+	req.OperationName = q.Get("operationName")
+	for param, dst := range map[string]*map[string]interface{}{
+		"variables":  &req.Variables,
+		"extensions": &req.Extensions,
+	} {
+		if v := q.Get(param); v != "" {
+			if err := json.Unmarshal([]byte(v), dst); err != nil {
+				return req, fmt.Errorf("invalid %s: %s", param, err)
+			}
+		}
+	}
+	return req, nil
+}
+
+// persistedQuery resolve or register an automatic persisted query
+func persistedQuery(store PersistedQueryStore, req *GraphQLRequest) *GraphQLError {
+	ext, ok := req.Extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	hash, _ := ext["sha256Hash"].(string)
+	if hash == "" {
+		return nil
+	}
+	if req.Query == "" {
+		query, ok := store.Get(hash)
+		if !ok {
+			return &GraphQLError{
+				Message:    "PersistedQueryNotFound",
+				Extensions: map[string]interface{}{"code": "PERSISTED_QUERY_NOT_FOUND"},
+			}
+		}
+		req.Query = query
+		return nil
+	}
+	sum := sha256.Sum256([]byte(req.Query))
+	if hex.EncodeToString(sum[:]) != hash {
+		return &GraphQLError{Message: "provided sha does not match query"}
+	}
+	store.Put(hash, req.Query)
+	return nil
+}
+
+func writeGraphQL(w http.ResponseWriter, status int, res GraphQLResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,197 @@
+package net
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// grpc-web content types
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+)
+
+// IsGRPCWeb reports whether r is a grpc-web call
+func IsGRPCWeb(r *http.Request) bool {
+	return r.Method == http.MethodPost &&
+		strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// GRPCWebHandler translate grpc-web calls from browsers to grpc and serve
+// them with backend, e.g. a *grpc.Server, other requests go to next. Cors
+// preflights for grpc-web are answered for any origin.
+func GRPCWebHandler(backend, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions &&
+			strings.Contains(strings.ToLower(r.Header.Get("Access-Control-Request-Headers")), "x-grpc-web") {
+			grpcWebPreflight(w, r)
+			return
+		}
+		if !IsGRPCWeb(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "grpc-status, grpc-message")
+		}
+		gw := newGRPCWebWriter(w, r)
+		backend.ServeHTTP(gw, grpcRequest(r, gw.text))
+		gw.finish()
+	})
+}
+
+func grpcWebPreflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+	w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+	w.Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+	w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// grpcRequest the grpc equivalent of a grpc-web request
+func grpcRequest(r *http.Request, text bool) *http.Request {
+	req := r.Clone(r.Context())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2"
+	ct := r.Header.Get("Content-Type")
+	if text {
+		ct = strings.Replace(ct, grpcWebTextContentType, "application/grpc", 1)
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{base64.NewDecoder(base64.StdEncoding, r.Body), r.Body}
+		req.ContentLength = -1
+		req.Header.Del("Content-Length")
+	} else {
+		ct = strings.Replace(ct, grpcWebContentType, "application/grpc", 1)
+	}
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("Te", "trailers")
+	req.Header.Del("X-Grpc-Web")
+	return req
+}
+
+// grpcWebWriter response writer turning grpc trailers into a grpc-web
+// trailer frame at the end of the body
+type grpcWebWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	text        bool
+	contentType string
+	wroteHeader bool
+}
+
+func newGRPCWebWriter(w http.ResponseWriter, r *http.Request) *grpcWebWriter {
+	ct := r.Header.Get("Content-Type")
+	return &grpcWebWriter{
+		w:           w,
+		header:      make(http.Header),
+		text:        strings.HasPrefix(ct, grpcWebTextContentType),
+		contentType: ct,
+	}
+}
+
+func (g *grpcWebWriter) Header() http.Header {
+	return g.header
+}
+
+func (g *grpcWebWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	trailers := g.declaredTrailers()
+	dst := g.w.Header()
+	for k, v := range g.header {
+		if _, ok := trailers[k]; ok || k == "Trailer" || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		dst[k] = v
+	}
+	dst.Set("Content-Type", g.contentType)
+	dst.Del("Content-Length")
+	g.w.WriteHeader(status)
+}
+
+func (g *grpcWebWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.text {
+		if _, err := io.WriteString(g.w, base64.StdEncoding.EncodeToString(b)); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return g.w.Write(b)
+}
+
+// Flush grpc requires a flushing writer
+func (g *grpcWebWriter) Flush() {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if f, ok := g.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap the underlying writer
+func (g *grpcWebWriter) Unwrap() http.ResponseWriter {
+	return g.w
+}
+
+func (g *grpcWebWriter) declaredTrailers() map[string]struct{} {
+	ret := make(map[string]struct{})
+	for _, v := range g.header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			ret[http.CanonicalHeaderKey(strings.TrimSpace(k))] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// finish write the trailer frame: flag 0x80, big endian length and the
+// trailers as lower case http header lines
+func (g *grpcWebWriter) finish() {
+	headersOnly := !g.wroteHeader
+	trailers := g.declaredTrailers()
+	var keys []string
+	values := make(map[string][]string)
+	for k, v := range g.header {
+		name := k
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			name = strings.TrimPrefix(k, http.TrailerPrefix)
+		} else if _, ok := trailers[k]; !ok {
+			// trailers only responses carry the status as headers
+			if !headersOnly || !strings.HasPrefix(strings.ToLower(k), "grpc-") {
+				continue
+			}
+		}
+		name = strings.ToLower(name)
+		if _, ok := values[name]; !ok {
+			keys = append(keys, name)
+		}
+		values[name] = append(values[name], v...)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		for _, v := range values[k] {
+			buf.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	frame := make([]byte, 5, 5+buf.Len())
+	frame[0] = 0x80
+	binary.BigEndian.PutUint32(frame[1:], uint32(buf.Len()))
+	frame = append(frame, buf.Bytes()...)
+	g.Write(frame)
+	g.Flush()
+}
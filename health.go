@@ -0,0 +1,181 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// health check defaults
+const (
+	HealthTimeout  = 2 * time.Second
+	HealthCacheTTL = time.Second
+)
+
+// HealthCheck reports an unhealthy dependency through its error
+type HealthCheck func(ctx context.Context) error
+
+// CheckStatus outcome of a single health check
+type CheckStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthReport outcome of all registered health checks
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks,omitempty"`
+	// WarmUp outcome of the warmers, see AddWarmer
+	WarmUp  map[string]CheckStatus `json:"warm_up,omitempty"`
+	Checked time.Time              `json:"checked"`
+}
+
+// Healthy reports whether every check passed
+func (h HealthReport) Healthy() bool {
+	return h.Status == "ok"
+}
+
+type healthRegistry struct {
+	mu      sync.Mutex
+	names   []string
+	checks  map[string]HealthCheck
+	timeout time.Duration
+	ttl     time.Duration
+	last    *HealthReport
+}
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{
+		checks:  make(map[string]HealthCheck),
+		timeout: HealthTimeout,
+		ttl:     HealthCacheTTL,
+	}
+}
+
+func (h *healthRegistry) add(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+		sort.Strings(h.names)
+	}
+	h.checks[name] = check
+	h.last = nil
+}
+
+// run all checks concurrently, results are cached for ttl
+func (h *healthRegistry) run(ctx context.Context) HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.last != nil && time.Since(h.last.Checked) < h.ttl {
+		return *h.last
+	}
+	report := HealthReport{
+		Status:  "ok",
+		Checks:  make(map[string]CheckStatus, len(h.names)),
+		Checked: time.Now(),
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, name := range h.names {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			status := runCheck(ctx, check, h.timeout)
+			mu.Lock()
+			report.Checks[name] = status
+			if status.Status != "ok" {
+				report.Status = "fail"
+			}
+			mu.Unlock()
+		}(name, h.checks[name])
+	}
+	wg.Wait()
+	h.last = &report
+	return report
+}
+
+func runCheck(ctx context.Context, check HealthCheck, timeout time.Duration) CheckStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	begin := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- fmt.Errorf("check panicked: %+v", v)
+			}
+		}()
+		done <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	status := CheckStatus{
+		Status:   "ok",
+		Duration: time.Since(begin).String(),
+	}
+	if err != nil {
+		status.Status = "fail"
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// AddHealthCheck register a readiness check under name, replacing any
+// check registered before with the same name
+func (s *Server) AddHealthCheck(name string, check HealthCheck) {
+	s.health.add(name, check)
+}
+
+// Health run the registered checks, cached results are reused
+func (s *Server) Health(ctx context.Context) HealthReport {
+	return s.health.run(ctx)
+}
+
+// EnableHealth mount /healthz (liveness) and /readyz (readiness)
+func (s *Server) EnableHealth() {
+	s.AddEndPoint(http.MethodGet, "/healthz", s.Liveness)
+	s.AddEndPoint(http.MethodGet, "/readyz", s.Readiness)
+}
+
+// Liveness endpoint answering as long as the process serves requests
+func (s *Server) Liveness(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ResultResponse(w, HealthReport{Status: "ok", Checked: time.Now()})
+}
+
+// Readiness endpoint reporting the registered health checks and warm up,
+// 503 when a check fails, warm up did not succeed (yet) or the server is
+// draining
+func (s *Server) Readiness(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	report := s.Health(ctx)
+	warm, warmed := s.warmUpReport()
+	report.WarmUp = warm
+	draining := s.Draining()
+	if report.Healthy() && warmed && !draining {
+		ResultResponse(w, report)
+		return
+	}
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusServiceUnavailable,
+		Error:      "not ready",
+		Result:     report,
+	}
+	switch {
+	case draining:
+		res.Error = "draining"
+	case !warmed:
+		res.Error = "warming up"
+	}
+	res.Write(w)
+}
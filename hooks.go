@@ -0,0 +1,112 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestEvent telemetry of a single request, Status, Duration and the
+// sizes are only set on RequestFinished
+type RequestEvent struct {
+	ID           string
+	Method       string
+	Route        string
+	Path         string
+	RemoteAddr   string
+	Start        time.Time
+	Status       int
+	Duration     time.Duration
+	RequestSize  int64
+	ResponseSize int64
+}
+
+// RequestHook receives request telemetry events, hooks run synchronously
+// on the request goroutine so they should be cheap
+type RequestHook func(ctx context.Context, ev RequestEvent)
+
+type requestHooks struct {
+	mu       sync.RWMutex
+	started  []RequestHook
+	finished []RequestHook
+}
+
+func (h *requestHooks) get() ([]RequestHook, []RequestHook) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.started, h.finished
+}
+
+// OnRequestStarted register hook called before the endpoint runs
+func (s *Server) OnRequestStarted(hook RequestHook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.started = append(s.hooks.started, hook)
+}
+
+// OnRequestFinished register hook called after the endpoint returned
+func (s *Server) OnRequestFinished(hook RequestHook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.finished = append(s.hooks.finished, hook)
+}
+
+// countingBody counts request body bytes read by the endpoint
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// withHooks wrap endpoint with the registered hooks, a no-op without any
+func (s *Server) withHooks(ctx context.Context, w http.ResponseWriter, r *http.Request, endpoint EndPoint) {
+	started, finished := s.hooks.get()
+	if len(started) == 0 && len(finished) == 0 {
+		endpoint(ctx, w, r)
+		return
+	}
+	ev := RequestEvent{
+		ID:         RequestID(ctx),
+		Method:     r.Method,
+		Route:      Route(ctx).Path,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		Start:      time.Now(),
+	}
+	for _, hook := range started {
+		hook(ctx, ev)
+	}
+	if len(finished) == 0 {
+		endpoint(ctx, w, r)
+		return
+	}
+	rec := newResponseRecorder(w)
+	var body *countingBody
+	if r.Body != nil {
+		body = &countingBody{ReadCloser: r.Body}
+		r.Body = body
+	}
+	defer func() {
+		err := recover()
+		ev.Status = requestStatus(ctx, rec, err)
+		if err != nil {
+			defer panic(err)
+		}
+		ev.Duration = time.Since(ev.Start)
+		ev.ResponseSize = rec.size
+		if body != nil {
+			ev.RequestSize = body.n
+		}
+		for _, hook := range finished {
+			hook(ctx, ev)
+		}
+	}()
+	endpoint(ctx, rec, r)
+}
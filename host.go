@@ -0,0 +1,90 @@
+package net
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostValidator rejects requests whose Host header is not on an allowed
+// list, so absolute urls built from the Host cannot be poisoned
+type HostValidator struct {
+	hosts    map[string]struct{}
+	suffixes []string
+}
+
+// NewHostValidator allow hosts, "*.example.com" allows subdomains. Ports
+// are ignored.
+func NewHostValidator(hosts ...string) *HostValidator {
+	v := &HostValidator{hosts: make(map[string]struct{}, len(hosts))}
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if strings.HasPrefix(h, "*.") {
+			v.suffixes = append(v.suffixes, h[1:])
+			continue
+		}
+		v.hosts[h] = struct{}{}
+	}
+	return v
+}
+
+// Allowed reports whether host, with or without port, is allowed
+func (v *HostValidator) Allowed(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if _, ok := v.hosts[host]; ok {
+		return true
+	}
+	for _, suffix := range v.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// check answer 400 for a missing or malformed host and 421 for a host
+// that is not served here, false when r may proceed
+func (v *HostValidator) check(w http.ResponseWriter, r *http.Request) bool {
+	status := 0
+	switch {
+	case r.Host == "" || strings.ContainsAny(r.Host, " /\\@"):
+		status = http.StatusBadRequest
+	case !v.Allowed(r.Host):
+		status = http.StatusMisdirectedRequest
+	}
+	if status == 0 {
+		return false
+	}
+	res := JSONResult{
+		Success:    false,
+		StatusCode: status,
+		Error:      "invalid host",
+	}
+	res.Write(w)
+	return true
+}
+
+// Decorate EndPointDecorator validating the host
+func (v *HostValidator) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if v.check(w, r) {
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+// Handler validate the host of every request before next, e.g. around the
+// whole server
+func (v *HostValidator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.check(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,105 @@
+package net
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPConfig settings of the http.Server a Server is served by
+type HTTPConfig struct {
+	// ReadHeaderTimeout for reading request headers, bounds slowloris
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout for reading a whole request, 0 for none
+	ReadTimeout time.Duration
+	// WriteTimeout for writing a response, 0 for none; streaming endpoints
+	// (sse, websockets, long polling) need none or a long one
+	WriteTimeout time.Duration
+	// IdleTimeout keep-alive connections wait for the next request
+	IdleTimeout time.Duration
+	// MaxHeaderBytes request header size limit, 0 for the net/http default
+	MaxHeaderBytes int
+	// DisableKeepAlives close connections after every response
+	DisableKeepAlives bool
+}
+
+// DefaultHTTPConfig defaults that close the slowloris exposure without
+// cutting off streaming endpoints
+var DefaultHTTPConfig = HTTPConfig{
+	ReadHeaderTimeout: 10 * time.Second,
+	IdleTimeout:       120 * time.Second,
+	MaxHeaderBytes:    MB,
+}
+
+// WithHTTPConfig serve with config instead of DefaultHTTPConfig
+func WithHTTPConfig(config HTTPConfig) Option {
+	return func(s *Server) {
+		s.httpConfig = config
+	}
+}
+
+// WithReadHeaderTimeout set HTTPConfig.ReadHeaderTimeout
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.httpConfig.ReadHeaderTimeout = d
+	}
+}
+
+// WithIdleTimeout set HTTPConfig.IdleTimeout
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.httpConfig.IdleTimeout = d
+	}
+}
+
+// WithWriteTimeout set HTTPConfig.WriteTimeout
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.httpConfig.WriteTimeout = d
+	}
+}
+
+// WithKeepAlives enable or disable keep-alive connections
+func WithKeepAlives(enabled bool) Option {
+	return func(s *Server) {
+		s.httpConfig.DisableKeepAlives = !enabled
+	}
+}
+
+// HTTPServer http.Server serving s with its HTTPConfig
+func (s *Server) HTTPServer() *http.Server {
+	c := s.httpConfig
+	hs := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		ConnState:         s.conns.observe,
+	}
+	hs.SetKeepAlivesEnabled(!c.DisableKeepAlives)
+	hs.RegisterOnShutdown(s.closeStreams)
+	return hs
+}
+
+// Serve serve s on l until Shutdown, which stops accepting connections and
+// waits for active requests before running the hooks registered earlier
+func (s *Server) Serve(l net.Listener) error {
+	hs := s.HTTPServer()
+	s.OnShutdown(hs.Shutdown)
+	s.listening()
+	if err := hs.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// ListenAndServe listen on tcp addr and Serve
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
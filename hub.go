@@ -0,0 +1,220 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Hub tracks websocket connections and their rooms
+type Hub struct {
+	// Upgrader used for new connections
+	Upgrader websocket.Upgrader
+	// QueueSize per connection send queue, defaults to WSQueueSize
+	QueueSize int
+	// PingInterval pings are sent at, 0 disables them
+	PingInterval time.Duration
+	// IdleTimeout closes connections that sent neither a message nor a
+	// pong for this long, 0 disables it
+	IdleTimeout time.Duration
+	// MaxMessageSize largest message accepted, 0 means no limit
+	MaxMessageSize int64
+	// Origins cross origin websockets are accepted from, nil accepts
+	// same origin requests only. Browsers send cookies along, so any origin
+	// would let other sites open authenticated sockets.
+	Origins *CORS
+
+	mu      sync.RWMutex
+	conns   map[*Conn]struct{}
+	rooms   map[string]map[*Conn]struct{}
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// NewHub hub closing its connections on server shutdown, before the
+// listeners wait for active requests
+func NewHub(s *Server) *Hub {
+	h := &Hub{
+		QueueSize:      WSQueueSize,
+		PingInterval:   WSPingInterval,
+		IdleTimeout:    WSIdleTimeout,
+		MaxMessageSize: WSMaxMessageSize,
+		conns:          make(map[*Conn]struct{}),
+		rooms:          make(map[string]map[*Conn]struct{}),
+	}
+	h.Upgrader.CheckOrigin = h.checkOrigin
+	if s != nil {
+		s.onStreamsShutdown(h.closeConns)
+		s.OnShutdown(h.Close)
+	}
+	return h
+}
+
+// checkOrigin accept requests without an origin, from the same origin or
+// from one Origins allows
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return h.Origins != nil && h.Origins.Allowed(origin)
+}
+
+// add register c, false once the hub is closing
+func (h *Hub) add(c *Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.conns[c] = struct{}{}
+	h.wg.Add(1)
+	return true
+}
+
+func (h *Hub) remove(c *Conn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	for room := range c.rooms {
+		h.removeFromRoom(c, room)
+	}
+	h.mu.Unlock()
+	h.wg.Done()
+}
+
+func (h *Hub) join(c *Conn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c]; !ok {
+		return
+	}
+	members, ok := h.rooms[room]
+	if !ok {
+		members = make(map[*Conn]struct{})
+		h.rooms[room] = members
+	}
+	members[c] = struct{}{}
+	c.mu.Lock()
+	c.rooms[room] = struct{}{}
+	c.mu.Unlock()
+}
+
+func (h *Hub) leave(c *Conn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeFromRoom(c, room)
+}
+
+// removeFromRoom callers hold h.mu
+func (h *Hub) removeFromRoom(c *Conn, room string) {
+	if members, ok := h.rooms[room]; ok {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+	c.mu.Lock()
+	delete(c.rooms, room)
+	c.mu.Unlock()
+}
+
+// Len number of open connections
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// Rooms rooms with at least one member and their size
+func (h *Hub) Rooms() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ret := make(map[string]int, len(h.rooms))
+	for room, members := range h.rooms {
+		ret[room] = len(members)
+	}
+	return ret
+}
+
+// Broadcast queue msg on every connection, slow consumers are dropped
+func (h *Hub) Broadcast(msg []byte) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+	for _, c := range conns {
+		c.Send(msg)
+	}
+}
+
+// BroadcastRoom queue msg on every connection in room
+func (h *Hub) BroadcastRoom(room string, msg []byte) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+	for _, c := range conns {
+		c.Send(msg)
+	}
+}
+
+// BroadcastJSON Broadcast v encoded as json
+func (h *Hub) BroadcastJSON(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	h.Broadcast(msg)
+	return nil
+}
+
+// closeConns refuse new connections and send a going away close frame to
+// every connection
+func (h *Hub) closeConns() {
+	h.mu.Lock()
+	h.closing = true
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.closeWith(ErrConnClosed, websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+func (h *Hub) isClosing() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.closing
+}
+
+// Close refuse new connections, send a going away close frame to every
+// connection and wait for them to finish or ctx to expire
+func (h *Hub) Close(ctx context.Context) error {
+	h.closeConns()
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,47 @@
+package net
+
+import "context"
+
+// Identity authenticated caller as set by auth decorators
+type Identity struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+	// Tenant the identity belongs to, empty outside multi tenant setups
+	Tenant string
+}
+
+// HasScope reports whether the identity carries scope
+func (i Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the identity carries role
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// WithIdentity store the authenticated identity in context, an enclosing
+// Audit is told about it too
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	if note, ok := ctx.Value(auditKey).(*auditNote); ok {
+		note.identity = &id
+	}
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// IdentityFrom get the authenticated identity
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey).(Identity)
+	return id, ok
+}
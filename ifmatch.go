@@ -0,0 +1,81 @@
+package net
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// precondition errors
+var (
+	ErrPreconditionRequired = fmt.Errorf("If-Match header required")
+	ErrPreconditionFailed   = fmt.Errorf("resource was modified")
+)
+
+// ETag strong etag of the json representation of v, for handlers without
+// a version to derive one from
+func ETag(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// CheckIfMatch compare the If-Match header of r with etag, the current
+// etag of the resource or empty when it does not exist. Requests without
+// the header pass unless required. Comparison is strong, weak etags never
+// match.
+func CheckIfMatch(r *http.Request, etag string, required bool) error {
+	im := r.Header.Get("If-Match")
+	switch {
+	case im == "":
+		if required {
+			return ErrPreconditionRequired
+		}
+		return nil
+	case im == "*":
+		if etag == "" {
+			return ErrPreconditionFailed
+		}
+		return nil
+	case !etagListContains(im, etag, false):
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// PreconditionFailed respond to an error of CheckIfMatch, 428 for missing
+// headers and 412 for mismatches; etag, when known, is sent so clients can
+// tell their copy is stale
+func PreconditionFailed(w http.ResponseWriter, err error, etag string) {
+	status := http.StatusPreconditionFailed
+	if err == ErrPreconditionRequired {
+		status = http.StatusPreconditionRequired
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	res := JSONResult{Success: false, StatusCode: status, Error: err.Error()}
+	res.Write(w)
+}
+
+// RequireIfMatch EndPointDecorator rejecting PUT, PATCH and DELETE
+// requests without If-Match with 428, the endpoint still compares the
+// etag with CheckIfMatch
+func RequireIfMatch(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if r.Header.Get("If-Match") == "" {
+				PreconditionFailed(w, ErrPreconditionRequired, "")
+				return
+			}
+		}
+		e(ctx, w, r)
+	}
+}
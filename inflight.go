@@ -0,0 +1,75 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InFlightRequest request currently being handled
+type InFlightRequest struct {
+	ID       string    `json:"id"`
+	Method   string    `json:"method"`
+	Route    string    `json:"route"`
+	Path     string    `json:"path"`
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration"`
+}
+
+type inFlight struct {
+	mu       sync.Mutex
+	seq      uint64
+	requests map[uint64]InFlightRequest
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{requests: make(map[uint64]InFlightRequest)}
+}
+
+// track register the request, the returned func removes it
+func (f *inFlight) track(ctx context.Context, r *http.Request) func() {
+	req := InFlightRequest{
+		ID:     RequestID(ctx),
+		Method: r.Method,
+		Route:  Route(ctx).Path,
+		Path:   r.URL.Path,
+		Start:  time.Now(),
+	}
+	f.mu.Lock()
+	f.seq++
+	key := f.seq
+	f.requests[key] = req
+	f.mu.Unlock()
+	return func() {
+		f.mu.Lock()
+		delete(f.requests, key)
+		f.mu.Unlock()
+	}
+}
+
+// InFlight snapshot of the requests currently executing, oldest first
+func (s *Server) InFlight() []InFlightRequest {
+	now := time.Now()
+	s.inFlight.mu.Lock()
+	ret := make([]InFlightRequest, 0, len(s.inFlight.requests))
+	for _, req := range s.inFlight.requests {
+		req.Duration = now.Sub(req.Start).String()
+		ret = append(ret, req)
+	}
+	s.inFlight.mu.Unlock()
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Start.Before(ret[j].Start)
+	})
+	return ret
+}
+
+// EnableInFlight mount an endpoint listing in flight requests at path
+func (s *Server) EnableInFlight(path string, auth EndPointDecorator) {
+	s.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, s.InFlight())
+		},
+	))
+}
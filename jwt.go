@@ -0,0 +1,179 @@
+package net
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTMinKeySize shortest HS256 key accepted, the size of the hash as rfc
+// 7518 requires
+const JWTMinKeySize = 32
+
+// jwt errors
+var (
+	ErrJWTKey       = fmt.Errorf("jwt key shorter than %d bytes", JWTMinKeySize)
+	ErrInvalidToken = fmt.Errorf("invalid token")
+	ErrTokenExpired = fmt.Errorf("token expired")
+	ErrTokenRevoked = fmt.Errorf("token revoked")
+)
+
+// JWTClaims claims of the access tokens signed by SignJWT
+type JWTClaims struct {
+	ID        string   `json:"jti,omitempty"`
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  string   `json:"aud,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Tenant    string   `json:"tenant,omitempty"`
+}
+
+// Identity the identity the claims carry
+func (c JWTClaims) Identity() Identity {
+	return Identity{Subject: c.Subject, Roles: c.Roles, Scopes: c.Scopes, Tenant: c.Tenant}
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// SignJWT HS256 token of claims, key must hold at least JWTMinKeySize
+// bytes
+func SignJWT(key []byte, claims JWTClaims) (string, error) {
+	if len(key) < JWTMinKeySize {
+		return "", ErrJWTKey
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(jwtSign(key, signed)), nil
+}
+
+func jwtSign(key []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// ParseJWT verify an HS256 token and its time claims at now, other
+// algorithms and keys shorter than JWTMinKeySize are rejected
+func ParseJWT(key []byte, token string, now time.Time) (JWTClaims, error) {
+	var claims JWTClaims
+	if len(key) < JWTMinKeySize {
+		return claims, ErrJWTKey
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidToken
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil || h.Alg != "HS256" {
+		return claims, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if subtle.ConstantTimeCompare(sig, jwtSign(key, parts[0]+"."+parts[1])) != 1 {
+		return claims, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if claims.ExpiresAt != 0 && now.Unix() >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return claims, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// JWTAuth verifies bearer access tokens and puts their identity in the
+// request context
+type JWTAuth struct {
+	Key []byte
+	// Issuer and Audience must match the claims when set
+	Issuer   string
+	Audience string
+	// Revoked reports whether the token id was revoked, nil skips the check
+	Revoked func(ctx context.Context, id string) (bool, error)
+}
+
+// JWT decorator accepting bearer tokens signed with key, with a key
+// shorter than JWTMinKeySize every request is refused
+func JWT(key []byte) EndPointDecorator {
+	if len(key) < JWTMinKeySize {
+		log.Printf("jwt: %s, refusing every token", ErrJWTKey)
+	}
+	return (&JWTAuth{Key: key}).Decorate
+}
+
+// Verify the claims of a bearer token
+func (a *JWTAuth) Verify(ctx context.Context, token string) (JWTClaims, error) {
+	claims, err := ParseJWT(a.Key, token, ClockFrom(ctx).Now())
+	if err != nil {
+		return claims, err
+	}
+	if (a.Issuer != "" && claims.Issuer != a.Issuer) || (a.Audience != "" && claims.Audience != a.Audience) {
+		return claims, ErrInvalidToken
+	}
+	if a.Revoked != nil && claims.ID != "" {
+		revoked, err := a.Revoked(ctx, claims.ID)
+		if err != nil {
+			return claims, err
+		}
+		if revoked {
+			return claims, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// Decorate EndPointDecorator answering 401 without a valid token
+func (a *JWTAuth) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			NoAccess(w)
+			return
+		}
+		claims, err := a.Verify(ctx, token)
+		if err != nil {
+			NoAccess(w)
+			return
+		}
+		ctx = WithIdentity(ctx, claims.Identity())
+		e(ctx, w, r.WithContext(ctx))
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type lifecycle struct {
+	mu       sync.Mutex
+	shutdown []func(context.Context) error
+	start    []func()
+	started  bool
+	// streams close long lived connections when the listeners shut down
+	streams []func()
+}
+
+// OnStart register fn to run once the server listens, hooks registered
+// after that run right away
+func (s *Server) OnStart(fn func()) {
+	s.lifecycle.mu.Lock()
+	if !s.lifecycle.started {
+		s.lifecycle.start = append(s.lifecycle.start, fn)
+		s.lifecycle.mu.Unlock()
+		return
+	}
+	s.lifecycle.mu.Unlock()
+	fn()
+}
+
+// listening run the start hooks, the first listener being up is enough
+func (s *Server) listening() {
+	s.lifecycle.mu.Lock()
+	if s.lifecycle.started {
+		s.lifecycle.mu.Unlock()
+		return
+	}
+	s.lifecycle.started = true
+	hooks := s.lifecycle.start
+	s.lifecycle.start = nil
+	s.lifecycle.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// OnShutdown register fn to run on Shutdown, hooks run in reverse order
+// of registration
+func (s *Server) OnShutdown(fn func(context.Context) error) {
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+	s.lifecycle.shutdown = append(s.lifecycle.shutdown, fn)
+}
+
+// onStreamsShutdown register fn to end long lived connections, like event
+// streams, as soon as a listener shuts down. http.Server.Shutdown waits for
+// active requests, so they have to end before it rather than after.
+func (s *Server) onStreamsShutdown(fn func()) {
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+	s.lifecycle.streams = append(s.lifecycle.streams, fn)
+}
+
+// closeStreams run the stream hooks, registered with every http.Server
+func (s *Server) closeStreams() {
+	s.lifecycle.mu.Lock()
+	hooks := s.lifecycle.streams
+	s.lifecycle.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// Shutdown run the shutdown hooks, ctx bounds how long they may take.
+// Every hook runs, failures are reported together.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lifecycle.mu.Lock()
+	hooks := s.lifecycle.shutdown
+	s.lifecycle.shutdown = nil
+	s.lifecycle.mu.Unlock()
+	var errs []string
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
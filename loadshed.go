@@ -0,0 +1,157 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Priority of a request for load shedding, higher is shed later
+type Priority int
+
+// request priorities
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityCritical
+)
+
+// load shedding defaults
+const (
+	ShedTarget   = 50 * time.Millisecond
+	ShedInterval = 100 * time.Millisecond
+	ShedMaxWait  = time.Second
+)
+
+// LoadShedder admits at most MaxConcurrent requests at once and queues the
+// rest. When the queueing delay stays above Target for a whole Interval,
+// or the CPU signal exceeds CPULimit, low priority requests are rejected
+// with 503; at twice the target normal ones are too. Critical requests are
+// never shed.
+type LoadShedder struct {
+	// Target queueing delay
+	Target time.Duration
+	// Interval the delay must stay above Target before shedding starts
+	Interval time.Duration
+	// MaxWait longest a request queues before it is rejected
+	MaxWait time.Duration
+	// CPU saturation between 0 and 1, nil disables the cpu signal
+	CPU func() float64
+	// CPULimit saturation above which low priority requests are shed
+	CPULimit float64
+	// Priority of a request, nil treats every request as normal
+	Priority func(*http.Request) Priority
+
+	sem   chan struct{}
+	level int32
+	shed  uint64
+
+	mu       sync.Mutex
+	window   time.Time
+	minDelay time.Duration
+}
+
+// NewLoadShedder shedder admitting maxConcurrent requests at once
+func NewLoadShedder(maxConcurrent int) *LoadShedder {
+	return &LoadShedder{
+		Target:   ShedTarget,
+		Interval: ShedInterval,
+		MaxWait:  ShedMaxWait,
+		CPULimit: 0.9,
+		sem:      make(chan struct{}, maxConcurrent),
+		minDelay: -1,
+	}
+}
+
+// Shed number of requests rejected so far
+func (l *LoadShedder) Shed() uint64 {
+	return atomic.LoadUint64(&l.shed)
+}
+
+// Overloaded reports whether requests are currently being shed
+func (l *LoadShedder) Overloaded() bool {
+	return atomic.LoadInt32(&l.level) > 0
+}
+
+// Decorate EndPointDecorator shedding load
+func (l *LoadShedder) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		clock := ClockFrom(ctx)
+		l.evaluate(clock.Now())
+		prio := PriorityNormal
+		if l.Priority != nil {
+			prio = l.Priority(r)
+		}
+		if prio < PriorityCritical && int32(prio) < atomic.LoadInt32(&l.level) {
+			l.reject(w)
+			return
+		}
+		start := clock.Now()
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			select {
+			case l.sem <- struct{}{}:
+			case <-clock.After(l.MaxWait):
+				l.observe(l.MaxWait)
+				l.reject(w)
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+		defer func() { <-l.sem }()
+		l.observe(clock.Now().Sub(start))
+		e(ctx, w, r)
+	}
+}
+
+func (l *LoadShedder) reject(w http.ResponseWriter) {
+	atomic.AddUint64(&l.shed, 1)
+	w.Header().Set("Retry-After", strconv.Itoa(int((l.Interval+time.Second-1)/time.Second)))
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusServiceUnavailable,
+		Error:      "overloaded",
+	}
+	res.Write(w)
+}
+
+// observe the queueing delay of an admitted request
+func (l *LoadShedder) observe(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.minDelay < 0 || delay < l.minDelay {
+		l.minDelay = delay
+	}
+}
+
+// evaluate close the window once Interval passed: its smallest delay
+// tells whether the queue drained at all, a standing queue means overload
+func (l *LoadShedder) evaluate(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.window.IsZero() {
+		l.window = now
+		return
+	}
+	if now.Sub(l.window) < l.Interval {
+		return
+	}
+	var level int32
+	switch {
+	case l.minDelay > 2*l.Target:
+		level = 2
+	case l.minDelay > l.Target:
+		level = 1
+	}
+	if level == 0 && l.CPU != nil && l.CPU() > l.CPULimit {
+		level = 1
+	}
+	atomic.StoreInt32(&l.level, level)
+	l.window = now
+	l.minDelay = -1
+}
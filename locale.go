@@ -0,0 +1,162 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locales locale negotiation against the locales an application supports
+type Locales struct {
+	// Supported locales as BCP 47 tags, e.g. "en", "en-GB", "nl"
+	Supported []string
+	// Default served when nothing acceptable is supported
+	Default string
+}
+
+// NewLocales negotiate between supported, falling back to def
+func NewLocales(def string, supported ...string) *Locales {
+	return &Locales{Supported: supported, Default: def}
+}
+
+type languageRange struct {
+	tag string
+	q   float64
+}
+
+// parseAcceptLanguage ranges of an Accept-Language header by descending
+// preference, ranges with q=0 are dropped
+func parseAcceptLanguage(header string) []languageRange {
+	var ret []languageRange
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				v, err := strconv.ParseFloat(p[2:], 64)
+				if err != nil || v < 0 || v > 1 {
+					v = 0
+				}
+				q = v
+			}
+		}
+		if q > 0 {
+			ret = append(ret, languageRange{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].q > ret[j].q })
+	return ret
+}
+
+// Negotiate best supported locale for an Accept-Language header. A range
+// matches a supported locale exactly, by prefix ("en-US" is served "en")
+// or by language ("en" is served "en-GB"); "*" takes the default.
+func (l *Locales) Negotiate(header string) string {
+	for _, lr := range parseAcceptLanguage(header) {
+		if lr.tag == "*" {
+			return l.Default
+		}
+		if match := l.match(lr.tag); match != "" {
+			return match
+		}
+	}
+	return l.Default
+}
+
+func (l *Locales) match(tag string) string {
+	for _, s := range l.Supported {
+		if strings.EqualFold(s, tag) {
+			return s
+		}
+	}
+	// en-US is served by en
+	for t := tag; strings.Contains(t, "-"); {
+		t = t[:strings.LastIndexByte(t, '-')]
+		for _, s := range l.Supported {
+			if strings.EqualFold(s, t) {
+				return s
+			}
+		}
+	}
+	// en is served by en-GB
+	lang := strings.SplitN(tag, "-", 2)[0]
+	for _, s := range l.Supported {
+		if strings.EqualFold(strings.SplitN(s, "-", 2)[0], lang) {
+			return s
+		}
+	}
+	return ""
+}
+
+// Decorate EndPointDecorator negotiating the locale of the request, see
+// Locale. Error messages of the response helpers are translated into it
+// when the server has a Translator.
+func (l *Locales) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		locale := l.Negotiate(r.Header.Get("Accept-Language"))
+		h := w.Header()
+		h.Add("Vary", "Accept-Language")
+		if locale != "" {
+			h.Set("Content-Language", locale)
+		}
+		if sw := serverWriterFrom(w); sw != nil {
+			sw.locale = locale
+		}
+		ctx = context.WithValue(ctx, localeKey, locale)
+		e(ctx, w, r.WithContext(ctx))
+	}
+}
+
+// Locale negotiated locale of the request, empty without Locales
+func Locale(ctx context.Context) string {
+	l, _ := ctx.Value(localeKey).(string)
+	return l
+}
+
+// Translator translates messages into a locale
+type Translator interface {
+	Translate(locale, msg string) (string, bool)
+}
+
+// Catalog Translator from a table of locale to message to translation,
+// locales without an entry fall back to their language, "nl-BE" to "nl"
+type Catalog map[string]map[string]string
+
+// Translate msg into locale
+func (c Catalog) Translate(locale, msg string) (string, bool) {
+	for {
+		if t, ok := c[locale][msg]; ok {
+			return t, true
+		}
+		i := strings.LastIndexByte(locale, '-')
+		if i < 0 {
+			return msg, false
+		}
+		locale = locale[:i]
+	}
+}
+
+// WithTranslator translate the error messages of json responses into the
+// locale negotiated by Locales
+func WithTranslator(t Translator) Option {
+	return func(s *Server) {
+		s.translator = t
+	}
+}
+
+// translate msg into the locale of the response written to w
+func translate(w http.ResponseWriter, msg string) string {
+	sw := serverWriterFrom(w)
+	if sw == nil || sw.server.translator == nil || sw.locale == "" {
+		return msg
+	}
+	t, _ := sw.server.translator.Translate(sw.locale, msg)
+	return t
+}
@@ -0,0 +1,88 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LongPoll answer with the result of wait, or 204 No Content when nothing
+// arrived within timeout. wait must return when its context is done.
+func LongPoll(ctx context.Context, w http.ResponseWriter, timeout time.Duration, wait func(context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := wait(ctx)
+	if ctx.Err() == context.DeadlineExceeded {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if ctx.Err() != nil {
+		// client went away
+		return
+	}
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	ResultResponse(w, result)
+}
+
+// LongPollChan LongPoll on a value sent on ch, a closed ch answers 204
+func LongPollChan(ctx context.Context, w http.ResponseWriter, timeout time.Duration, ch <-chan interface{}) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		ResultResponse(w, v)
+	case <-t.C:
+		w.WriteHeader(http.StatusNoContent)
+	case <-ctx.Done():
+	}
+}
+
+// Signal wakes up long polls waiting for a condition to change
+type Signal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// Wait channel closed by the next Notify
+func (s *Signal) Wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	return s.ch
+}
+
+// Notify wake up every current waiter
+func (s *Signal) Notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != nil {
+		close(s.ch)
+		s.ch = nil
+	}
+}
+
+// WaitFor block until cond holds, re-checking on every Notify, or ctx is
+// done
+func (s *Signal) WaitFor(ctx context.Context, cond func() bool) error {
+	for {
+		ch := s.Wait()
+		if cond() {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// default histogram buckets
+var (
+	LatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	SizeBuckets    = []float64{100, 1000, 10000, 100000, MB, 5 * MB, 10 * MB}
+)
+
+type metricLabels struct {
+	route  string
+	method string
+	status int
+	tenant string
+}
+
+func (l metricLabels) String() string {
+	s := fmt.Sprintf(
+		`route="%s",method="%s",status="%d"`,
+		escapeLabel(l.route), escapeLabel(l.method), l.status,
+	)
+	if l.tenant != "" {
+		s += `,tenant="` + escapeLabel(l.tenant) + `"`
+	}
+	return s
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+	// exemplars last traced observation per bucket, +Inf last
+	exemplars []exemplar
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64, traceID string) {
+	bucket := len(h.buckets)
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+			if i < bucket {
+				bucket = i
+			}
+		}
+	}
+	h.sum += v
+	h.count++
+	if traceID != "" {
+		if h.exemplars == nil {
+			h.exemplars = make([]exemplar, len(h.buckets)+1)
+		}
+		h.exemplars[bucket] = exemplar{traceID: traceID, value: v, time: time.Now()}
+	}
+}
+
+func (h *histogram) write(w *bufio.Writer, name, labels string, openMetrics bool) {
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d",
+			name, labels, formatFloat(b), h.counts[i])
+		h.writeExemplar(w, i, openMetrics)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d", name, labels, h.count)
+	h.writeExemplar(w, len(h.buckets), openMetrics)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func (h *histogram) writeExemplar(w *bufio.Writer, bucket int, openMetrics bool) {
+	if openMetrics && h.exemplars != nil && h.exemplars[bucket].traceID != "" {
+		ex := h.exemplars[bucket]
+		fmt.Fprintf(w, " # {trace_id=\"%s\"} %s %s", ex.traceID, formatFloat(ex.value),
+			strconv.FormatFloat(float64(ex.time.UnixNano())/1e9, 'f', 3, 64))
+	}
+	w.WriteByte('\n')
+}
+
+// Metrics request metrics in prometheus exposition format
+type Metrics struct {
+	inFlight int64
+
+	// Namespace prefixes all metric names, defaults to http
+	Namespace      string
+	LatencyBuckets []float64
+	SizeBuckets    []float64
+	// TenantLabel labels request metrics with the tenant, see Tenancy
+	TenantLabel bool
+
+	mu       sync.Mutex
+	requests map[metricLabels]uint64
+	latency  map[metricLabels]*histogram
+	sizes    map[metricLabels]*histogram
+	reqSizes map[metricLabels]*histogram
+	slos     map[string]*sloTracker
+	rejected map[string]uint64
+}
+
+// NewMetrics metrics with default buckets
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Namespace:      "http",
+		LatencyBuckets: LatencyBuckets,
+		SizeBuckets:    SizeBuckets,
+		requests:       make(map[metricLabels]uint64),
+		latency:        make(map[metricLabels]*histogram),
+		sizes:          make(map[metricLabels]*histogram),
+		reqSizes:       make(map[metricLabels]*histogram),
+		rejected:       make(map[string]uint64),
+	}
+}
+
+// ObserveRejectedBody count a request body rejected for its size
+func (m *Metrics) ObserveRejectedBody(route string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected[route]++
+}
+
+// Observe record a finished request
+func (m *Metrics) Observe(route, method string, status int, dur time.Duration, size int64) {
+	m.observe(metricLabels{route: route, method: method, status: status}, dur, size, -1, "")
+}
+
+// ObserveExemplar record a finished request, linking the latency
+// observation to traceID
+func (m *Metrics) ObserveExemplar(route, method string, status int, dur time.Duration, size int64, traceID string) {
+	m.observe(metricLabels{route: route, method: method, status: status}, dur, size, -1, traceID)
+}
+
+// observe a request, reqSize is the request body size or -1 when it was
+// not measured
+func (m *Metrics) observe(l metricLabels, dur time.Duration, size, reqSize int64, traceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[l]++
+	lat, ok := m.latency[l]
+	if !ok {
+		lat = newHistogram(m.LatencyBuckets)
+		m.latency[l] = lat
+	}
+	lat.observe(dur.Seconds(), traceID)
+	sz, ok := m.sizes[l]
+	if !ok {
+		sz = newHistogram(m.SizeBuckets)
+		m.sizes[l] = sz
+	}
+	sz.observe(float64(size), "")
+	if reqSize >= 0 {
+		rs, ok := m.reqSizes[l]
+		if !ok {
+			rs = newHistogram(m.SizeBuckets)
+			m.reqSizes[l] = rs
+		}
+		rs.observe(float64(reqSize), "")
+	}
+	if slo, ok := m.slos[l.route]; ok {
+		slo.observe(time.Now(), l.status, dur)
+	}
+}
+
+// Decorate EndPointDecorator recording request metrics, including the
+// request body size
+func (m *Metrics) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&m.inFlight, 1)
+		defer atomic.AddInt64(&m.inFlight, -1)
+		sink := &requestSink{m: m, contentLength: r.ContentLength}
+		if r.Body != nil && r.Body != http.NoBody {
+			sink.body = &countingBody{ReadCloser: r.Body}
+			r.Body = sink.body
+		}
+		if m.TenantLabel {
+			sink.tenant = Tenant(ctx)
+		}
+		Measure(sink)(e)(ctx, w, r)
+	}
+}
+
+// requestSink Metrics observing one request with its body size and
+// tenant
+type requestSink struct {
+	m             *Metrics
+	tenant        string
+	body          *countingBody
+	contentLength int64
+}
+
+// size of the request body, what was announced when the endpoint did not
+// read all of it
+func (s *requestSink) size() int64 {
+	n := s.contentLength
+	if s.body != nil && s.body.n > n {
+		n = s.body.n
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+func (s *requestSink) Observe(route, method string, status int, dur time.Duration, size int64) {
+	s.m.observe(metricLabels{route: route, method: method, status: status, tenant: s.tenant}, dur, size, s.size(), "")
+}
+
+func (s *requestSink) ObserveExemplar(route, method string, status int, dur time.Duration, size int64, traceID string) {
+	s.m.observe(metricLabels{route: route, method: method, status: status, tenant: s.tenant}, dur, size, s.size(), traceID)
+}
+
+// ServeHTTP serve metrics in the prometheus text format, mount it with
+// server.Handler(http.MethodGet, "/metrics", metrics). Scrapers accepting
+// openmetrics get latency exemplars linking to traces.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		m.write(bw, true)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(bw, false)
+}
+
+// WriteTo write all metrics in the prometheus text format
+func (m *Metrics) WriteTo(w *bufio.Writer) {
+	m.write(w, false)
+}
+
+func (m *Metrics) write(w *bufio.Writer, openMetrics bool) {
+	ns := m.Namespace
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter := ns + "_requests_total"
+	if openMetrics {
+		counter = ns + "_requests"
+	}
+	fmt.Fprintf(w, "# HELP %s Total number of requests.\n", counter)
+	fmt.Fprintf(w, "# TYPE %s counter\n", counter)
+	for _, l := range sortedLabels(m.requests) {
+		fmt.Fprintf(w, "%s_requests_total{%s} %d\n", ns, l, m.requests[l])
+	}
+
+	fmt.Fprintf(w, "# HELP %s_request_duration_seconds Request latency.\n", ns)
+	fmt.Fprintf(w, "# TYPE %s_request_duration_seconds histogram\n", ns)
+	for _, l := range sortedLabels(m.requests) {
+		m.latency[l].write(w, ns+"_request_duration_seconds", l.String(), openMetrics)
+	}
+
+	fmt.Fprintf(w, "# HELP %s_response_size_bytes Response body size.\n", ns)
+	fmt.Fprintf(w, "# TYPE %s_response_size_bytes histogram\n", ns)
+	for _, l := range sortedLabels(m.requests) {
+		m.sizes[l].write(w, ns+"_response_size_bytes", l.String(), openMetrics)
+	}
+
+	fmt.Fprintf(w, "# HELP %s_request_size_bytes Request body size.\n", ns)
+	fmt.Fprintf(w, "# TYPE %s_request_size_bytes histogram\n", ns)
+	for _, l := range sortedLabels(m.requests) {
+		if rs, ok := m.reqSizes[l]; ok {
+			rs.write(w, ns+"_request_size_bytes", l.String(), openMetrics)
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP %s_requests_in_flight Requests currently being served.\n", ns)
+	fmt.Fprintf(w, "# TYPE %s_requests_in_flight gauge\n", ns)
+	fmt.Fprintf(w, "%s_requests_in_flight %d\n", ns, atomic.LoadInt64(&m.inFlight))
+
+	rejected := ns + "_rejected_bodies_total"
+	if openMetrics {
+		rejected = ns + "_rejected_bodies"
+	}
+	fmt.Fprintf(w, "# HELP %s Request bodies rejected for their size.\n", rejected)
+	fmt.Fprintf(w, "# TYPE %s counter\n", rejected)
+	routes := make([]string, 0, len(m.rejected))
+	for route := range m.rejected {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		fmt.Fprintf(w, "%s_rejected_bodies_total{route=\"%s\"} %d\n", ns, escapeLabel(route), m.rejected[route])
+	}
+
+	m.writeSLOs(w, openMetrics)
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+func sortedLabels(set map[metricLabels]uint64) []metricLabels {
+	ret := make([]metricLabels, 0, len(set))
+	for l := range set {
+		ret = append(ret, l)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].route != ret[j].route {
+			return ret[i].route < ret[j].route
+		}
+		if ret[i].method != ret[j].method {
+			return ret[i].method < ret[j].method
+		}
+		if ret[i].status != ret[j].status {
+			return ret[i].status < ret[j].status
+		}
+		return ret[i].tenant < ret[j].tenant
+	})
+	return ret
+}
+
+func routeLabel(ctx context.Context) string {
+	if route := Route(ctx).Path; route != "" {
+		return route
+	}
+	return "unknown"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
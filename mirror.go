@@ -0,0 +1,177 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorHeader set on mirrored requests so the shadow backend can tell
+// them apart
+const MirrorHeader = "X-Mirrored"
+
+// hopHeaders connection level headers not copied to mirrored requests
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Mirror copies a sample of requests to a shadow backend, asynchronously
+// and without affecting the response; the shadow's responses are
+// discarded. Use it to check a re-platformed service against live traffic,
+// e.g. EndPointConfig{mirror.Decorate}.Apply(Proxy(primary)).
+type Mirror struct {
+	Target *url.URL
+	// Rate fraction of requests mirrored, 0 to 1
+	Rate float64
+	// MaxBody requests with larger bodies are not mirrored
+	MaxBody int64
+	// Timeout per mirrored request, 5 seconds when 0
+	Timeout time.Duration
+	// Client sends the copies, http.DefaultClient when nil
+	Client *http.Client
+	// Rand source of randomness for sampling, defaults to math/rand
+	Rand func() float64
+
+	inFlight chan struct{}
+	dropped  uint64
+}
+
+// NewMirror mirror every request to target, at most concurrency mirrored
+// requests are in flight, more are dropped
+func NewMirror(target string, concurrency int) (*Mirror, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Mirror{
+		Target:   u,
+		Rate:     1,
+		MaxBody:  MB,
+		Timeout:  5 * time.Second,
+		Client:   http.DefaultClient,
+		Rand:     rand.Float64,
+		inFlight: make(chan struct{}, concurrency),
+	}, nil
+}
+
+// Dropped mirrored requests dropped because too many were in flight
+func (m *Mirror) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// Decorate EndPointDecorator mirroring the sampled requests. A Mirror
+// literal mirrors one request at a time with http.DefaultClient.
+func (m *Mirror) Decorate(e EndPoint) EndPoint {
+	if m.inFlight == nil {
+		m.inFlight = make(chan struct{}, 1)
+	}
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if m.Rate < 1 && m.rand() >= m.Rate {
+			e(ctx, w, r)
+			return
+		}
+		body, ok := m.copyBody(r)
+		if !ok {
+			e(ctx, w, r)
+			return
+		}
+		// taken before the endpoint may change r, sent after it returned
+		// so the shadow never acts before the primary
+		req := m.request(r, body)
+		Detach(ctx)
+		e(ctx, w, r)
+		if req != nil {
+			m.send(req)
+		}
+	}
+}
+
+func (m *Mirror) rand() float64 {
+	if m.Rand == nil {
+		return rand.Float64()
+	}
+	return m.Rand()
+}
+
+// copyBody buffer the request body for the mirror, the endpoint still
+// reads it whole; false when it is too large to mirror
+func (m *Mirror) copyBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength > m.MaxBody {
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, m.MaxBody+1))
+	rest := io.Reader(r.Body)
+	if err != nil {
+		// the endpoint sees the read error where it happened
+		rest = errReader{err}
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), rest), r.Body}
+	return body, err == nil && int64(len(body)) <= m.MaxBody
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// request copy of r for the shadow backend
+func (m *Mirror) request(r *http.Request, body []byte) *http.Request {
+	target := *m.Target
+	target.Path = singleJoin(m.Target.Path, r.URL.Path)
+	target.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequest(r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		log.Printf("mirror: %s", err)
+		return nil
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Set(MirrorHeader, "1")
+	return req
+}
+
+// send req in the background, dropping it when the mirror is saturated
+func (m *Mirror) send(req *http.Request) {
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+		return
+	}
+	client, timeout := m.Client, m.Timeout
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	go func() {
+		defer func() { <-m.inFlight }()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		res, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			log.Printf("mirror: %s", err)
+			return
+		}
+		drain(res)
+	}()
+}
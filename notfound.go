@@ -0,0 +1,183 @@
+package net
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RouteSuggestions number of routes suggested by the dev mode 404
+const RouteSuggestions = 3
+
+// RouteNotFound result of the dev mode 404, routes close to the requested
+// path with the methods they answer
+type RouteNotFound struct {
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Suggestions []RouteSuggestion `json:"suggestions,omitempty"`
+}
+
+// RouteSuggestion registered pattern near a path no route matched
+type RouteSuggestion struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+// RouteNotAllowed result of the dev mode 405
+type RouteNotAllowed struct {
+	Method  string   `json:"method"`
+	Path    string   `json:"path"`
+	Allowed []string `json:"allowed"`
+}
+
+type routeTable struct {
+	mu     sync.RWMutex
+	routes []RouteInfo
+}
+
+func (t *routeTable) add(route RouteInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, route)
+}
+
+// Routes method and pattern of the endpoints added with AddEndPoint, in
+// the order they were added
+func (s *Server) Routes() []RouteInfo {
+	s.routes.mu.RLock()
+	defer s.routes.mu.RUnlock()
+	return append([]RouteInfo(nil), s.routes.routes...)
+}
+
+// notFound answer unmatched requests, in dev mode with the routes nearest
+// to the requested path
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	if !s.DevMode || s.HideErrors {
+		http.NotFound(w, r)
+		return
+	}
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusNotFound,
+		Error:      http.StatusText(http.StatusNotFound),
+		Result: RouteNotFound{
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Suggestions: s.suggestRoutes(r.URL.Path, RouteSuggestions),
+		},
+	}
+	res.Write(w)
+}
+
+// methodNotAllowed answer requests matching a route for other methods, in
+// dev mode with the allowed ones. The router sets the Allow header before.
+func (s *Server) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if !s.DevMode || s.HideErrors {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var allowed []string
+	for _, m := range strings.Split(w.Header().Get("Allow"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			allowed = append(allowed, m)
+		}
+	}
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusMethodNotAllowed,
+		Error:      http.StatusText(http.StatusMethodNotAllowed),
+		Result:     RouteNotAllowed{Method: r.Method, Path: r.URL.Path, Allowed: allowed},
+	}
+	res.Write(w)
+}
+
+// suggestRoutes at most n registered patterns nearest to path, patterns
+// too far off to be a typo are left out
+func (s *Server) suggestRoutes(path string, n int) []RouteSuggestion {
+	methods := make(map[string][]string)
+	var patterns []string
+	for _, route := range s.Routes() {
+		if _, ok := methods[route.Path]; !ok {
+			patterns = append(patterns, route.Path)
+		}
+		methods[route.Path] = append(methods[route.Path], route.Method)
+	}
+	limit := len(path) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	distances := make(map[string]int, len(patterns))
+	var near []string
+	for _, pattern := range patterns {
+		if d := levenshtein(path, fillPattern(pattern, path)); d <= limit {
+			distances[pattern] = d
+			near = append(near, pattern)
+		}
+	}
+	sort.Slice(near, func(i, j int) bool {
+		if distances[near[i]] != distances[near[j]] {
+			return distances[near[i]] < distances[near[j]]
+		}
+		return near[i] < near[j]
+	})
+	if len(near) > n {
+		near = near[:n]
+	}
+	ret := make([]RouteSuggestion, 0, len(near))
+	for _, pattern := range near {
+		m := methods[pattern]
+		sort.Strings(m)
+		ret = append(ret, RouteSuggestion{Path: pattern, Methods: m})
+	}
+	return ret
+}
+
+// fillPattern pattern with its parameters replaced by the segments of path
+// at their position, so parameters do not count as differences
+func fillPattern(pattern, path string) string {
+	segs := strings.Split(pattern, "/")
+	parts := strings.Split(path, "/")
+	for i, seg := range segs {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') || i >= len(parts) {
+			continue
+		}
+		if seg[0] == '*' {
+			segs[i] = strings.Join(parts[i:], "/")
+			break
+		}
+		segs[i] = parts[i]
+	}
+	return strings.Join(segs, "/")
+}
+
+// levenshtein edit distance between a and b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,388 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPIVersion version of the generated documents
+const OpenAPIVersion = "3.0.3"
+
+// OpenAPIDocument openapi 3 document, the subset generated from routes and
+// understood by request validation
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components,omitempty"`
+}
+
+// OpenAPIInfo document metadata
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIPathItem operations of a path by lower case method
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIOperation single operation
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter path, query or header parameter
+type OpenAPIParameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *Schema     `json:"schema,omitempty"`
+	Example  interface{} `json:"example,omitempty"`
+}
+
+// OpenAPIRequestBody request body by content type
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse response by content type
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType schema of a content type
+type OpenAPIMediaType struct {
+	Schema  *Schema     `json:"schema,omitempty"`
+	Example interface{} `json:"example,omitempty"`
+}
+
+// OpenAPIComponents reusable schemas
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema openapi schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// Operation documentation of an endpoint, Request and Response are zero
+// values of the body types, e.g. CreateUser{}, the response is documented
+// wrapped in the JSONResult envelope
+type Operation struct {
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{}
+	Response    interface{}
+	// Example request body documented and replayed by contract tests
+	Example interface{}
+	// ResponseExample result documented in the success response envelope
+	ResponseExample interface{}
+	// Query parameters the endpoint expects, AddOperation rejects requests
+	// violating them, see QueryParams
+	Query []QueryParam
+	// Status success status, defaults to 200
+	Status int
+}
+
+type apiDoc struct {
+	mu  sync.Mutex
+	ops []documentedRoute
+}
+
+type documentedRoute struct {
+	method string
+	path   string
+	op     Operation
+}
+
+// AddOperation add a documented endpoint to server, see OpenAPI
+func (s *Server) AddOperation(method, path string, op Operation, endpoint EndPoint) {
+	s.Describe(method, path, op)
+	if len(op.Query) > 0 {
+		endpoint = QueryParams(op.Query...)(endpoint)
+	}
+	s.AddEndPoint(method, path, endpoint)
+}
+
+// Describe document a route added, or to be added, with AddEndPoint,
+// replacing what was documented for it before. The description shows in
+// the OpenAPI document and in DescribeRoutes.
+func (s *Server) Describe(method, path string, op Operation) {
+	s.api.mu.Lock()
+	defer s.api.mu.Unlock()
+	for i, route := range s.api.ops {
+		if route.method == method && route.path == path {
+			s.api.ops[i].op = op
+			return
+		}
+	}
+	s.api.ops = append(s.api.ops, documentedRoute{method: method, path: path, op: op})
+}
+
+// OpenAPI document of the routes added with AddOperation
+func (s *Server) OpenAPI(info OpenAPIInfo) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI:    OpenAPIVersion,
+		Info:       info,
+		Paths:      make(map[string]OpenAPIPathItem),
+		Components: OpenAPIComponents{Schemas: make(map[string]*Schema)},
+	}
+	s.api.mu.Lock()
+	defer s.api.mu.Unlock()
+	for _, route := range s.api.ops {
+		path, params := openAPIPath(route.path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = make(OpenAPIPathItem)
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(route.method)] = route.op.document(params, doc.Components.Schemas)
+	}
+	return doc
+}
+
+func (op Operation) document(params []OpenAPIParameter, schemas map[string]*Schema) *OpenAPIOperation {
+	ret := &OpenAPIOperation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Parameters:  params,
+		Responses:   make(map[string]OpenAPIResponse),
+	}
+	for _, p := range op.Query {
+		ret.Parameters = append(ret.Parameters, p.document())
+	}
+	if op.Request != nil {
+		ret.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {
+					Schema:  schemaOf(reflect.TypeOf(op.Request), schemas),
+					Example: op.Example,
+				},
+			},
+		}
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var result *Schema
+	if op.Response != nil {
+		result = schemaOf(reflect.TypeOf(op.Response), schemas)
+	}
+	success := OpenAPIMediaType{Schema: envelopeSchema(result)}
+	if op.ResponseExample != nil {
+		success.Example = JSONResult{Success: true, Result: op.ResponseExample}
+	}
+	ret.Responses[fmt.Sprint(status)] = OpenAPIResponse{
+		Description: http.StatusText(status),
+		Content:     map[string]OpenAPIMediaType{"application/json": success},
+	}
+	ret.Responses["default"] = OpenAPIResponse{
+		Description: "error",
+		Content:     map[string]OpenAPIMediaType{"application/json": {Schema: envelopeSchema(nil)}},
+	}
+	return ret
+}
+
+// openAPIPath convert a router pattern to an openapi path, /users/:id
+// becomes /users/{id}
+func openAPIPath(path string) (string, []OpenAPIParameter) {
+	var params []OpenAPIParameter
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		params = append(params, OpenAPIParameter{
+			Name:     seg[1:],
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+		segments[i] = "{" + seg[1:] + "}"
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func envelopeSchema(result *Schema) *Schema {
+	ret := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"success": {Type: "boolean"},
+			"error":   {Type: "string"},
+		},
+		Required: []string{"success"},
+	}
+	if result != nil {
+		ret.Properties["result"] = result
+	}
+	return ret
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf schema of t following encoding/json rules, named structs are
+// added to schemas and referenced
+func schemaOf(t reflect.Type, schemas map[string]*Schema) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := schemaOf(t.Elem(), schemas)
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := t.Name()
+		if _, ok := schemas[name]; !ok {
+			// placeholder first so recursive types terminate
+			schemas[name] = &Schema{}
+			*schemas[name] = *structSchema(t, schemas)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]*Schema) *Schema {
+	ret := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := structSchema(ft, schemas)
+				for k, v := range embedded.Properties {
+					ret.Properties[k] = v
+				}
+				ret.Required = append(ret.Required, embedded.Required...)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ret.Properties[name] = schemaOf(ft, schemas)
+		if !strings.Contains(opts, "omitempty") && ft.Kind() != reflect.Ptr {
+			ret.Required = append(ret.Required, name)
+		}
+	}
+	return ret
+}
+
+// EnableOpenAPI mount the generated document at path, e.g. /openapi.json
+func (s *Server) EnableOpenAPI(path string, info OpenAPIInfo) {
+	s.AddEndPoint(http.MethodGet, path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		if err := json.NewEncoder(w).Encode(s.OpenAPI(info)); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// SwaggerUIAssets base url the swagger ui page loads its scripts and
+// styles from, point it at a self hosted copy for offline deployments
+var SwaggerUIAssets = "https://unpkg.com/swagger-ui-dist@5"
+
+// EnableSwaggerUI mount a swagger ui page at path rendering the document
+// served at specPath
+func (s *Server) EnableSwaggerUI(path, specPath string) {
+	page := fmt.Sprintf(swaggerUIPage, SwaggerUIAssets, SwaggerUIAssets, specPath)
+	s.AddEndPoint(http.MethodGet, path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		fmt.Fprint(w, page)
+	})
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API</title>
+<link rel="stylesheet" href="%s/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="%s/swagger-ui-bundle.js"></script>
+<script>
+window.onload = function() {
+	SwaggerUIBundle({url: %q, dom_id: "#swagger-ui"});
+};
+</script>
+</body>
+</html>
+`
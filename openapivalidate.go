@@ -0,0 +1,424 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError single violation of a request against its schema
+type ValidationError struct {
+	// In path, query, header or body
+	In string `json:"in"`
+	// Field parameter name or json path in the body
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// LoadOpenAPI read a json or yaml openapi document by extension
+func LoadOpenAPI(path string) (*OpenAPIDocument, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var tree interface{}
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if data, err = json.Marshal(tree); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	doc := &OpenAPIDocument{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return doc, nil
+}
+
+// OpenAPIValidator validates requests against an openapi document before
+// endpoints run. Operations are matched on the route the endpoint was
+// added with, refs are only resolved for component schemas.
+type OpenAPIValidator struct {
+	doc *OpenAPIDocument
+	// Strict rejects requests for operations missing from the document
+	Strict bool
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// NewOpenAPIValidator validator for doc
+func NewOpenAPIValidator(doc *OpenAPIDocument) *OpenAPIValidator {
+	return &OpenAPIValidator{doc: doc, patterns: make(map[string]*regexp.Regexp)}
+}
+
+// Decorate EndPointDecorator answering invalid requests with a 400 listing
+// every violation
+func (v *OpenAPIValidator) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		route := Route(ctx)
+		path, _ := openAPIPath(route.Path)
+		op := v.doc.Paths[path][strings.ToLower(route.Method)]
+		if op == nil {
+			if v.Strict {
+				BadRequest(w, fmt.Errorf("operation %s %s not in spec", route.Method, path))
+				return
+			}
+			e(ctx, w, r)
+			return
+		}
+		errs, err := v.validate(ctx, op, r)
+		if err == ErrBodyTooLarge {
+			SizeResponse(w, err)
+			return
+		}
+		if err != nil {
+			BadRequest(w, err)
+			return
+		}
+		if len(errs) > 0 {
+			validationFailed(w, errs)
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+func (v *OpenAPIValidator) validate(ctx context.Context, op *OpenAPIOperation, r *http.Request) ([]ValidationError, error) {
+	var errs []ValidationError
+	params, _ := Params(ctx)
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			if val := params.ByName(p.Name); val != "" {
+				values = []string{strings.TrimPrefix(val, "/")}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header[http.CanonicalHeaderKey(p.Name)]
+		default:
+			continue
+		}
+		if len(values) == 0 {
+			if p.Required {
+				errs = append(errs, ValidationError{In: p.In, Field: p.Name, Message: "required"})
+			}
+			continue
+		}
+		if p.Schema == nil {
+			continue
+		}
+		val, err := parseParam(v.resolve(p.Schema), values)
+		if err != nil {
+			errs = append(errs, ValidationError{In: p.In, Field: p.Name, Message: err.Error()})
+			continue
+		}
+		for _, msg := range v.check(p.Schema, val, "") {
+			errs = append(errs, ValidationError{In: p.In, Field: p.Name, Message: msg.Message})
+		}
+	}
+	if op.RequestBody == nil {
+		return errs, nil
+	}
+	empty, err := emptyBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		if op.RequestBody.Required {
+			errs = append(errs, ValidationError{In: "body", Message: "required"})
+		}
+		return errs, nil
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	media, ok := op.RequestBody.Content[ct]
+	if !ok {
+		errs = append(errs, ValidationError{
+			In:      "body",
+			Message: fmt.Sprintf("unsupported content type %q", ct),
+		})
+		return errs, nil
+	}
+	// only json bodies with a schema are buffered, others stream through
+	if media.Schema == nil || !strings.HasSuffix(ct, "json") {
+		return errs, nil
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		errs = append(errs, ValidationError{In: "body", Message: err.Error()})
+		return errs, nil
+	}
+	return append(errs, v.check(media.Schema, doc, "")...), nil
+}
+
+// emptyBody whether r comes without a body, peeking a byte when the length
+// is unknown
+func emptyBody(r *http.Request) (bool, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return true, nil
+	}
+	if r.ContentLength > 0 {
+		return false, nil
+	}
+	var b [1]byte
+	n, err := io.ReadFull(r.Body, b[:])
+	if err == io.EOF {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b[:n]), r.Body), r.Body}
+	return false, nil
+}
+
+// parseParam convert raw parameter values to the json representation of
+// schema so they validate like body values
+func parseParam(s *Schema, values []string) (interface{}, error) {
+	if s.Type == "array" {
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		ret := make([]interface{}, len(values))
+		item := &Schema{}
+		if s.Items != nil {
+			item = s.Items
+		}
+		for i, raw := range values {
+			val, err := parseParam(item, []string{raw})
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = val
+		}
+		return ret, nil
+	}
+	raw := values[0]
+	switch s.Type {
+	case "integer", "number":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil && s.Type == "integer" {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+func (v *OpenAPIValidator) resolve(s *Schema) *Schema {
+	for i := 0; s.Ref != "" && i < 32; i++ {
+		ref, ok := v.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			return &Schema{}
+		}
+		s = ref
+	}
+	return s
+}
+
+func (v *OpenAPIValidator) pattern(p string) (*regexp.Regexp, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if re, ok := v.patterns[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	v.patterns[p] = re
+	return re, nil
+}
+
+// check validate a decoded json value against s, field is the json path
+// of val
+func (v *OpenAPIValidator) check(s *Schema, val interface{}, field string) []ValidationError {
+	s = v.resolve(s)
+	fail := func(format string, args ...interface{}) []ValidationError {
+		return []ValidationError{{In: "body", Field: field, Message: fmt.Sprintf(format, args...)}}
+	}
+	if val == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fail("must not be null")
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, val) {
+		return fail("must be one of %v", s.Enum)
+	}
+	switch s.Type {
+	case "object":
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		var errs []ValidationError
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, ValidationError{In: "body", Field: joinField(field, name), Message: "required"})
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop := obj[name]
+			if ps, ok := s.Properties[name]; ok {
+				errs = append(errs, v.check(ps, prop, joinField(field, name))...)
+			} else if s.AdditionalProperties != nil {
+				errs = append(errs, v.check(s.AdditionalProperties, prop, joinField(field, name))...)
+			}
+		}
+		return errs
+	case "array":
+		arr, ok := val.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		var errs []ValidationError
+		if s.Items != nil {
+			for i, item := range arr {
+				errs = append(errs, v.check(s.Items, item, fmt.Sprintf("%s[%d]", field, i))...)
+			}
+		}
+		return errs
+	case "string":
+		str, ok := val.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		n := len([]rune(str))
+		if s.MinLength != nil && n < *s.MinLength {
+			return fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := v.pattern(s.Pattern)
+			if err != nil {
+				return fail("invalid pattern in spec: %s", err)
+			}
+			if !re.MatchString(str) {
+				return fail("must match %s", s.Pattern)
+			}
+		}
+	case "integer", "number":
+		f, ok := val.(float64)
+		if !ok {
+			return fail("must be a %s", s.Type)
+		}
+		if s.Type == "integer" && f != math.Trunc(f) {
+			return fail("must be an integer")
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fail("must be at least %s", formatFloat(*s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fail("must be at most %s", formatFloat(*s.Maximum))
+		}
+	case "boolean":
+		if _, ok := val.(bool); !ok {
+			return fail("must be a boolean")
+		}
+	}
+	return nil
+}
+
+func inEnum(enum []interface{}, val interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(val) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// ValidateResponse check a response to the operation at path, in openapi
+// form like /users/{id}, against the declared statuses and schemas
+func (v *OpenAPIValidator) ValidateResponse(method, path string, status int, contentType string, body []byte) []ValidationError {
+	fail := func(format string, args ...interface{}) []ValidationError {
+		return []ValidationError{{In: "response", Message: fmt.Sprintf(format, args...)}}
+	}
+	op := v.doc.Paths[path][strings.ToLower(method)]
+	if op == nil {
+		return fail("operation %s %s not in spec", method, path)
+	}
+	code := strconv.Itoa(status)
+	res, ok := op.Responses[code]
+	if !ok {
+		res, ok = op.Responses[code[:1]+"XX"]
+	}
+	if !ok {
+		res, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fail("status %d not declared", status)
+	}
+	if len(res.Content) == 0 {
+		return nil
+	}
+	ct, _, _ := mime.ParseMediaType(contentType)
+	media, ok := res.Content[ct]
+	if !ok {
+		return fail("undeclared content type %q", ct)
+	}
+	if media.Schema == nil || !strings.HasSuffix(ct, "json") {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fail("invalid json: %s", err)
+	}
+	errs := v.check(media.Schema, doc, "")
+	for i := range errs {
+		errs[i].In = "response"
+	}
+	return errs
+}
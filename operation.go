@@ -0,0 +1,250 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OperationTTL how long finished operations are kept by default
+const OperationTTL = 24 * time.Hour
+
+// ErrOperationNotFound unknown or expired operation
+var ErrOperationNotFound = fmt.Errorf("operation not found")
+
+// OperationState stage of a long running operation
+type OperationState string
+
+// operation states
+const (
+	OperationPending   OperationState = "pending"
+	OperationRunning   OperationState = "running"
+	OperationSucceeded OperationState = "succeeded"
+	OperationFailed    OperationState = "failed"
+)
+
+// OperationStatus state of a long running operation started by an endpoint
+type OperationStatus struct {
+	ID    string         `json:"id"`
+	State OperationState `json:"state"`
+	// Progress fraction done between 0 and 1 as reported by the task
+	Progress float64         `json:"progress"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	// Subject identity that started the operation, only it may poll it
+	Subject   string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Done reports whether the operation finished
+func (o OperationStatus) Done() bool {
+	return o.State == OperationSucceeded || o.State == OperationFailed
+}
+
+// OperationStore keeps operation state, shared stores let any instance
+// answer status polls
+type OperationStore interface {
+	SaveOperation(ctx context.Context, op OperationStatus) error
+	GetOperation(ctx context.Context, id string) (OperationStatus, error)
+}
+
+// MemoryOperationStore in process OperationStore
+type MemoryOperationStore struct {
+	mu  sync.RWMutex
+	ops map[string]OperationStatus
+}
+
+// NewMemoryOperationStore empty store
+func NewMemoryOperationStore() *MemoryOperationStore {
+	return &MemoryOperationStore{ops: make(map[string]OperationStatus)}
+}
+
+// SaveOperation store op
+func (m *MemoryOperationStore) SaveOperation(ctx context.Context, op OperationStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops[op.ID] = op
+	return nil
+}
+
+// GetOperation operation id
+func (m *MemoryOperationStore) GetOperation(ctx context.Context, id string) (OperationStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	op, ok := m.ops[id]
+	if !ok {
+		return op, ErrOperationNotFound
+	}
+	return op, nil
+}
+
+// Cleanup drop operations finished before t
+func (m *MemoryOperationStore) Cleanup(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, op := range m.ops {
+		if op.Done() && op.UpdatedAt.Before(t) {
+			delete(m.ops, id)
+		}
+	}
+}
+
+// OperationFunc work of an operation, report records progress between 0
+// and 1, the returned result is json encoded into the operation
+type OperationFunc func(ctx context.Context, report func(progress float64)) (interface{}, error)
+
+// Operations runs long running work on the server worker pool, see
+// Server.Go. Endpoints answer 202 with the url to poll for status.
+type Operations struct {
+	Store OperationStore
+	// TTL finished operations are reported for, defaults to OperationTTL
+	TTL time.Duration
+
+	server *Server
+	path   string
+}
+
+// NewOperations operations run by s, mount the status endpoint with
+// EnableOperations
+func NewOperations(s *Server, store OperationStore) *Operations {
+	return &Operations{Store: store, TTL: OperationTTL, server: s, path: "/operations"}
+}
+
+// OperationAccepted body of the 202 response
+type OperationAccepted struct {
+	ID        string `json:"id"`
+	StatusURL string `json:"status_url"`
+}
+
+// Start run fn in the background and answer 202 with its status url in
+// the Location header. The task context is cancelled on server shutdown,
+// not when the request ends, and carries the caller identity.
+func (o *Operations) Start(ctx context.Context, w http.ResponseWriter, fn OperationFunc) {
+	// fn often closes over the request context and runs past the endpoint
+	ctx = Detach(ctx)
+	now := ClockFrom(ctx).Now()
+	op := OperationStatus{
+		ID:        newRequestID(),
+		State:     OperationPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	id, hasIdentity := IdentityFrom(ctx)
+	op.Subject = id.Subject
+	if err := o.Store.SaveOperation(ctx, op); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	clock := ClockFrom(ctx)
+	err := o.server.Go(func(tctx context.Context) {
+		if hasIdentity {
+			tctx = WithIdentity(tctx, id)
+		}
+		o.run(ClockContext(tctx, clock), op, fn)
+	})
+	if err != nil {
+		op.State = OperationFailed
+		op.Error = err.Error()
+		o.save(ctx, op)
+		res := JSONResult{Success: false, StatusCode: http.StatusServiceUnavailable, Error: err.Error()}
+		res.Write(w)
+		return
+	}
+	url := o.path + "/" + op.ID
+	w.Header().Set("Location", url)
+	res := JSONResult{
+		Success:    true,
+		StatusCode: http.StatusAccepted,
+		Result:     OperationAccepted{ID: op.ID, StatusURL: url},
+	}
+	res.Write(w)
+}
+
+func (o *Operations) run(ctx context.Context, op OperationStatus, fn OperationFunc) {
+	clock := ClockFrom(ctx)
+	op.State = OperationRunning
+	op.UpdatedAt = clock.Now()
+	o.save(ctx, op)
+	report := func(progress float64) {
+		op.Progress = progress
+		op.UpdatedAt = clock.Now()
+		o.save(ctx, op)
+	}
+	result, err := o.call(ctx, fn, report)
+	if err == nil && result != nil {
+		op.Result, err = json.Marshal(result)
+	}
+	op.UpdatedAt = clock.Now()
+	if err != nil {
+		op.State = OperationFailed
+		op.Error = err.Error()
+	} else {
+		op.State = OperationSucceeded
+		op.Progress = 1
+	}
+	// the task context may be cancelled, the outcome is still recorded
+	o.save(context.Background(), op)
+}
+
+// call fn, a panic fails the operation and is reported like panics of
+// other tasks
+func (o *Operations) call(ctx context.Context, fn OperationFunc, report func(float64)) (result interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("operation panic: %+v", v)
+			o.server.reportTaskPanic(v)
+			err = fmt.Errorf("operation panicked")
+		}
+	}()
+	return fn(ctx, report)
+}
+
+func (o *Operations) save(ctx context.Context, op OperationStatus) {
+	if err := o.Store.SaveOperation(ctx, op); err != nil {
+		log.Printf("operation %s: %s", op.ID, err)
+	}
+}
+
+// Get operation id, operations finished longer than TTL ago are not found
+func (o *Operations) Get(ctx context.Context, id string) (OperationStatus, error) {
+	op, err := o.Store.GetOperation(ctx, id)
+	if err != nil {
+		return op, err
+	}
+	if op.Done() && o.TTL > 0 && ClockFrom(ctx).Now().Sub(op.UpdatedAt) > o.TTL {
+		return OperationStatus{}, ErrOperationNotFound
+	}
+	return op, nil
+}
+
+// EnableOperations mount GET path/:id reporting the state, progress and
+// result of an operation. Operations started by an authenticated caller
+// are only reported to the same subject.
+func (s *Server) EnableOperations(path string, o *Operations, auth EndPointDecorator) {
+	o.path = path
+	s.AddEndPoint(http.MethodGet, path+"/:id", EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			params, _ := Params(ctx)
+			op, err := o.Get(ctx, params.ByName("id"))
+			if err == nil && op.Subject != "" {
+				if id, _ := IdentityFrom(ctx); id.Subject != op.Subject {
+					err = ErrOperationNotFound
+				}
+			}
+			switch err {
+			case nil:
+				ResultResponse(w, op)
+			case ErrOperationNotFound:
+				res := JSONResult{Success: false, StatusCode: http.StatusNotFound, Error: err.Error()}
+				res.Write(w)
+			default:
+				ErrorResponse(w, err)
+			}
+		},
+	))
+}
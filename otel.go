@@ -0,0 +1,99 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OtelMetrics request measurements as opentelemetry instruments, the otel
+// counterpart of Metrics for OTLP pipelines
+type OtelMetrics struct {
+	requests metric.Int64Counter
+	duration metric.Float64Histogram
+	inFlight metric.Int64UpDownCounter
+	size     metric.Int64Histogram
+}
+
+// NewOtelMetrics create the request instruments on meter
+func NewOtelMetrics(meter metric.Meter) (*OtelMetrics, error) {
+	requests, err := meter.Int64Counter(
+		"http.server.request.count",
+		metric.WithDescription("Total number of requests."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithDescription("Request latency."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	inFlight, err := meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("Requests currently being served."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	size, err := meter.Int64Histogram(
+		"http.server.response.body.size",
+		metric.WithDescription("Response body size."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &OtelMetrics{
+		requests: requests,
+		duration: duration,
+		inFlight: inFlight,
+		size:     size,
+	}, nil
+}
+
+// Decorate EndPointDecorator recording request measurements
+func (m *OtelMetrics) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		route := routeLabel(ctx)
+		active := metric.WithAttributes(
+			attribute.String("http.route", route),
+			attribute.String("http.request.method", r.Method),
+		)
+		m.inFlight.Add(ctx, 1, active)
+		begin := time.Now()
+		rec := newResponseRecorder(w)
+		defer func() {
+			m.inFlight.Add(ctx, -1, active)
+			err := recover()
+			status := requestStatus(ctx, rec, err)
+			if err != nil {
+				defer panic(err)
+			}
+			attrs := metric.WithAttributes(
+				attribute.String("http.route", route),
+				attribute.String("http.request.method", r.Method),
+				attribute.Int("http.response.status_code", status),
+			)
+			// the request context may already be canceled, measurements
+			// must still be recorded, the span is kept for exemplars
+			mctx := trace.ContextWithSpanContext(
+				context.Background(),
+				trace.SpanContextFromContext(ctx),
+			)
+			m.requests.Add(mctx, 1, attrs)
+			m.duration.Record(mctx, time.Since(begin).Seconds(), attrs)
+			m.size.Record(mctx, rec.size, attrs)
+		}()
+		e(ctx, rec, r)
+	}
+}
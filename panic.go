@@ -0,0 +1,152 @@
+package net
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// PanicReport recovered panic with request metadata
+type PanicReport struct {
+	Value      interface{}
+	Stack      []byte
+	Method     string
+	URL        string
+	RemoteAddr string
+	Header     http.Header
+	Time       time.Time
+}
+
+// PanicReporter forwards recovered panics to error tracking
+type PanicReporter interface {
+	ReportPanic(PanicReport)
+}
+
+// PanicReporterFunc func adapter for PanicReporter
+type PanicReporterFunc func(PanicReport)
+
+// ReportPanic calls f
+func (f PanicReporterFunc) ReportPanic(p PanicReport) {
+	f(p)
+}
+
+func (s *Server) reportPanic(r *http.Request, v interface{}) {
+	if s.PanicReporter == nil {
+		return
+	}
+	report := PanicReport{
+		Value:      v,
+		Stack:      debug.Stack(),
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header,
+		Time:       time.Now(),
+	}
+	// a failing reporter must not take the error response down with it
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("panic reporter: %+v", err)
+		}
+	}()
+	s.PanicReporter.ReportPanic(report)
+}
+
+// SentryReporter posts panics to a sentry compatible store endpoint
+type SentryReporter struct {
+	Client      *http.Client
+	Environment string
+	Release     string
+	endpoint    string
+	auth        string
+}
+
+// NewSentryReporter reporter from a sentry dsn,
+// https://<key>@<host>/<project>
+func NewSentryReporter(dsn string) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("sentry dsn without key")
+	}
+	project := strings.Trim(u.Path, "/")
+	if project == "" {
+		return nil, fmt.Errorf("sentry dsn without project")
+	}
+	auth := "Sentry sentry_version=7, sentry_client=mjolk-net/1.0, sentry_key=" +
+		u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return &SentryReporter{
+		Client:   &http.Client{Timeout: 5 * time.Second},
+		endpoint: fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		auth:     auth,
+	}, nil
+}
+
+// ReportPanic send the panic as a sentry event, delivery is async
+func (s *SentryReporter) ReportPanic(p PanicReport) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	header := p.Header.Clone()
+	for _, k := range SensitiveHeaders {
+		header.Del(k)
+	}
+	headers := make(map[string]string, len(header))
+	for k := range header {
+		headers[k] = header.Get(k)
+	}
+	event := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   p.Time.UTC().Format("2006-01-02T15:04:05"),
+		"level":       "fatal",
+		"platform":    "go",
+		"logger":      "net.panic",
+		"message":     fmt.Sprintf("%+v", p.Value),
+		"environment": s.Environment,
+		"release":     s.Release,
+		"request": map[string]interface{}{
+			"method":  p.Method,
+			"url":     p.URL,
+			"headers": headers,
+			"env":     map[string]string{"REMOTE_ADDR": p.RemoteAddr},
+		},
+		"extra": map[string]string{"stacktrace": string(p.Stack)},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("sentry: %s", err)
+		return
+	}
+	go s.send(body)
+}
+
+func (s *SentryReporter) send(body []byte) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("sentry: %s", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	res, err := s.Client.Do(req)
+	if err != nil {
+		log.Printf("sentry: %s", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Printf("sentry: unexpected status %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,464 @@
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patch media types
+const (
+	JSONPatchType  = "application/json-patch+json"
+	MergePatchType = "application/merge-patch+json"
+)
+
+// patch errors, see PatchFailed for the status each maps to
+var (
+	ErrPatchType   = fmt.Errorf("patch must be %s or %s", JSONPatchType, MergePatchType)
+	ErrPatchTest   = fmt.Errorf("patch test failed")
+	ErrPatchTarget = fmt.Errorf("patch target does not exist")
+)
+
+// Validator is implemented by patch targets checking their own state
+type Validator interface {
+	Validate() error
+}
+
+// PatchOp one operation of a json patch, RFC 6902
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// invalidPatch patch that is well formed json but can not be applied
+type invalidPatch struct {
+	err error
+}
+
+func (e invalidPatch) Error() string { return e.err.Error() }
+
+// Patch apply the json patch or merge patch body of r to v, a pointer to
+// the current state. The patched document is decoded into a copy of v with
+// the fields json decodes zeroed, so removed members end up zero while
+// unexported and `json:"-"` fields keep their value. Types with their own
+// marshalers must round-trip through json. The copy is validated when it
+// implements Validator; v is only changed when everything succeeds.
+func Patch(r *http.Request, v interface{}) error {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != JSONPatchType && mt != MergePatchType {
+		return ErrPatchType
+	}
+	patch, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if mt == JSONPatchType {
+		doc, err = ApplyJSONPatch(doc, patch)
+	} else {
+		doc, err = ApplyMergePatch(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("patch target must be a non nil pointer")
+	}
+	fresh := reflect.New(rv.Elem().Type())
+	if rv.Elem().Kind() == reflect.Struct && !fresh.Type().Implements(unmarshalerType) {
+		fresh.Elem().Set(rv.Elem())
+		clearJSONFields(fresh.Elem())
+	}
+	if err := json.Unmarshal(doc, fresh.Interface()); err != nil {
+		return invalidPatch{err}
+	}
+	if val, ok := fresh.Interface().(Validator); ok {
+		if err := val.Validate(); err != nil {
+			return invalidPatch{err}
+		}
+	}
+	rv.Elem().Set(fresh.Elem())
+	return nil
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// clearJSONFields zero the fields of struct v that json decodes into,
+// nested structs are cleared field by field so their hidden fields stay
+func clearJSONFields(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("json") == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Type.Kind() == reflect.Struct && (f.Anonymous || f.IsExported()) &&
+			!reflect.PtrTo(f.Type).Implements(unmarshalerType) {
+			clearJSONFields(fv)
+			continue
+		}
+		if f.IsExported() && fv.CanSet() {
+			fv.Set(reflect.Zero(f.Type))
+		}
+	}
+}
+
+// PatchFailed respond to an error of Patch: 415 for other media types, 409
+// for failed tests, 422 for patches that can not be applied or leave an
+// invalid state and 400 for malformed bodies
+func PatchFailed(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch err.(type) {
+	case invalidPatch:
+		status = http.StatusUnprocessableEntity
+	}
+	switch err {
+	case ErrPatchType:
+		status = http.StatusUnsupportedMediaType
+		w.Header().Set("Accept-Patch", JSONPatchType+", "+MergePatchType)
+	case ErrPatchTest:
+		status = http.StatusConflict
+	case ErrPatchTarget:
+		status = http.StatusUnprocessableEntity
+	case ErrBodyTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	}
+	res := JSONResult{Success: false, StatusCode: status, Error: err.Error()}
+	res.Write(w)
+}
+
+// ApplyJSONPatch apply the RFC 6902 patch to doc, operations apply in
+// order and the patch fails as a whole
+func ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	var ops []PatchOp
+	if err := decodeJSON(patch, &ops); err != nil {
+		return nil, err
+	}
+	root, err := decodePatchDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if root, err = applyPatchOp(root, op); err != nil {
+			if err == ErrPatchTest || err == ErrPatchTarget {
+				return nil, err
+			}
+			return nil, invalidPatch{fmt.Errorf("op %d: %s", i, err)}
+		}
+	}
+	return json.Marshal(root)
+}
+
+// ApplyMergePatch apply the RFC 7386 merge patch to doc, null members are
+// removed and objects merged recursively
+func ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	var p interface{}
+	if err := decodeJSON(patch, &p); err != nil {
+		return nil, err
+	}
+	root, err := decodePatchDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(root, p))
+}
+
+func decodePatchDoc(doc []byte) (interface{}, error) {
+	var root interface{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+func applyPatchOp(root interface{}, op PatchOp) (interface{}, error) {
+	path, err := jsonPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	value := func() (interface{}, error) {
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%s needs a value", op.Op)
+		}
+		return decodePatchDoc(op.Value)
+	}
+	switch op.Op {
+	case "add", "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerSet(root, path, v, op.Op == "replace")
+	case "remove":
+		root, _, err = pointerRemove(root, path)
+		return root, err
+	case "move", "copy":
+		from, err := jsonPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, fmt.Errorf("can not move %s into itself", op.From)
+			}
+			root, v, err = pointerRemove(root, from)
+		} else {
+			v, err = pointerGet(root, from)
+			if err == nil {
+				// copies must not share maps and slices with the source
+				v, err = deepCopyJSON(v)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return pointerSet(root, path, v, false)
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := pointerGet(root, path)
+		if err != nil {
+			return nil, ErrPatchTest
+		}
+		if !jsonEqual(got, v) {
+			return nil, ErrPatchTest
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// jsonPointer split an RFC 6901 pointer into unescaped tokens
+func jsonPointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("pointer %q must start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = pointerUnescaper.Replace(t)
+	}
+	return tokens, nil
+}
+
+// arrayIndex index token into an array of n elements, "-" is n
+func arrayIndex(token string, n int, appending bool) (int, error) {
+	if token == "-" && appending {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("bad array index %q", token)
+	}
+	max := n - 1
+	if appending {
+		max = n
+	}
+	if i > max {
+		return 0, ErrPatchTarget
+	}
+	return i, nil
+}
+
+func pointerGet(node interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[t]
+			if !ok {
+				return nil, ErrPatchTarget
+			}
+			node = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, ErrPatchTarget
+		}
+	}
+	return node, nil
+}
+
+// pointerSet add or replace the value at path, returning the new root
+func pointerSet(node interface{}, path []string, v interface{}, replace bool) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	t, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[t]
+		if len(rest) == 0 {
+			if replace && !ok {
+				return nil, ErrPatchTarget
+			}
+			n[t] = v
+			return n, nil
+		}
+		if !ok {
+			return nil, ErrPatchTarget
+		}
+		child, err := pointerSet(child, rest, v, replace)
+		if err != nil {
+			return nil, err
+		}
+		n[t] = child
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(t, len(n), len(rest) == 0 && !replace)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			if replace {
+				n[i] = v
+				return n, nil
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = v
+			return n, nil
+		}
+		child, err := pointerSet(n[i], rest, v, replace)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, ErrPatchTarget
+}
+
+// pointerRemove remove the value at path, returning the new root and the
+// removed value
+func pointerRemove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("can not remove the whole document")
+	}
+	t, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[t]
+		if !ok {
+			return nil, nil, ErrPatchTarget
+		}
+		if len(rest) == 0 {
+			delete(n, t)
+			return n, child, nil
+		}
+		child, removed, err := pointerRemove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[t] = child
+		return n, removed, nil
+	case []interface{}:
+		i, err := arrayIndex(t, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		child, removed, err := pointerRemove(n[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+	}
+	return nil, nil, ErrPatchTarget
+}
+
+func deepCopyJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodePatchDoc(b)
+}
+
+// jsonEqual structural equality, numbers compare by value so 1 equals 1.0
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if av == bv {
+			return true
+		}
+		af, aerr := av.Float64()
+		bf, berr := bv.Float64()
+		return aerr == nil && berr == nil && af == bf
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			w, ok := bv[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
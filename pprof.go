@@ -0,0 +1,36 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// EnablePprof mount the net/http/pprof handlers under prefix, every
+// profile endpoint is wrapped in auth so it can live on the public listener
+func (s *Server) EnablePprof(prefix string, auth EndPointDecorator) {
+	prefix = strings.TrimRight(prefix, "/")
+	config := EndPointConfig{auth}
+	index := config.Apply(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		pprof.Index(w, r)
+	})
+	profile := config.Apply(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		params, _ := Params(ctx)
+		switch name := params.ByName("name"); name {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			pprof.Handler(name).ServeHTTP(w, r)
+		}
+	})
+	s.AddEndPoint(http.MethodGet, prefix+"/", index)
+	s.AddEndPoint(http.MethodGet, prefix+"/:name", profile)
+	s.AddEndPoint(http.MethodPost, prefix+"/:name", profile)
+}
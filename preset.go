@@ -0,0 +1,123 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Environment deployment stage a server preset is tuned for
+type Environment int
+
+// deployment environments
+const (
+	Production Environment = iota
+	Staging
+	Development
+)
+
+func (e Environment) String() string {
+	switch e {
+	case Development:
+		return "development"
+	case Staging:
+		return "staging"
+	}
+	return "production"
+}
+
+// Preset apply the defaults for env:
+//
+//	development: error details, dev mode error pages, pretty json,
+//	             permissive cors and debug endpoints under /debug,
+//	             answered for loopback clients only
+//	staging:     error details
+//	production:  generic error messages, dev mode forced off
+func Preset(env Environment) Option {
+	return func(s *Server) {
+		s.Environment = env
+		s.HideErrors = env == Production
+		s.DevMode = env == Development
+		s.PrettyJSON = env == Development
+		s.PermissiveCORS = env == Development
+		if env == Development {
+			s.EnablePprof("/debug/pprof", LoopbackOnly)
+			s.EnableInFlight("/debug/requests", LoopbackOnly)
+			s.EnableBuildInfo("/debug/build")
+		}
+	}
+}
+
+// LoopbackOnly EndPointDecorator answering 403 unless the request comes
+// from a loopback address directly, requests forwarded by a proxy on the
+// same host are refused as well
+func LoopbackOnly(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ip := net.ParseIP(clientIP(r))
+		forwarded := r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != ""
+		if ip == nil || !ip.IsLoopback() || forwarded {
+			forbidden(w)
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+// ServeHTTP dispatch to the router backend, making the server settings available
+// to the response helpers
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := &serverWriter{ResponseWriter: w, server: s, request: r}
+	switch {
+	case s.cors != nil:
+		s.cors.serve(sw, r, http.HandlerFunc(s.route))
+		return
+	case s.PermissiveCORS:
+		permissiveCORS.serve(sw, r, http.HandlerFunc(s.route))
+		return
+	}
+	s.route(sw, r)
+}
+
+// serverWriter carries the serving Server down to JSONResult.Write and
+// friends, which only get the ResponseWriter
+type serverWriter struct {
+	http.ResponseWriter
+	server  *Server
+	request *http.Request
+	// locale negotiated by Locales, error messages are translated into it
+	locale string
+}
+
+func (w *serverWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *serverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (w *serverWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serverWriterFrom find the serverWriter below any decorator wrappers
+func serverWriterFrom(w http.ResponseWriter) *serverWriter {
+	for {
+		switch rw := w.(type) {
+		case *serverWriter:
+			return rw
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Proxy endpoint forwarding requests to target
+func Proxy(target *url.URL) EndPoint {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = proxyError
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		proxy.ServeHTTP(w, r)
+	}
+}
+
+func proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("proxy: %s", err)
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusBadGateway,
+		Error:      http.StatusText(http.StatusBadGateway),
+	}
+	res.Write(w)
+}
+
+// BalanceStrategy how a LoadBalancer picks an upstream
+type BalanceStrategy int
+
+// balancing strategies
+const (
+	RoundRobin BalanceStrategy = iota
+	LeastConnections
+)
+
+// Upstream backend of a LoadBalancer
+type Upstream struct {
+	URL *url.URL
+
+	proxy    *httputil.ReverseProxy
+	active   int64
+	mu       sync.Mutex
+	healthy  bool
+	fails    int
+	ejected  time.Time
+	lastFail error
+}
+
+// UpstreamStatus health of an upstream as reported by LoadBalancer.Status
+type UpstreamStatus struct {
+	URL       string `json:"url"`
+	Healthy   bool   `json:"healthy"`
+	Active    int64  `json:"active"`
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// available healthy and not ejected
+func (u *Upstream) available(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.healthy && !now.Before(u.ejected)
+}
+
+// LoadBalancer reverse proxy spreading requests over upstreams, upstreams
+// failing passively (errors, 5xx) or active health checks are ejected
+type LoadBalancer struct {
+	Strategy BalanceStrategy
+	// MaxFails consecutive failures before an upstream is ejected
+	MaxFails int
+	// EjectFor how long an ejected upstream is skipped
+	EjectFor time.Duration
+	// HealthPath probed by active health checks, empty disables them
+	HealthPath string
+	// HealthInterval between active health checks
+	HealthInterval time.Duration
+	// HealthTimeout per health check request
+	HealthTimeout time.Duration
+	// Client used for health checks
+	Client *http.Client
+
+	mu        sync.RWMutex
+	upstreams []*Upstream
+	next      uint64
+}
+
+// NewLoadBalancer balancer over targets
+func NewLoadBalancer(strategy BalanceStrategy, targets ...string) (*LoadBalancer, error) {
+	lb := &LoadBalancer{
+		Strategy:       strategy,
+		MaxFails:       3,
+		EjectFor:       30 * time.Second,
+		HealthInterval: 10 * time.Second,
+		HealthTimeout:  2 * time.Second,
+		Client:         http.DefaultClient,
+	}
+	if err := lb.SetUpstreams(targets...); err != nil {
+		return nil, err
+	}
+	return lb, nil
+}
+
+// SetUpstreams replace the upstream set, upstreams already known keep
+// their health state
+func (lb *LoadBalancer) SetUpstreams(targets ...string) error {
+	lb.mu.RLock()
+	known := make(map[string]*Upstream, len(lb.upstreams))
+	for _, u := range lb.upstreams {
+		known[u.URL.String()] = u
+	}
+	lb.mu.RUnlock()
+	upstreams := make([]*Upstream, 0, len(targets))
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return err
+		}
+		if up, ok := known[u.String()]; ok {
+			upstreams = append(upstreams, up)
+			continue
+		}
+		upstreams = append(upstreams, lb.newUpstream(u))
+	}
+	lb.mu.Lock()
+	lb.upstreams = upstreams
+	lb.mu.Unlock()
+	return nil
+}
+
+func (lb *LoadBalancer) newUpstream(u *url.URL) *Upstream {
+	up := &Upstream{URL: u, healthy: true}
+	up.proxy = httputil.NewSingleHostReverseProxy(u)
+	up.proxy.ModifyResponse = func(res *http.Response) error {
+		if res.StatusCode >= http.StatusInternalServerError {
+			lb.fail(up, fmt.Errorf("upstream status %d", res.StatusCode))
+		} else {
+			lb.succeed(up)
+		}
+		return nil
+	}
+	up.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if r.Context().Err() == nil {
+			lb.fail(up, err)
+		}
+		proxyError(w, r, err)
+	}
+	return up
+}
+
+func (lb *LoadBalancer) fail(u *Upstream, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails++
+	u.lastFail = err
+	if lb.MaxFails > 0 && u.fails >= lb.MaxFails {
+		u.ejected = time.Now().Add(lb.EjectFor)
+		u.fails = 0
+		log.Printf("proxy: ejecting %s: %s", u.URL, err)
+	}
+}
+
+func (lb *LoadBalancer) succeed(u *Upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails = 0
+}
+
+// pick an available upstream, nil when there is none
+func (lb *LoadBalancer) pick() *Upstream {
+	now := time.Now()
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	n := len(lb.upstreams)
+	if n == 0 {
+		return nil
+	}
+	if lb.Strategy == LeastConnections {
+		var best *Upstream
+		for _, u := range lb.upstreams {
+			if !u.available(now) {
+				continue
+			}
+			if best == nil || atomic.LoadInt64(&u.active) < atomic.LoadInt64(&best.active) {
+				best = u
+			}
+		}
+		return best
+	}
+	start := atomic.AddUint64(&lb.next, 1)
+	for i := 0; i < n; i++ {
+		u := lb.upstreams[(start+uint64(i))%uint64(n)]
+		if u.available(now) {
+			return u
+		}
+	}
+	return nil
+}
+
+// EndPoint proxy requests to the picked upstream
+func (lb *LoadBalancer) EndPoint(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	u := lb.pick()
+	if u == nil {
+		res := JSONResult{
+			Success:    false,
+			StatusCode: http.StatusServiceUnavailable,
+			Error:      "no healthy upstream",
+		}
+		res.Write(w)
+		return
+	}
+	atomic.AddInt64(&u.active, 1)
+	defer atomic.AddInt64(&u.active, -1)
+	u.proxy.ServeHTTP(w, r)
+}
+
+// Status health of every upstream
+func (lb *LoadBalancer) Status() []UpstreamStatus {
+	now := time.Now()
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	ret := make([]UpstreamStatus, len(lb.upstreams))
+	for i, u := range lb.upstreams {
+		healthy := u.available(now)
+		u.mu.Lock()
+		ret[i] = UpstreamStatus{
+			URL:      u.URL.String(),
+			Healthy:  healthy,
+			Active:   atomic.LoadInt64(&u.active),
+			Failures: u.fails,
+		}
+		if u.lastFail != nil {
+			ret[i].LastError = u.lastFail.Error()
+		}
+		u.mu.Unlock()
+	}
+	return ret
+}
+
+// Run actively health check the upstreams until ctx is done
+func (lb *LoadBalancer) Run(ctx context.Context) {
+	if lb.HealthPath == "" {
+		return
+	}
+	t := time.NewTicker(lb.HealthInterval)
+	defer t.Stop()
+	for {
+		lb.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (lb *LoadBalancer) checkAll(ctx context.Context) {
+	lb.mu.RLock()
+	upstreams := append([]*Upstream(nil), lb.upstreams...)
+	lb.mu.RUnlock()
+	var wg sync.WaitGroup
+	for _, u := range upstreams {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			err := lb.probe(ctx, u)
+			u.mu.Lock()
+			defer u.mu.Unlock()
+			if err != nil {
+				if u.healthy {
+					log.Printf("proxy: %s unhealthy: %s", u.URL, err)
+				}
+				u.healthy = false
+				u.lastFail = err
+				return
+			}
+			u.healthy = true
+		}(u)
+	}
+	wg.Wait()
+}
+
+func (lb *LoadBalancer) probe(ctx context.Context, u *Upstream) error {
+	ctx, cancel := context.WithTimeout(ctx, lb.HealthTimeout)
+	defer cancel()
+	target := *u.URL
+	target.Path = singleJoin(target.Path, lb.HealthPath)
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := lb.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("health check status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func singleJoin(a, b string) string {
+	switch {
+	case len(a) > 0 && a[len(a)-1] == '/' && len(b) > 0 && b[0] == '/':
+		return a + b[1:]
+	case (len(a) == 0 || a[len(a)-1] != '/') && (len(b) == 0 || b[0] != '/'):
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,503 @@
+package net
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyCacheHeader response header telling how the cache answered: HIT,
+// STALE, REVALIDATED, MISS or BYPASS
+const ProxyCacheHeader = "X-Cache"
+
+// CachedResponse upstream response kept by a CacheStore
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Date the response was generated upstream, its age counts from it
+	Date time.Time
+	// Expires end of freshness
+	Expires time.Time
+	// StaleWhileRevalidate window after Expires the stale response is
+	// served while it is refreshed in the background
+	StaleWhileRevalidate time.Duration
+	// StaleIfError window after Expires the stale response is served
+	// when the upstream fails
+	StaleIfError time.Duration
+	// Vary request header values the response was selected by
+	Vary map[string]string
+}
+
+// varyMatches reports whether r selects the same variant
+func (c CachedResponse) varyMatches(r *http.Request) bool {
+	for name, v := range c.Vary {
+		if r.Header.Get(name) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// CacheStore keeps cached responses
+type CacheStore interface {
+	GetResponse(ctx context.Context, key string) (CachedResponse, bool, error)
+	SetResponse(ctx context.Context, key string, res CachedResponse) error
+	DeleteResponse(ctx context.Context, key string) error
+}
+
+type cacheEntry struct {
+	key string
+	res CachedResponse
+}
+
+// MemoryCacheStore in process CacheStore evicting the least recently used
+// responses beyond MaxEntries
+type MemoryCacheStore struct {
+	MaxEntries int
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// NewMemoryCacheStore store holding up to maxEntries responses
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		MaxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// GetResponse response stored under key
+func (m *MemoryCacheStore) GetResponse(ctx context.Context, key string) (CachedResponse, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return CachedResponse{}, false, nil
+	}
+	m.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).res, true, nil
+}
+
+// SetResponse store res under key
+func (m *MemoryCacheStore) SetResponse(ctx context.Context, key string, res CachedResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		el.Value.(*cacheEntry).res = res
+		m.lru.MoveToFront(el)
+		return nil
+	}
+	m.entries[key] = m.lru.PushFront(&cacheEntry{key: key, res: res})
+	for m.MaxEntries > 0 && m.lru.Len() > m.MaxEntries {
+		el := m.lru.Back()
+		m.lru.Remove(el)
+		delete(m.entries, el.Value.(*cacheEntry).key)
+	}
+	return nil
+}
+
+// DeleteResponse drop the response under key
+func (m *MemoryCacheStore) DeleteResponse(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.lru.Remove(el)
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// ProxyCache shared http cache in front of a proxy endpoint, following
+// RFC 7234: responses are stored when the upstream gives them explicit
+// freshness, stale ones are revalidated with their validators and
+// stale-while-revalidate and stale-if-error are honoured. Requests with
+// credentials bypass the cache, unsafe requests invalidate the url. One
+// variant is kept per url, a request selecting another variant replaces
+// it.
+type ProxyCache struct {
+	Store CacheStore
+	// MaxBody responses with larger bodies are not stored
+	MaxBody int64
+	// RevalidateTimeout bounds background revalidations, 30 seconds when 0
+	RevalidateTimeout time.Duration
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+// NewProxyCache cache keeping responses in store, wrap a proxy with it:
+// EndPointConfig{cache.Decorate}.Apply(Proxy(target))
+func NewProxyCache(store CacheStore) *ProxyCache {
+	return &ProxyCache{
+		Store:             store,
+		MaxBody:           MB,
+		RevalidateTimeout: 30 * time.Second,
+		refreshing:        make(map[string]bool),
+	}
+}
+
+// hasCredentials reports whether r carries credentials a shared cache must
+// not answer or store for
+func hasCredentials(r *http.Request) bool {
+	for _, k := range []string{"Authorization", "Cookie", APIKeyHeader} {
+		if r.Header.Get(k) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func proxyCacheKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+// Decorate EndPointDecorator answering from the cache
+func (c *ProxyCache) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		key := proxyCacheKey(r)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			rec := newResponseRecorder(w)
+			e(ctx, rec, r)
+			if r.Method != http.MethodOptions && r.Method != http.MethodTrace && rec.Status() < http.StatusBadRequest {
+				c.Store.DeleteResponse(ctx, key)
+			}
+			return
+		}
+		reqCC := parseCacheControl(r.Header.Get("Cache-Control"))
+		if _, noStore := reqCC["no-store"]; noStore || hasCredentials(r) {
+			w.Header().Set(ProxyCacheHeader, "BYPASS")
+			e(ctx, w, r)
+			return
+		}
+		now := ClockFrom(ctx).Now()
+		entry, found, err := c.Store.GetResponse(ctx, key)
+		if err != nil {
+			log.Printf("proxy cache: %s", err)
+		}
+		if found && !entry.varyMatches(r) {
+			found = false
+		}
+		if found {
+			_, noCache := reqCC["no-cache"]
+			switch {
+			case !noCache && now.Before(entry.Expires):
+				serveCached(w, r, entry, now, "HIT")
+				return
+			case !noCache && now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)):
+				serveCached(w, r, entry, now, "STALE")
+				c.refresh(ctx, key, r, entry, e)
+				return
+			}
+		}
+		var stale *CachedResponse
+		if found {
+			stale = &entry
+		}
+		c.fetch(ctx, w, r, key, stale, e)
+	}
+}
+
+// fetch ask the upstream, conditionally when a stale response is known,
+// and store what comes back
+func (c *ProxyCache) fetch(ctx context.Context, w http.ResponseWriter, r *http.Request, key string, stale *CachedResponse, e EndPoint) {
+	clock := ClockFrom(ctx)
+	cw := &cacheWriter{ResponseWriter: w, header: make(http.Header), max: c.MaxBody}
+	up := r
+	if stale != nil {
+		up = conditionalRequest(r, *stale)
+		cw.stale = stale
+		cw.staleIfError = clock.Now().Before(stale.Expires.Add(stale.StaleIfError))
+	}
+	e(ctx, cw, up)
+	cw.finish()
+	now := clock.Now()
+	switch {
+	case cw.held && cw.status == http.StatusNotModified:
+		res := refreshed(*stale, cw.header, now)
+		c.store(ctx, key, res)
+		serveCached(w, r, res, now, "REVALIDATED")
+	case cw.held:
+		serveCached(w, r, *stale, now, "STALE")
+	case r.Method == http.MethodGet && !cw.overflow:
+		if res, ok := cacheable(cw.status, cw.header, cw.body.Bytes(), r, now); ok {
+			c.store(ctx, key, res)
+		}
+	}
+}
+
+// refresh revalidate entry in the background, once per key at a time
+func (c *ProxyCache) refresh(ctx context.Context, key string, r *http.Request, entry CachedResponse, e EndPoint) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	if c.refreshing == nil {
+		c.refreshing = make(map[string]bool)
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+	timeout := c.RevalidateTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	clock := ClockFrom(ctx)
+	r = r.Clone(context.Background())
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(ClockContext(context.Background(), clock), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+		c.fetch(ctx, &bufferWriter{header: make(http.Header)}, r, key, &entry, e)
+	}()
+}
+
+func (c *ProxyCache) store(ctx context.Context, key string, res CachedResponse) {
+	if err := c.Store.SetResponse(ctx, key, res); err != nil {
+		log.Printf("proxy cache: %s", err)
+	}
+}
+
+// conditionalRequest r revalidating entry, the client's own conditions
+// are answered from the cache afterwards
+func conditionalRequest(r *http.Request, entry CachedResponse) *http.Request {
+	up := r.Clone(r.Context())
+	up.Header.Del("If-None-Match")
+	up.Header.Del("If-Modified-Since")
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		up.Header.Set("If-None-Match", etag)
+	}
+	if lm := entry.Header.Get("Last-Modified"); lm != "" {
+		up.Header.Set("If-Modified-Since", lm)
+	}
+	return up
+}
+
+// serveCached answer r with res, 304 when the client's copy is current
+func serveCached(w http.ResponseWriter, r *http.Request, res CachedResponse, now time.Time, state string) {
+	h := w.Header()
+	for k, v := range res.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+	age := now.Sub(res.Date)
+	if age < 0 {
+		age = 0
+	}
+	h.Set("Age", strconv.Itoa(int(age/time.Second)))
+	h.Set(ProxyCacheHeader, state)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && (inm == "*" || etagListContains(inm, res.Header.Get("ETag"), true)) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(res.Body)))
+	w.WriteHeader(res.Status)
+	if r.Method != http.MethodHead {
+		w.Write(res.Body)
+	}
+}
+
+// heuristically cacheable statuses, RFC 7231 6.1; only stored here with
+// explicit freshness
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 404: true,
+	405: true, 410: true, 414: true, 501: true,
+}
+
+// cacheable response to store for r, false when the response may not be
+// stored by a shared cache or has no explicit freshness or validator
+func cacheable(status int, h http.Header, body []byte, r *http.Request, now time.Time) (CachedResponse, bool) {
+	cc := parseCacheControl(h.Get("Cache-Control"))
+	_, noStore := cc["no-store"]
+	_, private := cc["private"]
+	if !cacheableStatus[status] || noStore || private || h.Get("Set-Cookie") != "" {
+		return CachedResponse{}, false
+	}
+	res := CachedResponse{
+		Status: status,
+		Header: h.Clone(),
+		Body:   append([]byte(nil), body...),
+	}
+	for _, name := range h.Values("Vary") {
+		for _, v := range strings.Split(name, ",") {
+			v = http.CanonicalHeaderKey(strings.TrimSpace(v))
+			if v == "*" {
+				return CachedResponse{}, false
+			}
+			if res.Vary == nil {
+				res.Vary = make(map[string]string)
+			}
+			res.Vary[v] = r.Header.Get(v)
+		}
+	}
+	res = refreshed(res, nil, now)
+	// responses that are stale right away are only worth keeping for
+	// their validators
+	_, noCache := cc["no-cache"]
+	hasValidator := h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+	if !res.Expires.After(now) && !(hasValidator && (noCache || hasFreshness(cc, h))) {
+		return CachedResponse{}, false
+	}
+	return res, true
+}
+
+func hasFreshness(cc map[string]string, h http.Header) bool {
+	_, maxAge := cc["max-age"]
+	_, sMaxAge := cc["s-maxage"]
+	return maxAge || sMaxAge || h.Get("Expires") != ""
+}
+
+// refreshed res with its freshness computed at now, after merging the
+// headers h of a 304 revalidating it when given
+func refreshed(res CachedResponse, h http.Header, now time.Time) CachedResponse {
+	if h != nil {
+		merged := res.Header.Clone()
+		for _, k := range []string{"Cache-Control", "Date", "Expires", "ETag", "Last-Modified", "Age"} {
+			if v := h.Values(k); len(v) > 0 {
+				merged[k] = append([]string(nil), v...)
+			}
+		}
+		res.Header = merged
+	}
+	hdr := res.Header
+	res.Date = now
+	if age, err := strconv.Atoi(hdr.Get("Age")); err == nil && age > 0 {
+		res.Date = now.Add(-time.Duration(age) * time.Second)
+	}
+	cc := parseCacheControl(hdr.Get("Cache-Control"))
+	var lifetime time.Duration
+	if v, ok := cc["s-maxage"]; ok {
+		lifetime = ccSeconds(v)
+	} else if v, ok := cc["max-age"]; ok {
+		lifetime = ccSeconds(v)
+	} else if exp, err := http.ParseTime(hdr.Get("Expires")); err == nil {
+		date, err := http.ParseTime(hdr.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		lifetime = exp.Sub(date)
+	}
+	_, noCache := cc["no-cache"]
+	_, mustRevalidate := cc["must-revalidate"]
+	_, proxyRevalidate := cc["proxy-revalidate"]
+	if noCache || lifetime < 0 {
+		lifetime = 0
+	}
+	res.Expires = res.Date.Add(lifetime)
+	res.StaleWhileRevalidate, res.StaleIfError = 0, 0
+	if !mustRevalidate && !proxyRevalidate && !noCache {
+		res.StaleWhileRevalidate = ccSeconds(cc["stale-while-revalidate"])
+		res.StaleIfError = ccSeconds(cc["stale-if-error"])
+	}
+	return res
+}
+
+// parseCacheControl directives of a Cache-Control header, lower case
+func parseCacheControl(v string) map[string]string {
+	ret := make(map[string]string)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+		}
+		ret[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return ret
+}
+
+func ccSeconds(v string) time.Duration {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// cacheWriter passes the upstream response through while keeping a copy
+// to store. Revalidation answers, a 304 or a server error while a stale
+// response may be served, are held back instead.
+type cacheWriter struct {
+	http.ResponseWriter
+	header       http.Header
+	status       int
+	stale        *CachedResponse
+	staleIfError bool
+	held         bool
+	body         bytes.Buffer
+	max          int64
+	overflow     bool
+}
+
+func (c *cacheWriter) Header() http.Header { return c.header }
+
+func (c *cacheWriter) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	if c.stale != nil && (status == http.StatusNotModified || (c.staleIfError && status >= http.StatusInternalServerError)) {
+		c.held = true
+		return
+	}
+	h := c.ResponseWriter.Header()
+	for k, v := range c.header {
+		h[k] = v
+	}
+	h.Set(ProxyCacheHeader, "MISS")
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cacheWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.overflow {
+		if int64(c.body.Len()+len(b)) > c.max {
+			c.overflow = true
+			c.body.Reset()
+		} else {
+			c.body.Write(b)
+		}
+	}
+	if c.held {
+		return len(b), nil
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *cacheWriter) Flush() {
+	if c.held {
+		return
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish an upstream that wrote nothing answered 200 with an empty body
+func (c *cacheWriter) finish() {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+}
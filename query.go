@@ -0,0 +1,105 @@
+package net
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// ParamType type of a query parameter, named as in openapi
+type ParamType string
+
+// query parameter types
+const (
+	ParamString  ParamType = "string"
+	ParamInteger ParamType = "integer"
+	ParamNumber  ParamType = "number"
+	ParamBoolean ParamType = "boolean"
+)
+
+// QueryParam query parameter a route expects, an empty Type accepts any
+// value
+type QueryParam struct {
+	Name        string    `json:"name"`
+	Type        ParamType `json:"type,omitempty"`
+	Required    bool      `json:"required,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// QueryParams EndPointDecorator answering requests with missing or
+// mistyped query parameters with a 400 listing every violation, see also
+// Operation.Query
+func QueryParams(params ...QueryParam) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if errs := validateQuery(params, r); len(errs) > 0 {
+				validationFailed(w, errs)
+				return
+			}
+			e(ctx, w, r)
+		}
+	}
+}
+
+func validateQuery(params []QueryParam, r *http.Request) []ValidationError {
+	var errs []ValidationError
+	query := r.URL.Query()
+	for _, p := range params {
+		values := query[p.Name]
+		if len(values) == 0 || values[0] == "" {
+			if p.Required {
+				errs = append(errs, ValidationError{In: "query", Field: p.Name, Message: "required"})
+			}
+			continue
+		}
+		for _, raw := range values {
+			if msg := p.check(raw); msg != "" {
+				errs = append(errs, ValidationError{In: "query", Field: p.Name, Message: msg})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// check raw against the parameter type, the violation or empty
+func (p QueryParam) check(raw string) string {
+	switch p.Type {
+	case ParamInteger:
+		// what strconv.Atoi of the endpoint accepts, no floats or hex
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return "must be an integer"
+		}
+	case ParamNumber:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "must be a number"
+		}
+	case ParamBoolean:
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return "must be a boolean"
+		}
+	}
+	return ""
+}
+
+// document parameter for the openapi document
+func (p QueryParam) document() OpenAPIParameter {
+	ret := OpenAPIParameter{Name: p.Name, In: "query", Required: p.Required}
+	if p.Type != "" {
+		ret.Schema = &Schema{Type: string(p.Type)}
+	}
+	return ret
+}
+
+// validationFailed answer a 400 listing errs
+func validationFailed(w http.ResponseWriter, errs []ValidationError) {
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusBadRequest,
+		Error:      "request validation failed",
+		Result:     errs,
+	}
+	res.Write(w)
+}
@@ -0,0 +1,173 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// quota headers
+const (
+	QuotaLimitHeader     = "X-Quota-Limit"
+	QuotaRemainingHeader = "X-Quota-Remaining"
+	QuotaResetHeader     = "X-Quota-Reset"
+)
+
+// QuotaPeriod window a quota budget applies to
+type QuotaPeriod int
+
+// quota periods, windows start at midnight and on the first of the month
+const (
+	QuotaDaily QuotaPeriod = iota
+	QuotaMonthly
+)
+
+// window start and end of the period holding t
+func (p QuotaPeriod) window(t time.Time) (time.Time, time.Time) {
+	y, m, d := t.Date()
+	if p == QuotaMonthly {
+		start := time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// QuotaStore keeps quota usage, shared stores enforce the quota across
+// instances
+type QuotaStore interface {
+	// Consume count one request for key in the window starting at window
+	// unless limit is reached, returning the usage after the request
+	Consume(ctx context.Context, key string, window time.Time, limit int64) (used int64, ok bool, err error)
+}
+
+type quotaUsage struct {
+	window time.Time
+	used   int64
+}
+
+// MemoryQuotaStore in process QuotaStore keeping the current window per
+// key
+type MemoryQuotaStore struct {
+	mu    sync.Mutex
+	usage map[string]quotaUsage
+}
+
+// NewMemoryQuotaStore empty store
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{usage: make(map[string]quotaUsage)}
+}
+
+// Consume count a request for key
+func (m *MemoryQuotaStore) Consume(ctx context.Context, key string, window time.Time, limit int64) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.usage[key]
+	if !u.window.Equal(window) {
+		u = quotaUsage{window: window}
+	}
+	if u.used >= limit {
+		return u.used, false, nil
+	}
+	u.used++
+	m.usage[key] = u
+	return u.used, true, nil
+}
+
+// Cleanup drop usage of windows before t
+func (m *MemoryQuotaStore) Cleanup(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, u := range m.usage {
+		if u.window.Before(t) {
+			delete(m.usage, k)
+		}
+	}
+}
+
+// Quota request budgets per client over a day or month, unlike rate
+// limits the budget only refills when the period rolls over. Responses
+// carry the limit, remaining requests and reset time; exhausted clients
+// get 429 until the reset.
+type Quota struct {
+	Store  QuotaStore
+	Period QuotaPeriod
+	// Limit budget per period
+	Limit int64
+	// Limits budget of a client on another plan, 0 falls back to Limit
+	Limits func(ctx context.Context, key string) int64
+	// Key client a request is counted against, defaults to the api key
+	// and then the identity subject; requests without one are not counted
+	Key func(ctx context.Context, r *http.Request) string
+	// Location periods roll over in, defaults to UTC
+	Location *time.Location
+}
+
+// NewQuota limit clients to limit requests per period
+func NewQuota(store QuotaStore, period QuotaPeriod, limit int64) *Quota {
+	return &Quota{Store: store, Period: period, Limit: limit, Location: time.UTC}
+}
+
+func (q *Quota) key(ctx context.Context, r *http.Request) string {
+	if q.Key != nil {
+		return q.Key(ctx, r)
+	}
+	if k, ok := APIKeyFrom(ctx); ok {
+		return "key:" + k.ID
+	}
+	if id, ok := IdentityFrom(ctx); ok && id.Subject != "" {
+		return "sub:" + id.Subject
+	}
+	return ""
+}
+
+// Decorate EndPointDecorator counting requests against the quota, place
+// it after the auth decorator
+func (q *Quota) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		key := q.key(ctx, r)
+		if key == "" {
+			e(ctx, w, r)
+			return
+		}
+		limit := q.Limit
+		if q.Limits != nil {
+			if l := q.Limits(ctx, key); l > 0 {
+				limit = l
+			}
+		}
+		loc := q.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		now := ClockFrom(ctx).Now().In(loc)
+		start, reset := q.Period.window(now)
+		used, ok, err := q.Store.Consume(ctx, key, start, limit)
+		if err != nil {
+			ErrorResponse(w, err)
+			return
+		}
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		h := w.Header()
+		h.Set(QuotaLimitHeader, strconv.FormatInt(limit, 10))
+		h.Set(QuotaRemainingHeader, strconv.FormatInt(remaining, 10))
+		h.Set(QuotaResetHeader, strconv.FormatInt(reset.Unix(), 10))
+		if !ok {
+			left := reset.Sub(now)
+			h.Set("Retry-After", strconv.Itoa(int((left+time.Second-1)/time.Second)))
+			res := JSONResult{
+				Success:    false,
+				StatusCode: http.StatusTooManyRequests,
+				Error:      "quota exhausted",
+			}
+			res.Write(w)
+			return
+		}
+		e(ctx, w, r)
+	}
+}
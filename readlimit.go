@@ -0,0 +1,66 @@
+package net
+
+import (
+	"context"
+	"mime"
+	"net/http"
+)
+
+// ReadLimits body size limits DecodeBody enforces on a route, by content
+// type
+type ReadLimits struct {
+	// Default limit for types without their own, READLIMIT when 0
+	Default int64
+	// Types limits by media type, e.g. "application/json"
+	Types map[string]int64
+	// Metrics counts rejected bodies per route when set
+	Metrics *Metrics
+}
+
+// ReadLimit DecodeBody accepts bodies up to n bytes on the decorated route
+func ReadLimit(n int64) EndPointDecorator {
+	return ReadLimits{Default: n}.Decorate
+}
+
+type bodyLimit struct {
+	limit   int64
+	metrics *Metrics
+}
+
+// Decorate EndPointDecorator applying the limits, bodies announcing a
+// larger Content-Length are rejected before the endpoint runs
+func (l ReadLimits) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		limit := l.Default
+		if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+			if n, ok := l.Types[ct]; ok {
+				limit = n
+			}
+		}
+		if limit <= 0 {
+			limit = READLIMIT
+		}
+		bl := &bodyLimit{limit: limit, metrics: l.Metrics}
+		if r.ContentLength > limit {
+			bl.reject(ctx)
+			SizeResponse(w, ErrBodyTooLarge)
+			return
+		}
+		ctx = context.WithValue(ctx, bodyLimitKey, bl)
+		e(ctx, w, r.WithContext(ctx))
+	}
+}
+
+func (bl *bodyLimit) reject(ctx context.Context) {
+	if bl.metrics != nil {
+		bl.metrics.ObserveRejectedBody(routeLabel(ctx))
+	}
+}
+
+// bodyLimitFrom limit set by ReadLimits, READLIMIT without one
+func bodyLimitFrom(ctx context.Context) *bodyLimit {
+	if bl, ok := ctx.Value(bodyLimitKey).(*bodyLimit); ok {
+		return bl
+	}
+	return &bodyLimit{limit: READLIMIT}
+}
@@ -0,0 +1,220 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Redact v for the caller in ctx: struct fields tagged scope:"a,b" are
+// only kept for identities holding one of the scopes, fields tagged
+// role:"x,y" for identities holding one of the roles. Fields carrying both
+// tags need both. Types without tagged fields are returned as they are,
+// json tags are honoured for the rest.
+func Redact(ctx context.Context, v interface{}) interface{} {
+	id, _ := IdentityFrom(ctx)
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || !needsRedaction(rv.Type()) {
+		return v
+	}
+	return redactValue(id, rv)
+}
+
+// RedactedResponse ResultResponse with result redacted for the caller
+func RedactedResponse(ctx context.Context, w http.ResponseWriter, result interface{}) {
+	ResultResponse(w, Redact(ctx, result))
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	redactTypes       sync.Map
+)
+
+// needsRedaction reports whether t holds tagged fields anywhere
+func needsRedaction(t reflect.Type) bool {
+	if v, ok := redactTypes.Load(t); ok {
+		return v.(bool)
+	}
+	ret := hasTaggedFields(t, make(map[reflect.Type]bool))
+	redactTypes.Store(t, ret)
+	return ret
+}
+
+// hasTaggedFields walk t, types already being walked are left to the
+// outer call so recursive types terminate. Interfaces may hold tagged
+// values, they are checked at runtime.
+func hasTaggedFields(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] || t.Implements(marshalerType) || t.Implements(textMarshalerType) {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return hasTaggedFields(t.Elem(), visiting)
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && hasTaggedFields(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Tag.Get("scope") != "" || f.Tag.Get("role") != "" || hasTaggedFields(f.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func redactValue(id Identity, v reflect.Value) interface{} {
+	if !needsRedaction(v.Type()) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(id, v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		ret := make([]interface{}, v.Len())
+		for i := range ret {
+			ret[i] = redactValue(id, v.Index(i))
+		}
+		return ret
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		ret := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			ret[iter.Key().String()] = redactValue(id, iter.Value())
+		}
+		return ret
+	case reflect.Struct:
+		var obj redactedObject
+		redactStruct(id, v, &obj)
+		return obj
+	}
+	return v.Interface()
+}
+
+// redactStruct append the visible fields of v to obj, embedded structs
+// without a json name are flattened like encoding/json does
+func redactStruct(id Identity, v reflect.Value, obj *redactedObject) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) || !fieldVisible(id, f) {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		fv := v.Field(i)
+		if f.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				redactStruct(id, fv, obj)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, ",omitempty") && isEmptyJSON(fv) {
+			continue
+		}
+		*obj = append(*obj, redactedField{name: name, value: redactValue(id, fv)})
+	}
+}
+
+func fieldVisible(id Identity, f reflect.StructField) bool {
+	if scopes := f.Tag.Get("scope"); scopes != "" && !anyOf(strings.Split(scopes, ","), id.HasScope) {
+		return false
+	}
+	if roles := f.Tag.Get("role"); roles != "" && !anyOf(strings.Split(roles, ","), id.HasRole) {
+		return false
+	}
+	return true
+}
+
+func anyOf(values []string, has func(string) bool) bool {
+	for _, v := range values {
+		if has(strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyJSON the values omitempty leaves out
+func isEmptyJSON(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type redactedField struct {
+	name  string
+	value interface{}
+}
+
+// redactedObject struct with fields left out, encoded in field order
+type redactedObject []redactedField
+
+func (o redactedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
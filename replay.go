@@ -0,0 +1,259 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordMaxBody default cap of recorded bodies
+const RecordMaxBody = 64 << 10
+
+// SensitiveHeaders credentials kept out of recordings and panic reports
+var SensitiveHeaders = []string{
+	"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie", APIKeyHeader,
+}
+
+// Recording request/response pair, one json document per line
+type Recording struct {
+	Time              time.Time     `json:"time"`
+	Method            string        `json:"method"`
+	URL               string        `json:"url"`
+	Route             string        `json:"route,omitempty"`
+	Header            http.Header   `json:"header,omitempty"`
+	Body              []byte        `json:"body,omitempty"`
+	Status            int           `json:"status"`
+	ResponseHeader    http.Header   `json:"response_header,omitempty"`
+	ResponseBody      []byte        `json:"response_body,omitempty"`
+	Duration          time.Duration `json:"duration"`
+	BodyTruncated     bool          `json:"body_truncated,omitempty"`
+	ResponseTruncated bool          `json:"response_truncated,omitempty"`
+}
+
+// RequestRecorder decorator recording traffic to a writer, e.g. a file or
+// a RotatingFile, for replay against another build. Create it with
+// NewRequestRecorder, a recorder without writer records nothing.
+type RequestRecorder struct {
+	// MaxBody bytes of request and response bodies kept, RecordMaxBody
+	// when 0
+	MaxBody int64
+	// Redact headers dropped from recordings
+	Redact []string
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRequestRecorder recorder writing json lines to w
+func NewRequestRecorder(w io.Writer) *RequestRecorder {
+	return &RequestRecorder{
+		MaxBody: RecordMaxBody,
+		Redact:  append([]string(nil), SensitiveHeaders...),
+		enc:     json.NewEncoder(w),
+	}
+}
+
+// Decorate EndPointDecorator recording every request
+func (rr *RequestRecorder) Decorate(e EndPoint) EndPoint {
+	if rr.enc == nil {
+		log.Print("record: recorder without writer, use NewRequestRecorder")
+		return e
+	}
+	maxBody := rr.MaxBody
+	if maxBody <= 0 {
+		maxBody = RecordMaxBody
+	}
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		clock := ClockFrom(ctx)
+		rec := Recording{
+			Time:   clock.Now(),
+			Method: r.Method,
+			URL:    r.URL.RequestURI(),
+			Route:  Route(ctx).Path,
+			Header: rr.redact(r.Header),
+		}
+		if r.Body != nil {
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+			if err != nil {
+				BadRequest(w, err)
+				return
+			}
+			if int64(len(body)) > maxBody {
+				rec.BodyTruncated = true
+				rec.Body = body[:maxBody]
+			} else {
+				rec.Body = body
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+		cw := &captureWriter{responseRecorder: newResponseRecorder(w), max: maxBody}
+		defer func() {
+			rec.Status = cw.Status()
+			rec.ResponseHeader = rr.redact(w.Header())
+			rec.ResponseBody = cw.body.Bytes()
+			rec.ResponseTruncated = cw.truncated
+			rec.Duration = clock.Now().Sub(rec.Time)
+			rr.mu.Lock()
+			defer rr.mu.Unlock()
+			if err := rr.enc.Encode(rec); err != nil {
+				log.Printf("record: %s", err)
+			}
+		}()
+		e(ctx, cw, r)
+	}
+}
+
+func (rr *RequestRecorder) redact(h http.Header) http.Header {
+	ret := h.Clone()
+	for _, k := range rr.Redact {
+		ret.Del(k)
+	}
+	return ret
+}
+
+// captureWriter keeps a copy of the first max bytes written
+type captureWriter struct {
+	*responseRecorder
+	body      bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if left := c.max - int64(c.body.Len()); left > 0 {
+		if int64(len(b)) > left {
+			c.body.Write(b[:left])
+			c.truncated = true
+		} else {
+			c.body.Write(b)
+		}
+	} else if len(b) > 0 {
+		c.truncated = true
+	}
+	return c.responseRecorder.Write(b)
+}
+
+// Unwrap the recorder underneath
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.responseRecorder
+}
+
+// ReplayConfig how recordings are replayed
+type ReplayConfig struct {
+	// Target base url of the build under test
+	Target string
+	Client *http.Client
+	// Concurrency requests in flight, defaults to 1
+	Concurrency int
+	// Speed replays with the recorded spacing sped up by this factor, 0
+	// sends as fast as possible
+	Speed float64
+	// CompareBody reports responses whose body differs from the recording,
+	// only status codes are compared otherwise
+	CompareBody bool
+}
+
+// ReplayMismatch response differing from its recording
+type ReplayMismatch struct {
+	Recording Recording `json:"recording"`
+	Status    int       `json:"status"`
+	Body      []byte    `json:"body,omitempty"`
+	Err       string    `json:"error,omitempty"`
+}
+
+// ReplayReport outcome of a replay
+type ReplayReport struct {
+	Total      int              `json:"total"`
+	Mismatches []ReplayMismatch `json:"mismatches,omitempty"`
+	Duration   time.Duration    `json:"duration"`
+}
+
+// Replay re-issue the recordings read from r against config.Target
+func Replay(ctx context.Context, r io.Reader, config ReplayConfig) (*ReplayReport, error) {
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	workers := config.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	report := &ReplayReport{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	begin := time.Now()
+	var first time.Time
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4*RecordMaxBody+(1<<20))
+	for scanner.Scan() {
+		var rec Recording
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return report, err
+		}
+		if first.IsZero() {
+			first = rec.Time
+		}
+		if config.Speed > 0 {
+			at := begin.Add(time.Duration(float64(rec.Time.Sub(first)) / config.Speed))
+			select {
+			case <-time.After(time.Until(at)):
+			case <-ctx.Done():
+				return report, ctx.Err()
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return report, ctx.Err()
+		}
+		report.Total++
+		wg.Add(1)
+		go func(rec Recording) {
+			defer func() { <-sem; wg.Done() }()
+			if m := replayOne(ctx, client, config, rec); m != nil {
+				mu.Lock()
+				report.Mismatches = append(report.Mismatches, *m)
+				mu.Unlock()
+			}
+		}(rec)
+	}
+	wg.Wait()
+	report.Duration = time.Since(begin)
+	return report, scanner.Err()
+}
+
+func replayOne(ctx context.Context, client *http.Client, config ReplayConfig, rec Recording) *ReplayMismatch {
+	req, err := http.NewRequest(rec.Method, strings.TrimSuffix(config.Target, "/")+rec.URL, bytes.NewReader(rec.Body))
+	if err != nil {
+		return &ReplayMismatch{Recording: rec, Err: err.Error()}
+	}
+	req = req.WithContext(ctx)
+	for k, v := range rec.Header {
+		req.Header[k] = v
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return &ReplayMismatch{Recording: rec, Err: err.Error()}
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, RecordMaxBody))
+	if res.StatusCode != rec.Status {
+		return &ReplayMismatch{Recording: rec, Status: res.StatusCode, Body: body}
+	}
+	if config.CompareBody && !rec.ResponseTruncated && !bytes.Equal(body, rec.ResponseBody) {
+		return &ReplayMismatch{Recording: rec, Status: res.StatusCode, Body: body}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package net
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader header carrying the request id in and out
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID get the request id, empty outside AddEndPoint
+func RequestID(ctx context.Context) string {
+	if sc := scopeFrom(ctx); sc != nil {
+		return sc.id
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// requestID reuse the caller's request id or generate one, the id is
+// echoed in the response
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
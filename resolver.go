@@ -0,0 +1,185 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResolveInterval default interval of LoadBalancer.Watch
+const ResolveInterval = 30 * time.Second
+
+// Resolver discovers the upstream urls of a service
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// ResolverFunc func adapter for Resolver
+type ResolverFunc func(ctx context.Context) ([]string, error)
+
+// Resolve calls f
+func (f ResolverFunc) Resolve(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// StaticResolver fixed set of upstreams
+type StaticResolver []string
+
+// Resolve the static set
+func (s StaticResolver) Resolve(ctx context.Context) ([]string, error) {
+	return s, nil
+}
+
+// SRVResolver resolves upstreams from dns srv records, e.g. kubernetes
+// headless services or consul dns
+type SRVResolver struct {
+	// Service, Proto and Name as in net.LookupSRV, empty Service and Proto
+	// look up Name directly
+	Service string
+	Proto   string
+	Name    string
+	// Scheme of the upstream urls, defaults to http
+	Scheme   string
+	Resolver *net.Resolver
+}
+
+// Resolve look up the srv records
+func (s SRVResolver) Resolve(ctx context.Context) ([]string, error) {
+	r := s.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	_, addrs, err := r.LookupSRV(ctx, s.Service, s.Proto, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		host := strings.TrimSuffix(addr.Target, ".")
+		ret = append(ret, upstreamURL(s.Scheme, host, int(addr.Port)))
+	}
+	return ret, nil
+}
+
+// ConsulResolver resolves the passing instances of a service from the
+// consul health api
+type ConsulResolver struct {
+	// Address of the consul agent, e.g. http://127.0.0.1:8500
+	Address string
+	Service string
+	// Tag only instances carrying it, optional
+	Tag string
+	// Scheme of the upstream urls, defaults to http
+	Scheme string
+	Client *http.Client
+}
+
+// Resolve query consul for passing instances
+func (c ConsulResolver) Resolve(ctx context.Context) ([]string, error) {
+	q := url.Values{"passing": {"true"}}
+	if c.Tag != "" {
+		q.Set("tag", c.Tag)
+	}
+	u := strings.TrimSuffix(c.Address, "/") + "/v1/health/service/" +
+		url.PathEscape(c.Service) + "?" + q.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul: %s", res.Status)
+	}
+	var entries []struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		ret = append(ret, upstreamURL(c.Scheme, host, e.Service.Port))
+	}
+	return ret, nil
+}
+
+func upstreamURL(scheme, host string, port int) string {
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Watch resolve upstreams every interval, ResolveInterval when not
+// positive, until ctx is done, updating the balancer when the set changes.
+// Failed or empty resolutions keep the current set so a discovery outage
+// does not take the service down.
+func (lb *LoadBalancer) Watch(ctx context.Context, r Resolver, interval time.Duration) {
+	if interval <= 0 {
+		interval = ResolveInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var current []string
+	for {
+		targets, err := r.Resolve(ctx)
+		switch {
+		case err != nil:
+			log.Printf("resolve upstreams: %s", err)
+		case len(targets) == 0:
+			log.Print("resolve upstreams: no targets, keeping current set")
+		default:
+			sort.Strings(targets)
+			if !equalStrings(targets, current) {
+				if err := lb.SetUpstreams(targets...); err != nil {
+					log.Printf("resolve upstreams: %s", err)
+				} else {
+					current = targets
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,251 @@
+package net
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateConfig rotation policy of a RotatingFile
+type RotateConfig struct {
+	// MaxSize rotate once the file grows past this many bytes, 0 disables
+	MaxSize int64
+	// Interval rotate when the file is older than this, 0 disables
+	Interval time.Duration
+	// MaxBackups rotated files kept, 0 keeps all
+	MaxBackups int
+	// Compress gzip rotated files
+	Compress bool
+}
+
+// RotatingFile append only log file rotating by size and age, use it as
+// log output, e.g. log.SetOutput(f) or NewWriterAuditSink(f)
+type RotatingFile struct {
+	path   string
+	config RotateConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	closed bool
+	// retry earliest rotation after a failed one
+	retry time.Time
+	wg    sync.WaitGroup
+	// bg serializes compression and pruning of rotated files
+	bg sync.Mutex
+}
+
+// rotated file name suffix
+const rotateLayout = "20060102T150405.000"
+
+// rotateRetry wait after a failed rotation before the next attempt
+const rotateRetry = time.Minute
+
+// NewRotatingFile open or create path for appending
+func NewRotatingFile(path string, config RotateConfig) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, config: config}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write append p, rotating first when the policy says so
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.due(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			// keep writing to the current file, rotation is retried later
+			log.Printf("rotate: %s", err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) due(n int64) bool {
+	if f.size == 0 || time.Now().Before(f.retry) {
+		return false
+	}
+	if f.config.MaxSize > 0 && f.size+n > f.config.MaxSize {
+		return true
+	}
+	return f.config.Interval > 0 && time.Since(f.opened) >= f.config.Interval
+}
+
+// Rotate force a rotation
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	return f.rotate()
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	rotated := f.backupName()
+	if err := os.Rename(f.path, rotated); err != nil {
+		return f.reopen(err)
+	}
+	if err := f.open(); err != nil {
+		// move the file back so writes go on where they left off
+		os.Rename(rotated, f.path)
+		return f.reopen(err)
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.bg.Lock()
+		defer f.bg.Unlock()
+		if f.config.Compress {
+			if err := compressFile(rotated); err != nil && !os.IsNotExist(err) {
+				log.Printf("rotate: %s", err)
+			}
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// reopen the current file after a failed rotation so writes go on, a
+// failure here is retried by the next write
+func (f *RotatingFile) reopen(err error) error {
+	f.retry = time.Now().Add(rotateRetry)
+	if oerr := f.open(); oerr != nil {
+		log.Printf("rotate: %s", oerr)
+	}
+	return err
+}
+
+// backupName unused name for the next rotated file
+func (f *RotatingFile) backupName() string {
+	base := f.path + "." + time.Now().Format(rotateLayout)
+	name := base
+	for i := 1; ; i++ {
+		_, err := os.Stat(name)
+		_, gzErr := os.Stat(name + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%03d", base, i)
+	}
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune remove rotated files beyond MaxBackups, oldest first
+func (f *RotatingFile) prune() {
+	if f.config.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, m := range matches {
+		// a file still being compressed has both variants on disk
+		if !strings.HasSuffix(m, ".gz") {
+			if _, err := os.Stat(m + ".gz"); err == nil {
+				continue
+			}
+		}
+		backups = append(backups, m)
+	}
+	// the timestamp suffix sorts chronologically
+	sort.Strings(backups)
+	for len(backups) > f.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			log.Printf("rotate: %s", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// Close close the file and wait for pending compressions
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	f.closed = true
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
@@ -0,0 +1,50 @@
+package net
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RouteHandler handler a RouterBackend calls with the matched parameters
+type RouteHandler func(http.ResponseWriter, *http.Request, httprouter.Params)
+
+// RouterBackend matches requests to the handlers AddEndPoint registers,
+// path patterns use the syntax of the backend. Backends answer unmatched
+// requests themselves.
+type RouterBackend interface {
+	Handle(method, path string, h RouteHandler)
+	http.Handler
+}
+
+// WithRouter route with backend instead of the embedded httprouter, put it
+// before options that add endpoints. The embedded Router, its NotFound
+// and method helpers included, is then no longer served; panics are still
+// passed to its PanicHandler.
+func WithRouter(backend RouterBackend) Option {
+	return func(s *Server) {
+		s.backend = backend
+	}
+}
+
+// httprouterBackend the default backend, the embedded httprouter
+type httprouterBackend struct {
+	*httprouter.Router
+}
+
+func (b httprouterBackend) Handle(method, path string, h RouteHandler) {
+	b.Router.Handle(method, path, httprouter.Handle(h))
+}
+
+// route dispatch r to the backend, recovering panics for backends that do
+// not do so themselves
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.backend.(httprouterBackend); !ok {
+		defer func() {
+			if v := recover(); v != nil {
+				s.Router.PanicHandler(w, r, v)
+			}
+		}()
+	}
+	s.backend.ServeHTTP(w, r)
+}
@@ -0,0 +1,64 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+// RouteDescription registered route with what Describe or AddOperation
+// documented for it
+type RouteDescription struct {
+	Method          string       `json:"method"`
+	Path            string       `json:"path"`
+	ID              string       `json:"id,omitempty"`
+	Summary         string       `json:"summary,omitempty"`
+	Description     string       `json:"description,omitempty"`
+	Tags            []string     `json:"tags,omitempty"`
+	Query           []QueryParam `json:"query,omitempty"`
+	Example         interface{}  `json:"example,omitempty"`
+	ResponseExample interface{}  `json:"response_example,omitempty"`
+}
+
+// DescribeRoutes the routes added with AddEndPoint by path and method,
+// undocumented ones with their method and path only
+func (s *Server) DescribeRoutes() []RouteDescription {
+	routes := s.Routes()
+	s.api.mu.Lock()
+	docs := make(map[RouteInfo]Operation, len(s.api.ops))
+	for _, route := range s.api.ops {
+		docs[RouteInfo{Method: route.method, Path: route.path}] = route.op
+	}
+	s.api.mu.Unlock()
+	ret := make([]RouteDescription, 0, len(routes))
+	for _, route := range routes {
+		op := docs[route]
+		ret = append(ret, RouteDescription{
+			Method:          route.Method,
+			Path:            route.Path,
+			ID:              op.ID,
+			Summary:         op.Summary,
+			Description:     op.Description,
+			Tags:            op.Tags,
+			Query:           op.Query,
+			Example:         op.Example,
+			ResponseExample: op.ResponseExample,
+		})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Path != ret[j].Path {
+			return ret[i].Path < ret[j].Path
+		}
+		return ret[i].Method < ret[j].Method
+	})
+	return ret
+}
+
+// EnableRoutes mount an endpoint listing the described routes at path
+func (s *Server) EnableRoutes(path string, auth EndPointDecorator) {
+	s.AddEndPoint(http.MethodGet, path, EndPointConfig{auth}.Apply(
+		func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ResultResponse(w, s.DescribeRoutes())
+		},
+	))
+}
@@ -0,0 +1,286 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3PartSize default multipart part size, the minimum s3 accepts is 5MB
+const S3PartSize = 8 * MB
+
+// emptySHA256 payload hash of an empty body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Store BlobStore for s3 compatible object storage (aws, minio, r2,
+// ...), requests are signed with aws signature version 4. Uploads larger
+// than PartSize use multipart uploads so at most one part is held in
+// memory.
+type S3Store struct {
+	// Endpoint base url, e.g. https://s3.eu-west-1.amazonaws.com
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket as endpoint/bucket instead of
+	// bucket.endpoint, minio needs it
+	PathStyle bool
+	PartSize  int64
+	Client    *http.Client
+}
+
+func (s *S3Store) objectURL(key string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	if query != nil {
+		u.RawQuery = s3Query(query)
+	}
+	return u, nil
+}
+
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u, err := s.objectURL(key, query)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	hash := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(hash[:]), time.Now())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		drain(res)
+		return nil, ErrBlobNotFound
+	}
+	if res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		res.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, key, res.Status, msg)
+	}
+	return res, nil
+}
+
+// Put upload r, in parts when it is larger than PartSize
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) (BlobInfo, error) {
+	if err := validBlobKey(key); err != nil {
+		return BlobInfo{}, err
+	}
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = S3PartSize
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	first, err := ioutil.ReadAll(io.LimitReader(r, partSize))
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	if int64(len(first)) < partSize {
+		res, err := s.do(ctx, http.MethodPut, key, nil, first, header)
+		if err != nil {
+			return BlobInfo{}, err
+		}
+		drain(res)
+		return BlobInfo{Key: key, Size: int64(len(first)), ContentType: contentType, ModTime: time.Now()}, nil
+	}
+	return s.putMultipart(ctx, key, first, r, partSize, header)
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *S3Store) putMultipart(ctx context.Context, key string, first []byte, r io.Reader, partSize int64, header http.Header) (BlobInfo, error) {
+	res, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, header)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(res.Body).Decode(&created)
+	drain(res)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	abort := func(err error) (BlobInfo, error) {
+		if res, aerr := s.do(context.Background(), http.MethodDelete, key,
+			url.Values{"uploadId": {created.UploadID}}, nil, nil); aerr == nil {
+			drain(res)
+		}
+		return BlobInfo{}, err
+	}
+	var parts []s3Part
+	var size int64
+	part := first
+	for len(part) > 0 {
+		n := len(parts) + 1
+		res, err := s.do(ctx, http.MethodPut, key, url.Values{
+			"partNumber": {strconv.Itoa(n)},
+			"uploadId":   {created.UploadID},
+		}, part, nil)
+		if err != nil {
+			return abort(err)
+		}
+		drain(res)
+		parts = append(parts, s3Part{PartNumber: n, ETag: res.Header.Get("ETag")})
+		size += int64(len(part))
+		if part, err = ioutil.ReadAll(io.LimitReader(ctxReader{ctx, r}, partSize)); err != nil {
+			return abort(err)
+		}
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return abort(err)
+	}
+	res, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {created.UploadID}}, body, nil)
+	if err != nil {
+		return abort(err)
+	}
+	drain(res)
+	return BlobInfo{Key: key, Size: size, ContentType: header.Get("Content-Type"), ModTime: time.Now()}, nil
+}
+
+// Get stream the object
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	if err := validBlobKey(key); err != nil {
+		return nil, BlobInfo{}, err
+	}
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return res.Body, s3Info(key, res), nil
+}
+
+// Stat object metadata from a HEAD request
+func (s *S3Store) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	if err := validBlobKey(key); err != nil {
+		return BlobInfo{}, err
+	}
+	res, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	drain(res)
+	return s3Info(key, res), nil
+}
+
+// GetRange stream length bytes of the object starting at offset
+func (s *S3Store) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := validBlobKey(key); err != nil {
+		return nil, err
+	}
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func s3Info(key string, res *http.Response) BlobInfo {
+	modTime, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return BlobInfo{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		ModTime:     modTime,
+		ETag:        res.Header.Get("ETag"),
+	}
+}
+
+// Delete remove the object
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err == ErrBlobNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	drain(res)
+	return nil
+}
+
+// sign add aws signature version 4 headers to req
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	signer := SigV4{Region: s.Region, Service: "s3"}
+	signer.sign(req, SigningKey{AccessKey: s.AccessKey, SecretKey: s.SecretKey}, payloadHash, now)
+}
+
+// s3Query canonical query string, sorted and strictly encoded
+func s3Query(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape uri encode as aws expects, slashes are kept in paths
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package net
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LogSampling per route access log sampling, a rate of N logs one in N
+// successful requests, errors are always logged
+type LogSampling struct {
+	// Default rate for routes without their own, 0 or 1 logs everything
+	Default int
+	// Routes rate by route pattern
+	Routes map[string]int
+}
+
+func (s LogSampling) rate(route string) int {
+	if rate, ok := s.Routes[route]; ok {
+		return rate
+	}
+	return s.Default
+}
+
+// SampledLogger access log decorator that samples successful requests,
+// keeping chatty health and polling routes from drowning the logs
+func SampledLogger(sampling LogSampling) EndPointDecorator {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]uint64)
+	)
+	sample := func(route string, status int) bool {
+		rate := sampling.rate(route)
+		if rate <= 1 || status >= http.StatusBadRequest {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		n := seen[route]
+		seen[route] = n + 1
+		return n%uint64(rate) == 0
+	}
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			defer func(begin time.Time) {
+				route := routeLabel(ctx)
+				status := rec.Status()
+				if !sample(route, status) {
+					return
+				}
+				dur := time.Since(begin)
+				log.Printf("%s %s %d request took %d ms\n",
+					r.Method, r.URL.Path, status, dur/time.Millisecond)
+			}(time.Now())
+			e(ctx, rec, r)
+		}
+	}
+}
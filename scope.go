@@ -0,0 +1,91 @@
+package net
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// requestScope the per request values AddEndPoint provides, held in one
+// struct that is the request context itself instead of a chain of
+// context.WithValue. Values set later by decorators (identity, logger)
+// remain plain context values so a derived context never leaks into its
+// parent.
+type requestScope struct {
+	context.Context
+	route    RouteInfo
+	params   httprouter.Params
+	id       string
+	clock    Clock
+	detached int32
+}
+
+var scopePool = sync.Pool{
+	New: func() interface{} { return new(requestScope) },
+}
+
+// WithPooledContexts reuse request scopes across requests, which saves
+// the allocations of the request context on hot routes. Contexts kept by
+// goroutines that outlive the endpoint must then be passed through Detach,
+// Operations, Mirror and Coalescer do so themselves.
+func WithPooledContexts() Option {
+	return func(s *Server) {
+		s.pooled = true
+	}
+}
+
+// Detach mark the request context of ctx as kept beyond the endpoint so a
+// server pooling contexts does not reuse it, a no op otherwise
+func Detach(ctx context.Context) context.Context {
+	if sc := scopeFrom(ctx); sc != nil {
+		atomic.StoreInt32(&sc.detached, 1)
+	}
+	return ctx
+}
+
+func (s *Server) newScope(parent context.Context) *requestScope {
+	if !s.pooled {
+		return &requestScope{Context: parent, clock: s.clock}
+	}
+	sc := scopePool.Get().(*requestScope)
+	sc.Context = parent
+	sc.clock = s.clock
+	return sc
+}
+
+// releaseScope return sc to the pool, only called when the endpoint
+// returned normally: after a panic the recovery still reads the scope
+func (s *Server) releaseScope(sc *requestScope) {
+	if !s.pooled || atomic.LoadInt32(&sc.detached) != 0 {
+		return
+	}
+	*sc = requestScope{}
+	scopePool.Put(sc)
+}
+
+// Value serves the scope values without boxing them for the accessors,
+// which look the scope up directly
+func (sc *requestScope) Value(key interface{}) interface{} {
+	switch key {
+	case scopeKey:
+		return sc
+	case pKey:
+		return sc.params
+	case routeKey:
+		return sc.route
+	case requestIDKey:
+		return sc.id
+	case clockKey:
+		if sc.clock != nil {
+			return sc.clock
+		}
+	}
+	return sc.Context.Value(key)
+}
+
+func scopeFrom(ctx context.Context) *requestScope {
+	sc, _ := ctx.Value(scopeKey).(*requestScope)
+	return sc
+}
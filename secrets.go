@@ -0,0 +1,165 @@
+package net
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Secret value handed out by a SecretProvider, a LeaseDuration > 0 means
+// the value expires and has to be renewed or fetched again
+type Secret struct {
+	Value         string
+	Version       string
+	LeaseDuration time.Duration
+	Renewable     bool
+}
+
+// SecretProvider secret store such as vault or aws secrets manager
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) (Secret, error)
+}
+
+// SecretRenewer provider able to extend a lease without rotating the value
+type SecretRenewer interface {
+	RenewSecret(ctx context.Context, name string, s Secret) (Secret, error)
+}
+
+// errConfigSource source able to report lookup failures
+type errConfigSource interface {
+	lookupErr(key string) (string, bool, error)
+}
+
+// SecretSource ConfigSource reading keys from a SecretProvider
+type SecretSource struct {
+	provider SecretProvider
+	// names secret name per config key
+	names map[string]string
+	// Timeout per provider call, defaults to 10s
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	leases   map[string]secretLease
+	onRotate []func(key string, s Secret)
+}
+
+type secretLease struct {
+	secret  Secret
+	fetched time.Time
+}
+
+// NewSecretSource source resolving the keys in names through provider,
+// names maps a config key to the provider's secret name
+func NewSecretSource(provider SecretProvider, names map[string]string) *SecretSource {
+	return &SecretSource{
+		provider: provider,
+		names:    names,
+		Timeout:  10 * time.Second,
+		leases:   make(map[string]secretLease),
+	}
+}
+
+// Lookup value of key, provider errors count as missing, use the source
+// with LoadConfigFrom to have them reported
+func (s *SecretSource) Lookup(key string) (string, bool) {
+	val, ok, _ := s.lookupErr(key)
+	return val, ok
+}
+
+func (s *SecretSource) lookupErr(key string) (string, bool, error) {
+	name, ok := s.names[key]
+	if !ok {
+		return "", false, nil
+	}
+	s.mu.Lock()
+	lease, cached := s.leases[key]
+	s.mu.Unlock()
+	if cached && !lease.expired(time.Now()) {
+		return lease.secret.Value, true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	secret, err := s.provider.GetSecret(ctx, name)
+	if err != nil {
+		return "", false, err
+	}
+	s.mu.Lock()
+	s.leases[key] = secretLease{secret: secret, fetched: time.Now()}
+	s.mu.Unlock()
+	return secret.Value, true, nil
+}
+
+func (l secretLease) expired(now time.Time) bool {
+	return l.secret.LeaseDuration > 0 && now.After(l.fetched.Add(l.secret.LeaseDuration))
+}
+
+// due renewal is attempted after two thirds of the lease
+func (l secretLease) due(now time.Time) bool {
+	return l.secret.LeaseDuration > 0 &&
+		now.After(l.fetched.Add(l.secret.LeaseDuration*2/3))
+}
+
+// OnRotate register a callback for secrets that changed on renewal, e.g.
+// to reconnect a database pool with new credentials
+func (s *SecretSource) OnRotate(fn func(key string, s Secret)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRotate = append(s.onRotate, fn)
+}
+
+// Run renew leased secrets until ctx is done, renewable leases are
+// extended, others fetched again; changed values are passed to OnRotate
+// callbacks
+func (s *SecretSource) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.renew(ctx)
+		}
+	}
+}
+
+func (s *SecretSource) renew(ctx context.Context) {
+	now := time.Now()
+	s.mu.Lock()
+	due := make(map[string]secretLease)
+	for key, lease := range s.leases {
+		if lease.due(now) {
+			due[key] = lease
+		}
+	}
+	s.mu.Unlock()
+	for key, lease := range due {
+		secret, err := s.refresh(ctx, key, lease.secret)
+		if err != nil {
+			log.Printf("secret %s: renewal failed: %s", key, err)
+			continue
+		}
+		s.mu.Lock()
+		s.leases[key] = secretLease{secret: secret, fetched: time.Now()}
+		callbacks := s.onRotate
+		s.mu.Unlock()
+		if secret.Value != lease.secret.Value || secret.Version != lease.secret.Version {
+			for _, fn := range callbacks {
+				fn(key, secret)
+			}
+		}
+	}
+}
+
+func (s *SecretSource) refresh(ctx context.Context, key string, old Secret) (Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	name := s.names[key]
+	if renewer, ok := s.provider.(SecretRenewer); ok && old.Renewable {
+		if secret, err := renewer.RenewSecret(ctx, name, old); err == nil {
+			return secret, nil
+		}
+	}
+	return s.provider.GetSecret(ctx, name)
+}
@@ -0,0 +1,217 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SigningKey credentials requests are signed with
+type SigningKey struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// KeyProvider supplies signing credentials, e.g. rotating ones
+type KeyProvider interface {
+	SigningKey(ctx context.Context) (SigningKey, error)
+}
+
+// KeyProviderFunc func adapter for KeyProvider
+type KeyProviderFunc func(ctx context.Context) (SigningKey, error)
+
+// SigningKey calls f
+func (f KeyProviderFunc) SigningKey(ctx context.Context) (SigningKey, error) {
+	return f(ctx)
+}
+
+// StaticKey provider of a fixed key
+func StaticKey(accessKey, secretKey string) KeyProvider {
+	return KeyProviderFunc(func(context.Context) (SigningKey, error) {
+		return SigningKey{AccessKey: accessKey, SecretKey: secretKey}, nil
+	})
+}
+
+// RequestSigner signs outgoing requests, see Client.Signer
+type RequestSigner interface {
+	SignRequest(req *http.Request, body []byte) error
+}
+
+// SigV4 signs requests with aws signature version 4, for aws style apis
+// and service to service calls verified by SigV4Verifier
+type SigV4 struct {
+	Region  string
+	Service string
+	Keys    KeyProvider
+}
+
+// SignRequest add the X-Amz-Date, X-Amz-Content-Sha256 and Authorization
+// headers, body is the payload the request sends
+func (s *SigV4) SignRequest(req *http.Request, body []byte) error {
+	key, err := s.Keys.SigningKey(req.Context())
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	s.sign(req, key, hex.EncodeToString(hash[:]), ClockFrom(req.Context()).Now())
+	return nil
+}
+
+func (s *SigV4) sign(req *http.Request, key SigningKey, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if key.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", key.SessionToken)
+	}
+	names := []string{"host"}
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "authorization" || lk == "user-agent" {
+			continue
+		}
+		names = append(names, lk)
+	}
+	sort.Strings(names)
+	scope := now.Format("20060102") + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	sig := sigV4Signature(key.SecretKey, scope, amzDate,
+		sigV4Canonical(req, req.URL.Host, names, payloadHash))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		key.AccessKey, scope, strings.Join(names, ";"), sig,
+	))
+}
+
+// sigV4Canonical canonical request over the sorted lower case header names
+func sigV4Canonical(req *http.Request, host string, names []string, payloadHash string) string {
+	var headers strings.Builder
+	for _, name := range names {
+		v := host
+		if name != "host" {
+			v = strings.TrimSpace(strings.Join(req.Header[http.CanonicalHeaderKey(name)], ","))
+		}
+		headers.WriteString(name + ":" + v + "\n")
+	}
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3Query(req.URL.Query()),
+		headers.String(),
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// sigV4Signature hex signature of a canonical request, scope is
+// day/region/service/aws4_request
+func sigV4Signature(secret, scope, amzDate, canonical string) string {
+	crHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// SigV4MaxSkew default clock skew SigV4Verifier accepts, as aws does
+const SigV4MaxSkew = 5 * time.Minute
+
+// SigV4Verifier authenticates requests signed by SigV4, the identity is
+// the access key
+type SigV4Verifier struct {
+	Region  string
+	Service string
+	// Secret secret key of accessKey, an error rejects the request
+	Secret func(ctx context.Context, accessKey string) (string, error)
+	// MaxSkew accepted difference between the signing time and now,
+	// SigV4MaxSkew when 0
+	MaxSkew time.Duration
+}
+
+// Verify the signature of r, the body is read and restored
+func (v *SigV4Verifier) Verify(ctx context.Context, r *http.Request) (string, error) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	fields := map[string]string{}
+	for _, f := range strings.Split(auth, ",") {
+		if i := strings.IndexByte(f, '='); i > 0 {
+			fields[strings.TrimSpace(f[:i])] = strings.TrimSpace(f[i+1:])
+		}
+	}
+	cred := strings.SplitN(fields["Credential"], "/", 2)
+	if len(cred) != 2 || fields["Signature"] == "" || fields["SignedHeaders"] == "" {
+		return "", ErrInvalidToken
+	}
+	accessKey, scope := cred[0], cred[1]
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = SigV4MaxSkew
+	}
+	if skew := ClockFrom(ctx).Now().Sub(signedAt); skew > maxSkew || skew < -maxSkew {
+		return "", ErrTokenExpired
+	}
+	if scope != signedAt.Format("20060102")+"/"+v.Region+"/"+v.Service+"/aws4_request" {
+		return "", ErrInvalidToken
+	}
+	names := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(names) || !containsString(names, "host") {
+		return "", ErrInvalidToken
+	}
+	body := []byte{}
+	if r.Body != nil {
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return "", err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	if r.Header.Get("X-Amz-Content-Sha256") != payloadHash {
+		return "", ErrInvalidToken
+	}
+	secret, err := v.Secret(ctx, accessKey)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	want := sigV4Signature(secret, scope, amzDate, sigV4Canonical(r, r.Host, names, payloadHash))
+	if !hmac.Equal([]byte(want), []byte(fields["Signature"])) {
+		return "", ErrInvalidToken
+	}
+	return accessKey, nil
+}
+
+// Decorate EndPointDecorator answering 401 to requests not validly signed
+func (v *SigV4Verifier) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, BUFFERMAX)
+		accessKey, err := v.Verify(ctx, r)
+		if err != nil {
+			NoAccess(w)
+			return
+		}
+		ctx = WithIdentity(ctx, Identity{Subject: accessKey})
+		e(ctx, w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,141 @@
+package net
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SLO latency objective for a route, a request is good when it finished
+// within Latency without a server error
+type SLO struct {
+	Latency time.Duration
+	// Target fraction of good requests, e.g. 0.99
+	Target float64
+	// Window the burn rate is computed over, defaults to an hour
+	Window time.Duration
+}
+
+type sloBucket struct {
+	minute int64
+	total  uint64
+	good   uint64
+}
+
+type sloTracker struct {
+	slo     SLO
+	total   uint64
+	good    uint64
+	buckets []sloBucket
+}
+
+func newSLOTracker(slo SLO) *sloTracker {
+	if slo.Window <= 0 {
+		slo.Window = time.Hour
+	}
+	n := int(slo.Window / time.Minute)
+	if n < 1 {
+		n = 1
+	}
+	return &sloTracker{
+		slo:     slo,
+		buckets: make([]sloBucket, n),
+	}
+}
+
+func (t *sloTracker) observe(now time.Time, status int, dur time.Duration) {
+	minute := now.Unix() / 60
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+	b.total++
+	t.total++
+	if status < http.StatusInternalServerError && dur <= t.slo.Latency {
+		b.good++
+		t.good++
+	}
+}
+
+// burn rate of the error budget over the window, 1 means the budget is
+// spent exactly at the end of the window
+func (t *sloTracker) burn(now time.Time) float64 {
+	oldest := now.Unix()/60 - int64(len(t.buckets)) + 1
+	var total, good uint64
+	for _, b := range t.buckets {
+		if b.minute >= oldest {
+			total += b.total
+			good += b.good
+		}
+	}
+	budget := 1 - t.slo.Target
+	if total == 0 || budget <= 0 {
+		return 0
+	}
+	return (1 - float64(good)/float64(total)) / budget
+}
+
+// SetSLO track latency objective slo for route
+func (m *Metrics) SetSLO(route string, slo SLO) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.slos == nil {
+		m.slos = make(map[string]*sloTracker)
+	}
+	m.slos[route] = newSLOTracker(slo)
+}
+
+// BurnRate current error budget burn rate of route, false when no SLO is
+// set for route
+func (m *Metrics) BurnRate(route string) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.slos[route]
+	if !ok {
+		return 0, false
+	}
+	return t.burn(time.Now()), true
+}
+
+func (m *Metrics) writeSLOs(w *bufio.Writer, openMetrics bool) {
+	if len(m.slos) == 0 {
+		return
+	}
+	ns := m.Namespace
+	routes := make([]string, 0, len(m.slos))
+	for route := range m.slos {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	now := time.Now()
+	metrics := []struct {
+		name, help, kind string
+		value            func(t *sloTracker) string
+	}{
+		{"slo_requests_total", "Requests counted against the SLO.", "counter",
+			func(t *sloTracker) string { return fmt.Sprint(t.total) }},
+		{"slo_good_requests_total", "Requests meeting the SLO.", "counter",
+			func(t *sloTracker) string { return fmt.Sprint(t.good) }},
+		{"slo_latency_seconds", "SLO latency threshold.", "gauge",
+			func(t *sloTracker) string { return formatFloat(t.slo.Latency.Seconds()) }},
+		{"slo_target_ratio", "SLO target ratio of good requests.", "gauge",
+			func(t *sloTracker) string { return formatFloat(t.slo.Target) }},
+		{"slo_error_budget_burn_rate", "Error budget burn rate over the SLO window.", "gauge",
+			func(t *sloTracker) string { return formatFloat(t.burn(now)) }},
+	}
+	for _, metric := range metrics {
+		family := metric.name
+		if openMetrics {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s_%s %s\n", ns, family, metric.help)
+		fmt.Fprintf(w, "# TYPE %s_%s %s\n", ns, family, metric.kind)
+		for _, route := range routes {
+			fmt.Fprintf(w, "%s_%s{route=\"%s\"} %s\n",
+				ns, metric.name, escapeLabel(route), metric.value(m.slos[route]))
+		}
+	}
+}
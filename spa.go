@@ -0,0 +1,44 @@
+package net
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SPA serve a single page app from fsys for every path no route matched:
+// existing files are served as by Static, other paths get the index so
+// client side routing works. Paths under apiPrefixes and missing files
+// with an extension, like a stale asset, still answer 404.
+func (s *Server) SPA(fsys fs.FS, apiPrefixes ...string) *StaticFiles {
+	sf := &StaticFiles{fsys: fsys, CacheControl: DefaultCacheControl, Index: "index.html"}
+	s.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead || isAPIPath(r.URL.Path, apiPrefixes) {
+			res := JSONResult{
+				Success:    false,
+				StatusCode: http.StatusNotFound,
+				Error:      http.StatusText(http.StatusNotFound),
+			}
+			res.Write(w)
+			return
+		}
+		if sf.serve(w, r, r.URL.Path) {
+			return
+		}
+		if path.Ext(r.URL.Path) != "" || !sf.serve(w, r, sf.Index) {
+			http.NotFound(w, r)
+		}
+	})
+	return sf
+}
+
+func isAPIPath(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package net
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"time"
+)
+
+// split variants
+const (
+	VariantControl = "control"
+	VariantTest    = "variant"
+)
+
+// SplitHeader response header naming the variant served, one value per
+// experiment: "<name>=<variant>"
+const SplitHeader = "X-Experiment"
+
+// Split traffic splitting for experiments: a deterministic share of
+// callers is served by Variant instead of the decorated endpoint. Callers
+// are bucketed by identity subject, anonymous ones by a cookie, so a
+// caller keeps seeing the same variant.
+type Split struct {
+	// Name of the experiment, part of the bucketing hash so experiments
+	// split independently
+	Name string
+	// Percent of callers served by Variant, 0 to 100
+	Percent float64
+	Variant EndPoint
+	// Key buckets callers, defaults to the identity subject falling back
+	// to Cookie
+	Key func(r *http.Request) string
+	// Cookie holding the bucketing id of anonymous callers, set when
+	// missing; defaults to "exp_id"
+	Cookie string
+	// CookieMaxAge lifetime of the cookie, defaults to a year
+	CookieMaxAge time.Duration
+}
+
+// NewSplit serve percent of callers with variant
+func NewSplit(name string, percent float64, variant EndPoint) *Split {
+	return &Split{
+		Name:         name,
+		Percent:      percent,
+		Variant:      variant,
+		Cookie:       "exp_id",
+		CookieMaxAge: 365 * 24 * time.Hour,
+	}
+}
+
+// Decorate EndPointDecorator choosing the variant per caller, see
+// VariantOf
+func (sp *Split) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		variant := VariantControl
+		if sp.bucket(sp.key(w, r)) < sp.Percent {
+			variant = VariantTest
+		}
+		w.Header().Add(SplitHeader, sp.Name+"="+variant)
+		variants := map[string]string{sp.Name: variant}
+		if prev, ok := ctx.Value(splitKey).(map[string]string); ok {
+			for k, v := range prev {
+				if k != sp.Name {
+					variants[k] = v
+				}
+			}
+		}
+		ctx = context.WithValue(ctx, splitKey, variants)
+		r = r.WithContext(ctx)
+		if variant == VariantTest {
+			sp.Variant(ctx, w, r)
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+// key bucketing key of the caller, assigning anonymous callers a cookie
+func (sp *Split) key(w http.ResponseWriter, r *http.Request) string {
+	if sp.Key != nil {
+		return sp.Key(r)
+	}
+	if id, ok := IdentityFrom(r.Context()); ok && id.Subject != "" {
+		return id.Subject
+	}
+	name, maxAge := sp.Cookie, sp.CookieMaxAge
+	if name == "" {
+		// http.SetCookie drops cookies without a name
+		name = "exp_id"
+	}
+	if maxAge == 0 {
+		maxAge = 365 * 24 * time.Hour
+	}
+	if c, err := r.Cookie(name); err == nil && c.Value != "" {
+		return c.Value
+	}
+	key := newRequestID()
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    key,
+		Path:     "/",
+		MaxAge:   int(maxAge / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return key
+}
+
+// bucket position of key in [0, 100)
+func (sp *Split) bucket(key string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(sp.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum32()%10000) / 100
+}
+
+// VariantOf variant of experiment name the request was served by, empty
+// when the request did not pass its Split
+func VariantOf(ctx context.Context, name string) string {
+	variants, _ := ctx.Value(splitKey).(map[string]string)
+	return variants[name]
+}
@@ -0,0 +1,127 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// sseTransport writes frames as server sent events
+type sseTransport struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (t *sseTransport) write(f wsFrame) error {
+	var buf bytes.Buffer
+	for _, line := range strings.Split(string(f.data), "\n") {
+		buf.WriteString("data: ")
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return t.flush(buf.Bytes())
+}
+
+func (t *sseTransport) ping() error {
+	return t.flush([]byte(": ping\n\n"))
+}
+
+func (t *sseTransport) flush(b []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.w.Write(b); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// close ends the stream, the endpoint returns once the conn is closed
+func (t *sseTransport) close(code int, text string) {}
+
+// Realtime endpoint serving hub's event stream over a websocket or, for
+// clients that can't upgrade, server sent events. SSE connections are
+// write only, OnMessage is never called for them.
+func (h *Hub) Realtime(handler WSHandler) EndPoint {
+	ws := h.WebSocket(handler)
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			ws(ctx, w, r)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			res := JSONResult{
+				Success:    false,
+				StatusCode: http.StatusNotAcceptable,
+				Error:      "websocket upgrade or text/event-stream required",
+			}
+			res.Write(w)
+			return
+		}
+		h.serveSSE(ctx, w, handler)
+	}
+}
+
+// SSE endpoint serving hub's event stream as server sent events only
+func (h *Hub) SSE(handler WSHandler) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		h.serveSSE(ctx, w, handler)
+	}
+}
+
+func (h *Hub) serveSSE(ctx context.Context, w http.ResponseWriter, handler WSHandler) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ErrorResponse(w, fmt.Errorf("streaming unsupported"))
+		return
+	}
+	if h.isClosing() {
+		res := JSONResult{
+			Success:    false,
+			StatusCode: http.StatusServiceUnavailable,
+			Error:      "shutting down",
+		}
+		res.Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := newConn(ctx, &sseTransport{w: w, flusher: flusher}, h, h.QueueSize)
+	if !h.add(c) {
+		// closed while the stream was opened, ending it tells the client
+		return
+	}
+	defer h.remove(c)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.writer(h.PingInterval)
+	}()
+	if handler.OnOpen != nil {
+		handler.OnOpen(c)
+	}
+	select {
+	case <-ctx.Done():
+		c.closeWith(ErrPeerClosed, websocket.CloseNormalClosure, "")
+	case <-c.Done():
+	}
+	// the writer must be gone before the handler returns and w is invalid
+	<-done
+	if handler.OnClose != nil {
+		handler.OnClose(c)
+	}
+}
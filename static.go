@@ -0,0 +1,217 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StaticFiles serves files of a fs.FS, see Server.Static
+type StaticFiles struct {
+	fsys fs.FS
+	// CacheControl policy per file name, defaults to DefaultCacheControl
+	CacheControl func(name string) string
+	// Index served for directories, empty disables it
+	Index string
+	// Hidden serves names with a segment starting with a dot, like .git
+	Hidden bool
+
+	etags sync.Map
+}
+
+// DefaultCacheControl html revalidates every time so deploys show up
+// immediately, other assets are cached for a day
+func DefaultCacheControl(name string) string {
+	if strings.HasSuffix(name, ".html") {
+		return "no-cache"
+	}
+	return "public, max-age=86400"
+}
+
+// ImmutableCacheControl for fingerprinted assets that never change under
+// the same name
+func ImmutableCacheControl(name string) string {
+	return "public, max-age=31536000, immutable"
+}
+
+// precompressed encodings tried in order of preference
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Static serve fsys under prefix, e.g. s.Static("/assets", os.DirFS("web"))
+// or an embed.FS. Conditional requests are answered from ETag and
+// Last-Modified, name.br and name.gz variants are served to clients
+// accepting them.
+func (s *Server) Static(prefix string, fsys fs.FS) *StaticFiles {
+	sf := &StaticFiles{fsys: fsys, CacheControl: DefaultCacheControl, Index: "index.html"}
+	pattern := strings.TrimSuffix(prefix, "/") + "/*filepath"
+	s.AddEndPoint(http.MethodGet, pattern, sf.EndPoint)
+	s.AddEndPoint(http.MethodHead, pattern, sf.EndPoint)
+	return sf
+}
+
+// EndPoint serve the file named by the filepath param
+func (sf *StaticFiles) EndPoint(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	params, _ := Params(ctx)
+	if !sf.serve(w, r, params.ByName("filepath")) {
+		http.NotFound(w, r)
+	}
+}
+
+// name fs name of a request path, false for paths escaping the root or
+// hidden names
+func (sf *StaticFiles) name(p string) (string, bool) {
+	if strings.Contains(p, "\x00") || strings.Contains(p, `\`) {
+		return "", false
+	}
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	if !sf.Hidden {
+		for _, seg := range strings.Split(name, "/") {
+			if strings.HasPrefix(seg, ".") && seg != "." {
+				return "", false
+			}
+		}
+	}
+	return name, true
+}
+
+// serve write the file for p, false when there is nothing to serve
+func (sf *StaticFiles) serve(w http.ResponseWriter, r *http.Request, p string) bool {
+	name, ok := sf.name(p)
+	if !ok {
+		return false
+	}
+	info, err := fs.Stat(sf.fsys, name)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		if sf.Index == "" {
+			return false
+		}
+		name = path.Join(name, sf.Index)
+		if info, err = fs.Stat(sf.fsys, name); err != nil || info.IsDir() {
+			return false
+		}
+	}
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	served, encoding := name, ""
+	accept := r.Header.Get("Accept-Encoding")
+	for _, pc := range precompressed {
+		if !acceptsEncoding(accept, pc.encoding) {
+			continue
+		}
+		if ci, err := fs.Stat(sf.fsys, name+pc.ext); err == nil && !ci.IsDir() {
+			served, encoding, info = name+pc.ext, pc.encoding, ci
+			break
+		}
+	}
+	f, err := sf.fsys.Open(served)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	// headers only once there is something to serve, the caller may fall
+	// back to another file or a 404
+	h := w.Header()
+	h.Set("Content-Type", ctype)
+	h.Add("Vary", "Accept-Encoding")
+	if sf.CacheControl != nil {
+		if cc := sf.CacheControl(name); cc != "" {
+			h.Set("Cache-Control", cc)
+		}
+	}
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+	}
+	content, err := readSeeker(f)
+	if err != nil {
+		ErrorResponse(w, err)
+		return true
+	}
+	etag, err := sf.etag(served, info, content)
+	if err != nil {
+		ErrorResponse(w, err)
+		return true
+	}
+	h.Set("ETag", etag)
+	http.ServeContent(w, r, name, info.ModTime(), content)
+	return true
+}
+
+// etag from size and modification time, or a content hash for file
+// systems without modification times like embed.FS
+func (sf *StaticFiles) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()), nil
+	}
+	if etag, ok := sf.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	sf.etags.Store(name, etag)
+	return etag, nil
+}
+
+func readSeeker(f fs.File) (io.ReadSeeker, error) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows enc
+func acceptsEncoding(header, enc string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != enc {
+			continue
+		}
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if q, err := strconv.ParseFloat(f[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
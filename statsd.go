@@ -0,0 +1,116 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MetricsSink receives request measurements, Metrics and StatsD both
+// implement it
+type MetricsSink interface {
+	Observe(route, method string, status int, dur time.Duration, size int64)
+}
+
+// Measure EndPointDecorator feeding every request to sinks
+func Measure(sinks ...MetricsSink) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			clock := ClockFrom(ctx)
+			begin := clock.Now()
+			rec := newResponseRecorder(w)
+			defer func() {
+				err := recover()
+				status := requestStatus(ctx, rec, err)
+				if err != nil {
+					defer panic(err)
+				}
+				route, dur, traceID := routeLabel(ctx), clock.Now().Sub(begin), TraceID(ctx)
+				for _, sink := range sinks {
+					if ex, ok := sink.(ExemplarSink); ok && traceID != "" {
+						ex.ObserveExemplar(route, r.Method, status, dur, rec.size, traceID)
+						continue
+					}
+					sink.Observe(route, r.Method, status, dur, rec.size)
+				}
+			}()
+			e(ctx, rec, r)
+		}
+	}
+}
+
+// StatsD sends request measurements to a statsd or dogstatsd agent
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	// Tags enables dogstatsd tags, plain statsd gets route, method and
+	// status folded into the metric name instead
+	Tags bool
+	// ExtraTags are added to every dogstatsd metric, e.g. "env:prod"
+	ExtraTags []string
+}
+
+// NewStatsD statsd sink sending to addr over udp
+func NewStatsD(addr, prefix string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsD{conn: conn, prefix: strings.TrimSuffix(prefix, ".")}, nil
+}
+
+// NewDogStatsD dogstatsd sink sending tagged metrics to addr over udp
+func NewDogStatsD(addr, prefix string, tags ...string) (*StatsD, error) {
+	s, err := NewStatsD(addr, prefix)
+	if err != nil {
+		return nil, err
+	}
+	s.Tags = true
+	s.ExtraTags = tags
+	return s, nil
+}
+
+// Observe send one request as a counter, a timer and a size histogram,
+// the packet is fire and forget
+func (s *StatsD) Observe(route, method string, status int, dur time.Duration, size int64) {
+	var buf bytes.Buffer
+	name, suffix := s.prefix, ""
+	if s.Tags {
+		tags := append([]string{
+			"route:" + route,
+			"method:" + method,
+			fmt.Sprintf("status:%d", status),
+		}, s.ExtraTags...)
+		suffix = "|#" + strings.Join(tags, ",")
+	} else {
+		name = fmt.Sprintf("%s.%s.%s.%d",
+			s.prefix, statsdName(route), statsdName(method), status)
+	}
+	name = strings.TrimPrefix(name, ".")
+	fmt.Fprintf(&buf, "%s.requests:1|c%s\n", name, suffix)
+	fmt.Fprintf(&buf, "%s.request.duration:%s|ms%s\n",
+		name, formatFloat(float64(dur)/float64(time.Millisecond)), suffix)
+	fmt.Fprintf(&buf, "%s.response.size:%d|h%s", name, size, suffix)
+	s.conn.Write(buf.Bytes())
+}
+
+// Close close the udp socket
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+var statsdReplacer = strings.NewReplacer(
+	"/", "_", ".", "_", ":", "_", "|", "_", "@", "_", "#", "_", " ", "_",
+)
+
+func statsdName(v string) string {
+	v = strings.Trim(v, "/")
+	if v == "" {
+		return "root"
+	}
+	return statsdReplacer.Replace(v)
+}
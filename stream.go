@@ -0,0 +1,116 @@
+package net
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"strconv"
+)
+
+// trailers StreamWriter fills in itself when declared
+const (
+	// TrailerRecordCount number of records written with Encode
+	TrailerRecordCount = "X-Record-Count"
+	// TrailerChecksum hex sha256 of the body
+	TrailerChecksum = "X-Content-Sha256"
+)
+
+// StreamWriter streamed response, e.g. a large export, ending in
+// trailers so clients can verify they got all of it. TrailerRecordCount
+// and TrailerChecksum are computed when declared, other trailers are set
+// with SetTrailer before Close.
+type StreamWriter struct {
+	w        http.ResponseWriter
+	flusher  http.Flusher
+	trailers map[string]string
+	declared []string
+	hash     hash.Hash
+	records  int64
+	err      error
+}
+
+// NewStreamWriter start a 200 response of contentType, declaring trailers.
+// The body is sent chunked, Content-Length must not be set.
+func NewStreamWriter(w http.ResponseWriter, contentType string, trailers ...string) *StreamWriter {
+	s := &StreamWriter{w: w, trailers: make(map[string]string), declared: trailers}
+	s.flusher, _ = w.(http.Flusher)
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Del("Content-Length")
+	for _, t := range trailers {
+		h.Add("Trailer", t)
+		if http.CanonicalHeaderKey(t) == TrailerChecksum {
+			s.hash = sha256.New()
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	return s
+}
+
+// NewJSONStream newline delimited json stream, one record per Encode
+func NewJSONStream(w http.ResponseWriter, trailers ...string) *StreamWriter {
+	return NewStreamWriter(w, "application/x-ndjson", trailers...)
+}
+
+// Write part of the body, after a failed write the stream is broken and
+// every later write fails too
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.w.Write(p)
+	if s.hash != nil {
+		s.hash.Write(p[:n])
+	}
+	s.err = err
+	return n, err
+}
+
+// Encode write v as one json record followed by a newline
+func (s *StreamWriter) Encode(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.records++
+	return nil
+}
+
+// Flush send what was written so far
+func (s *StreamWriter) Flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// SetTrailer set the value of a declared trailer, sent by Close
+func (s *StreamWriter) SetTrailer(name, value string) {
+	s.trailers[http.CanonicalHeaderKey(name)] = value
+}
+
+// Close end the body and send the trailers. Trailers are left out when a
+// write failed, so the computed ones never vouch for a broken body.
+func (s *StreamWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	h := s.w.Header()
+	for _, t := range s.declared {
+		switch name := http.CanonicalHeaderKey(t); name {
+		case TrailerRecordCount:
+			h.Set(name, strconv.FormatInt(s.records, 10))
+		case TrailerChecksum:
+			h.Set(name, hex.EncodeToString(s.hash.Sum(nil)))
+		default:
+			if v, ok := s.trailers[name]; ok {
+				h.Set(name, v)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package net
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Reputation decides whether a client is flagged as abusive
+type Reputation interface {
+	Flagged(r *http.Request) bool
+}
+
+// ReputationFunc func adapter for Reputation
+type ReputationFunc func(r *http.Request) bool
+
+// Flagged calls f
+func (f ReputationFunc) Flagged(r *http.Request) bool {
+	return f(r)
+}
+
+// Tarpit delays flagged clients by delay plus up to jitter before the
+// endpoint runs, slowing down abuse without telling the client it was caught
+func Tarpit(source Reputation, delay, jitter time.Duration) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if source.Flagged(r) {
+				d := delay
+				if jitter > 0 {
+					d += time.Duration(rand.Int63n(int64(jitter)))
+				}
+				select {
+				case <-ClockFrom(ctx).After(d):
+				case <-ctx.Done():
+					return
+				}
+			}
+			e(ctx, w, r)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNoTenant the request does not name a tenant
+var ErrNoTenant = fmt.Errorf("no tenant")
+
+// TenantResolver finds the tenant a request is for
+type TenantResolver interface {
+	ResolveTenant(r *http.Request) (string, error)
+}
+
+// TenantResolverFunc func adapter for TenantResolver
+type TenantResolverFunc func(r *http.Request) (string, error)
+
+// ResolveTenant calls f
+func (f TenantResolverFunc) ResolveTenant(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// SubdomainTenant tenant from the subdomain of base, acme.example.com is
+// tenant acme for base example.com
+func SubdomainTenant(base string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(base, "."))
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		host := strings.ToLower(r.Host)
+		if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') {
+			host = host[:i]
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return "", ErrNoTenant
+		}
+		sub := strings.TrimSuffix(host, suffix)
+		if sub == "" || strings.Contains(sub, ".") {
+			return "", ErrNoTenant
+		}
+		return sub, nil
+	})
+}
+
+// HeaderTenant tenant from header name
+func HeaderTenant(name string) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		if t := r.Header.Get(name); t != "" {
+			return t, nil
+		}
+		return "", ErrNoTenant
+	})
+}
+
+// IdentityTenant tenant of the authenticated identity, e.g. the tenant
+// claim of a JWT; place the tenancy decorator after the auth decorator
+func IdentityTenant() TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		if id, ok := IdentityFrom(r.Context()); ok && id.Tenant != "" {
+			return id.Tenant, nil
+		}
+		return "", ErrNoTenant
+	})
+}
+
+// FirstTenant first tenant resolvers find
+func FirstTenant(resolvers ...TenantResolver) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		for _, res := range resolvers {
+			t, err := res.ResolveTenant(r)
+			if err == nil {
+				return t, nil
+			}
+			if err != ErrNoTenant {
+				return "", err
+			}
+		}
+		return "", ErrNoTenant
+	})
+}
+
+// Tenancy EndPointDecorator resolving the tenant into the context,
+// requests without one are rejected with 400 unless optional
+func Tenancy(resolver TenantResolver, optional bool) EndPointDecorator {
+	return func(e EndPoint) EndPoint {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolver.ResolveTenant(r)
+			switch {
+			case err == ErrNoTenant && optional:
+			case err != nil:
+				BadRequest(w, err)
+				return
+			default:
+				ctx = context.WithValue(ctx, tenantKey, tenant)
+				r = r.WithContext(ctx)
+			}
+			e(ctx, w, r)
+		}
+	}
+}
+
+// Tenant tenant of the request, empty without one
+func Tenant(ctx context.Context) string {
+	t, _ := ctx.Value(tenantKey).(string)
+	return t
+}
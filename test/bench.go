@@ -0,0 +1,221 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjolk/net"
+)
+
+// BenchItem element of the default benchmark payload
+type BenchItem struct {
+	ID      int               `json:"id"`
+	Name    string            `json:"name"`
+	Tags    []string          `json:"tags"`
+	Score   float64           `json:"score"`
+	Created time.Time         `json:"created"`
+	Attrs   map[string]string `json:"attrs"`
+}
+
+// BenchPayload representative response body, n items
+func BenchPayload(n int) []BenchItem {
+	ret := make([]BenchItem, n)
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range ret {
+		ret[i] = BenchItem{
+			ID:      i,
+			Name:    fmt.Sprintf("item <%d> & friends", i),
+			Tags:    []string{"alpha", "beta", "gamma"},
+			Score:   float64(i) * 1.5,
+			Created: created.Add(time.Duration(i) * time.Minute),
+			Attrs:   map[string]string{"color": "blue", "size": "xl"},
+		}
+	}
+	return ret
+}
+
+// Benchmarks every benchmark of this file as sub benchmarks, run them
+// from a _test.go file to track the hot paths:
+//
+//	func BenchmarkNet(b *testing.B) { test.Benchmarks(b) }
+func Benchmarks(b *testing.B) {
+	payload := BenchPayload(20)
+	b.Run("Write", func(b *testing.B) { BenchmarkWrite(b, payload) })
+	b.Run("DecodeBody", func(b *testing.B) { BenchmarkDecodeBody(b, payload) })
+	b.Run("Routing", func(b *testing.B) { BenchmarkRouting(b, 50) })
+	for _, depth := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("Decorators/%d", depth), func(b *testing.B) {
+			BenchmarkDecorators(b, depth)
+		})
+	}
+	b.Run("Encoder/std", func(b *testing.B) {
+		BenchmarkEncoder(b, net.StdEncoder{}, payload)
+	})
+}
+
+// BenchmarkWrite JSONResult.Write of result
+func BenchmarkWrite(b *testing.B, result interface{}) {
+	w := &discardWriter{header: http.Header{}}
+	res := net.JSONResult{Success: true, StatusCode: http.StatusOK, Result: result}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res.Write(w)
+	}
+}
+
+// BenchmarkDecodeBody DecodeBody of v encoded as json, decoded into a
+// fresh value of the same type
+func BenchmarkDecodeBody(b *testing.B, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		b.Fatal(err)
+	}
+	typ := reflect.TypeOf(v)
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := net.DecodeBody(r, reflect.New(typ).Interface()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRouting dispatch through a server with routes endpoints, the
+// request matches the last route
+func BenchmarkRouting(b *testing.B, routes int) {
+	s := net.NewServer()
+	noop := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	for i := 0; i < routes; i++ {
+		s.AddEndPoint(http.MethodGet, fmt.Sprintf("/r%d/:id/items", i), noop)
+	}
+	r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/r%d/42/items", routes-1), nil)
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ServeHTTP(w, r)
+	}
+}
+
+// BenchmarkDecorators call through an EndPointConfig of depth pass
+// through decorators
+func BenchmarkDecorators(b *testing.B, depth int) {
+	config := make(net.EndPointConfig, depth)
+	for i := range config {
+		config[i] = func(e net.EndPoint) net.EndPoint {
+			return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				e(ctx, w, r)
+			}
+		}
+	}
+	ep := config.Apply(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ep(ctx, w, r)
+	}
+}
+
+// BenchmarkEncoder full response of result through a server encoding with
+// enc
+func BenchmarkEncoder(b *testing.B, enc net.Encoder, result interface{}) {
+	s := net.NewServer(net.WithEncoder(enc))
+	s.AddEndPoint(http.MethodGet, "/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		net.ResultResponse(w, result)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ServeHTTP(w, r)
+	}
+}
+
+// EncoderResult outcome of one encoder in CompareEncoders
+type EncoderResult struct {
+	Name        string
+	NsPerOp     int64
+	AllocsPerOp int64
+	BytesPerOp  int64
+	// Equal output decodes to the same value as encoding/json's
+	Equal bool
+}
+
+func (r EncoderResult) String() string {
+	return fmt.Sprintf("%-12s %10d ns/op %8d B/op %6d allocs/op equal=%t",
+		r.Name, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp, r.Equal)
+}
+
+// CompareEncoders benchmark every encoder on result and check its output
+// against encoding/json, results are sorted fastest first
+func CompareEncoders(encoders map[string]net.Encoder, result interface{}) []EncoderResult {
+	var want bytes.Buffer
+	net.StdEncoder{}.Encode(&want, result)
+	ret := make([]EncoderResult, 0, len(encoders))
+	for name, enc := range encoders {
+		var got bytes.Buffer
+		equal := enc.Encode(&got, result) == nil && sameJSON(want.Bytes(), got.Bytes())
+		res := testing.Benchmark(func(b *testing.B) {
+			BenchmarkEncoder(b, enc, result)
+		})
+		ret = append(ret, EncoderResult{
+			Name:        name,
+			NsPerOp:     res.NsPerOp(),
+			AllocsPerOp: res.AllocsPerOp(),
+			BytesPerOp:  res.AllocedBytesPerOp(),
+			Equal:       equal,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].NsPerOp != ret[j].NsPerOp {
+			return ret[i].NsPerOp < ret[j].NsPerOp
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// FormatEncoderResults table of results, one encoder per line
+func FormatEncoderResults(results []EncoderResult) string {
+	lines := make([]string, len(results))
+	for i, r := range results {
+		lines[i] = r.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func sameJSON(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// discardWriter response writer dropping the body, cheap enough to keep
+// out of the measurements
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,33 @@
+package test_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mjolk/net"
+	"github.com/mjolk/net/test"
+)
+
+func BenchmarkWrite(b *testing.B) {
+	test.BenchmarkWrite(b, test.BenchPayload(20))
+}
+
+func BenchmarkDecodeBody(b *testing.B) {
+	test.BenchmarkDecodeBody(b, test.BenchPayload(20))
+}
+
+func BenchmarkRouting(b *testing.B) {
+	test.BenchmarkRouting(b, 50)
+}
+
+func BenchmarkDecorators(b *testing.B) {
+	for _, depth := range []int{0, 4, 16} {
+		b.Run(fmt.Sprint(depth), func(b *testing.B) {
+			test.BenchmarkDecorators(b, depth)
+		})
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	test.BenchmarkEncoder(b, net.StdEncoder{}, test.BenchPayload(20))
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mjolk/net"
+)
+
+// Builder fluent construction of a Request:
+//
+//	r := test.Post("/orders/1").Route("/orders/:id").Param("id", "1").JSON(order).Build()
+type Builder struct {
+	req   Request
+	query url.Values
+}
+
+// NewBuilder builder for method and path
+func NewBuilder(method, path string) *Builder {
+	return &Builder{req: Request{Method: method, Path: path}, query: url.Values{}}
+}
+
+// Get builder for a GET request
+func Get(path string) *Builder {
+	return NewBuilder(http.MethodGet, path)
+}
+
+// Post builder for a POST request
+func Post(path string) *Builder {
+	return NewBuilder(http.MethodPost, path)
+}
+
+// Put builder for a PUT request
+func Put(path string) *Builder {
+	return NewBuilder(http.MethodPut, path)
+}
+
+// Patch builder for a PATCH request
+func Patch(path string) *Builder {
+	return NewBuilder(http.MethodPatch, path)
+}
+
+// Delete builder for a DELETE request
+func Delete(path string) *Builder {
+	return NewBuilder(http.MethodDelete, path)
+}
+
+// JSON body encoded as json, whatever its type
+func (b *Builder) JSON(body interface{}) *Builder {
+	data, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	b.req.Body = data
+	return b.Header("Content-Type", "application/json")
+}
+
+// Body raw body, a string, []byte or io.Reader
+func (b *Builder) Body(body interface{}) *Builder {
+	b.req.Body = body
+	return b
+}
+
+// Param router param put in the context
+func (b *Builder) Param(key, value string) *Builder {
+	if b.req.Params == nil {
+		b.req.Params = make(map[string]string)
+	}
+	b.req.Params[key] = value
+	return b
+}
+
+// Query add a query parameter
+func (b *Builder) Query(key, value string) *Builder {
+	b.query.Add(key, value)
+	return b
+}
+
+// Header set a header
+func (b *Builder) Header(key, value string) *Builder {
+	if b.req.Headers == nil {
+		b.req.Headers = make(map[string]string)
+	}
+	b.req.Headers[key] = value
+	return b
+}
+
+// Route pattern reported by net.Route, defaults to the path
+func (b *Builder) Route(pattern string) *Builder {
+	b.req.Route = pattern
+	return b
+}
+
+// Context base context of the request
+func (b *Builder) Context(ctx context.Context) *Builder {
+	b.req.Context = ctx
+	return b
+}
+
+// Identity authenticate the request as id
+func (b *Builder) Identity(id net.Identity) *Builder {
+	ctx := b.req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	b.req.Context = net.WithIdentity(ctx, id)
+	return b
+}
+
+// Clock run the request on clock, see net.ClockFrom
+func (b *Builder) Clock(c net.Clock) *Builder {
+	ctx := b.req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	b.req.Context = net.ClockContext(ctx, c)
+	return b
+}
+
+// Request the built Request
+func (b *Builder) Request() Request {
+	req := b.req
+	if len(b.query) > 0 {
+		sep := "?"
+		if strings.Contains(req.Path, "?") {
+			sep = "&"
+		}
+		req.Path += sep + b.query.Encode()
+	}
+	return req
+}
+
+// Build the *http.Request with params and route in its context
+func (b *Builder) Build() *http.Request {
+	return NewRequest(b.Request())
+}
+
+// Call run ep, wrapped in decorators, against the built request
+func (b *Builder) Call(ep net.EndPoint, decorators ...net.EndPointDecorator) *Response {
+	return CallEndpoint(ep, b.Request(), decorators...)
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock fake net.Clock, time only moves when the test advances it
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewClock fake clock starting at start
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now current fake time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After channel receiving once the clock advanced by d
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Advance move the clock forward by d, firing due timers in order
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+	var due []fakeTimer
+	for len(c.timers) > 0 && !c.timers[0].at.After(now) {
+		due = append(due, c.timers[0])
+		c.timers = c.timers[1:]
+	}
+	c.mu.Unlock()
+	for _, t := range due {
+		t.c <- t.at
+	}
+}
+
+// Waiters timers not fired yet, lets tests wait until the code under
+// test is blocked on the clock before advancing it
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mjolk/net"
+)
+
+// Contract replay the examples of every operation in doc against handler,
+// usually the *net.Server, and check each response against the declared
+// statuses and schemas. Operations are run as subtests; operations needing
+// a body or a required parameter without example are skipped.
+func Contract(t *testing.T, handler http.Handler, doc *net.OpenAPIDocument) {
+	t.Helper()
+	v := net.NewOpenAPIValidator(doc)
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := doc.Paths[path]
+		methods := make([]string, 0, len(item))
+		for m := range item {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			op := item[method]
+			method := strings.ToUpper(method)
+			path := path
+			t.Run(method+" "+path, func(t *testing.T) {
+				req, err := exampleRequest(method, path, op)
+				if err != nil {
+					t.Skip(err)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				for _, e := range v.ValidateResponse(method, path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes()) {
+					field := e.Field
+					if field == "" {
+						field = "(root)"
+					}
+					t.Errorf("%d %s: %s", rec.Code, field, e.Message)
+				}
+			})
+		}
+	}
+}
+
+// exampleRequest request built from the examples of op
+func exampleRequest(method, path string, op *net.OpenAPIOperation) (*http.Request, error) {
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range op.Parameters {
+		if p.Example == nil {
+			if p.Required {
+				return nil, fmt.Errorf("no example for required %s parameter %s", p.In, p.Name)
+			}
+			continue
+		}
+		val := fmt.Sprint(p.Example)
+		switch p.In {
+		case "path":
+			path = strings.Replace(path, "{"+p.Name+"}", url.PathEscape(val), 1)
+		case "query":
+			query.Set(p.Name, val)
+		case "header":
+			header.Set(p.Name, val)
+		}
+	}
+	var body []byte
+	if op.RequestBody != nil {
+		media, ok := op.RequestBody.Content["application/json"]
+		switch {
+		case ok && media.Example != nil:
+			var err error
+			if body, err = json.Marshal(media.Example); err != nil {
+				return nil, err
+			}
+			header.Set("Content-Type", "application/json")
+		case op.RequestBody.Required:
+			return nil, fmt.Errorf("no json example for the request body")
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
@@ -0,0 +1,140 @@
+// Package test helpers for testing endpoints, decorators and servers of
+// package net without boilerplate.
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mjolk/net"
+)
+
+// Request describes a request to an endpoint. Body is sent as is when it
+// is a string, []byte or io.Reader and encoded as json otherwise.
+type Request struct {
+	Method string
+	Path   string
+	// Route pattern the endpoint is registered under, defaults to Path
+	Route   string
+	Params  map[string]string
+	Body    interface{}
+	Headers map[string]string
+	Context context.Context
+}
+
+// Response recorded response with the decoded envelope
+type Response struct {
+	*httptest.ResponseRecorder
+	// Result envelope, zero when the body is not json
+	Result net.JSONResult
+	// Raw result field, see Decode
+	Raw json.RawMessage
+}
+
+// Decode decode the envelope result into v
+func (r *Response) Decode(v interface{}) error {
+	return json.Unmarshal(r.Raw, v)
+}
+
+// CallEndpoint run ep, wrapped in decorators when given, against req and
+// record the response. Params and route are put in the context the way
+// Server.AddEndPoint does.
+func CallEndpoint(ep net.EndPoint, req Request, decorators ...net.EndPointDecorator) *Response {
+	r := NewRequest(req)
+	rec := httptest.NewRecorder()
+	net.EndPointConfig(decorators).Apply(ep)(r.Context(), rec, r)
+	return NewResponse(rec)
+}
+
+// NewRequest build the *http.Request for req with params and route in its
+// context
+func NewRequest(req Request) *http.Request {
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	body, isJSON := requestBody(req.Body)
+	r := httptest.NewRequest(req.Method, req.Path, body)
+	if isJSON {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+	ctx := req.Context
+	if ctx == nil {
+		ctx = r.Context()
+	}
+	route := req.Route
+	if route == "" {
+		route = r.URL.Path
+	}
+	ctx = net.RouteContext(ctx, req.Method, route)
+	ctx = net.Context(ctx, params(req.Params))
+	return r.WithContext(ctx)
+}
+
+// NewResponse decode the envelope of a recorded response
+func NewResponse(rec *httptest.ResponseRecorder) *Response {
+	res := &Response{ResponseRecorder: rec}
+	var env struct {
+		Success bool            `json:"success"`
+		Error   string          `json:"error"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err == nil {
+		res.Raw = env.Result
+		res.Result = net.JSONResult{
+			Success:    env.Success,
+			StatusCode: rec.Code,
+			Error:      env.Error,
+		}
+		if len(env.Result) > 0 {
+			var v interface{}
+			json.Unmarshal(env.Result, &v)
+			res.Result.Result = v
+		}
+	}
+	return res
+}
+
+func requestBody(body interface{}) (io.Reader, bool) {
+	switch b := body.(type) {
+	case nil:
+		return nil, false
+	case string:
+		return strings.NewReader(b), false
+	case []byte:
+		return bytes.NewReader(b), false
+	case io.Reader:
+		return b, false
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	return bytes.NewReader(data), true
+}
+
+// params sorted by key so tests are deterministic
+func params(m map[string]string) httprouter.Params {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := make(httprouter.Params, 0, len(m))
+	for _, k := range keys {
+		ret = append(ret, httprouter.Param{Key: k, Value: m[k]})
+	}
+	return ret
+}
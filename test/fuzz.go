@@ -0,0 +1,61 @@
+package test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mjolk/net"
+)
+
+// DecodeSeeds seed corpus for body decoding fuzzers: well formed bodies
+// and the malformed shapes DecodeJSON has to reject or survive
+func DecodeSeeds() [][]byte {
+	return [][]byte{
+		[]byte(`{"id":1,"name":"a","tags":["x","y"],"nested":{"ok":true}}`),
+		[]byte(`[]`),
+		[]byte(`null`),
+		[]byte(``),
+		[]byte(`{"id":`),
+		[]byte(`{"id":1}{"id":2}`),
+		[]byte(`{"id":1,"id":"dup"}`),
+		[]byte(`{"n":1e400}`),
+		[]byte(`{"s":"[[[{{{\"]]]"}`),
+		[]byte("\xef\xbb\xbf{\"bom\":true}"),
+		[]byte("{\"s\":\"\xff\xfe\"}"),
+		[]byte(`{"s":"\ud800"}`),
+		[]byte(strings.Repeat("[", net.MaxJSONDepth) + strings.Repeat("]", net.MaxJSONDepth)),
+		[]byte(strings.Repeat("[", net.MaxJSONDepth+1) + strings.Repeat("]", net.MaxJSONDepth+1)),
+		[]byte(`"` + strings.Repeat("a", net.READLIMIT) + `"`),
+	}
+}
+
+// FuzzDecodeBody fuzz DecodeBody into values made by target, seeded with
+// DecodeSeeds. Call it from a _test.go file:
+//
+//	func FuzzBody(f *testing.F) {
+//		test.FuzzDecodeBody(f, func() interface{} { return new(payload) })
+//	}
+func FuzzDecodeBody(f *testing.F, target func() interface{}) {
+	for _, seed := range DecodeSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(data))
+		err := net.DecodeBody(r, target())
+		if (err == nil) != (net.DecodeJSON(data, target()) == nil) {
+			t.Fatalf("DecodeBody and DecodeJSON disagree: %v", err)
+		}
+		if err != nil {
+			return
+		}
+		if len(data) > net.READLIMIT {
+			t.Fatalf("accepted %d bytes", len(data))
+		}
+		if !utf8.Valid(data) {
+			t.Fatalf("accepted invalid utf-8")
+		}
+	})
+}
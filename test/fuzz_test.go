@@ -0,0 +1,23 @@
+package test_test
+
+import (
+	"testing"
+
+	"github.com/mjolk/net/test"
+)
+
+type fuzzPayload struct {
+	ID     int               `json:"id"`
+	Name   string            `json:"name"`
+	Tags   []string          `json:"tags"`
+	Nested map[string]bool   `json:"nested"`
+	Attrs  map[string]string `json:"attrs"`
+}
+
+func FuzzDecodeBody(f *testing.F) {
+	test.FuzzDecodeBody(f, func() interface{} { return new(fuzzPayload) })
+}
+
+func FuzzDecodeBodyAny(f *testing.F) {
+	test.FuzzDecodeBody(f, func() interface{} { return new(interface{}) })
+}
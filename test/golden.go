@@ -0,0 +1,121 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the actual output")
+
+// GoldenDir directory golden files are kept in
+var GoldenDir = "testdata"
+
+// Ignored placeholder written for ignored fields
+const Ignored = "<ignored>"
+
+// AssertGolden compare json body with testdata/name.golden.json, run the
+// tests with -update to rewrite the file. Ignore lists dot separated field
+// paths whose values vary between runs, "*" matches any key or index, e.g.
+// "result.created_at" or "result.items.*.id".
+func AssertGolden(t testing.TB, name string, body []byte, ignore ...string) {
+	t.Helper()
+	actual, err := normalize(body, ignore)
+	if err != nil {
+		t.Fatalf("golden %s: response is not json: %s", name, err)
+	}
+	path := filepath.Join(GoldenDir, name+".golden.json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden %s: %s, run with -update to create it", name, err)
+	}
+	expected, err := normalize(golden, ignore)
+	if err != nil {
+		t.Fatalf("golden %s: %s", path, err)
+	}
+	if string(expected) != string(actual) {
+		t.Errorf("golden %s mismatch:\n%s", name, lineDiff(string(expected), string(actual)))
+	}
+}
+
+// AssertGoldenResponse compare the body of res, see AssertGolden
+func AssertGoldenResponse(t testing.TB, name string, res *Response, ignore ...string) {
+	t.Helper()
+	AssertGolden(t, name, res.Body.Bytes(), ignore...)
+}
+
+// normalize indent json with sorted keys and ignored fields replaced
+func normalize(data []byte, ignore []string) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	for _, path := range ignore {
+		v = blank(v, strings.Split(path, "."))
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func blank(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return Ignored
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if path[0] == "*" || path[0] == k {
+				node[k] = blank(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range node {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				node[i] = blank(child, path[1:])
+			}
+		}
+	}
+	return v
+}
+
+// lineDiff expected and actual lines side by side where they differ
+func lineDiff(expected, actual string) string {
+	exp := strings.Split(expected, "\n")
+	act := strings.Split(actual, "\n")
+	var b strings.Builder
+	for i := 0; i < len(exp) || i < len(act); i++ {
+		var e, a string
+		if i < len(exp) {
+			e = exp[i]
+		}
+		if i < len(act) {
+			a = act[i]
+		}
+		if e == a {
+			continue
+		}
+		b.WriteString("-" + e + "\n+" + a + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mjolk/net"
+)
+
+// ShutdownTimeout bounds the shutdown hooks run on cleanup
+var ShutdownTimeout = 5 * time.Second
+
+// TestServer running server for integration tests
+type TestServer struct {
+	URL    string
+	HTTP   *httptest.Server
+	Server *net.Server
+	// Client calls the server, retries are disabled so tests see every
+	// failure
+	Client *net.Client
+}
+
+// NewTestServer start a server built with opts and configured by
+// configure, which adds the endpoints with their decorators. The server
+// is shut down, running its shutdown hooks, when the test finishes.
+func NewTestServer(t testing.TB, configure func(s *net.Server), opts ...net.Option) *TestServer {
+	t.Helper()
+	s := net.NewServer(opts...)
+	if configure != nil {
+		configure(s)
+	}
+	ts := httptest.NewServer(s)
+	client := net.NewClient(ts.URL)
+	client.HTTP = ts.Client()
+	client.MaxRetries = 0
+	t.Cleanup(func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %s", err)
+		}
+	})
+	return &TestServer{URL: ts.URL, HTTP: ts, Server: s, Client: client}
+}
@@ -0,0 +1,313 @@
+package net
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// totp parameters, RFC 6238 defaults understood by authenticator apps
+const (
+	TOTPPeriod = 30 * time.Second
+	TOTPDigits = 6
+)
+
+// step-up errors
+var (
+	// ErrSecondFactor a sensitive route was called without a recent
+	// second factor
+	ErrSecondFactor = fmt.Errorf("second factor required")
+	// ErrSecondFactorLocked too many wrong codes, the subject has to wait
+	ErrSecondFactorLocked = fmt.Errorf("too many failed codes")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollment secret to store for the account and the otpauth uri to
+// show as qr code
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTOTP new secret for account
+func EnrollTOTP(issuer, account string) (TOTPEnrollment, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return TOTPEnrollment{}, err
+	}
+	secret := totpEncoding.EncodeToString(b)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("period", strconv.Itoa(int(TOTPPeriod/time.Second)))
+	q.Set("digits", strconv.Itoa(TOTPDigits))
+	label := url.PathEscape(issuer + ":" + account)
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    "otpauth://totp/" + label + "?" + q.Encode(),
+	}, nil
+}
+
+// TOTPCode code of secret at t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, totpCounter(t)), nil
+}
+
+func totpCounter(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0xf
+	v := binary.BigEndian.Uint32(sum[off:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, v%1000000)
+}
+
+// VerifyTOTP check code against secret at t, allowing skew periods of
+// clock drift either way. It returns the matched counter, callers reject
+// counters they accepted before to stop replays.
+func VerifyTOTP(secret, code string, t time.Time, skew int) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+	now := totpCounter(t)
+	for i := -skew; i <= skew; i++ {
+		c := now + int64(i)
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, c)), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// StepUp requires a recent second factor on sensitive routes. A verified
+// code is recorded in a signed cookie bound to the identity, so it runs
+// after the auth decorator.
+type StepUp struct {
+	// Key signs the step-up cookie
+	Key []byte
+	// Secret totp secret of subject
+	Secret func(ctx context.Context, subject string) (string, error)
+	// MaxAge how recent the second factor must be
+	MaxAge time.Duration
+	// Cookie name of the step-up cookie
+	Cookie string
+	// Skew periods of clock drift accepted
+	Skew int
+	// MaxFailures wrong codes a subject may send before it is locked out,
+	// 5 when 0
+	MaxFailures int
+	// Lockout how long a locked out subject is refused, 5 minutes when 0
+	Lockout time.Duration
+
+	mu       sync.Mutex
+	used     map[string]int64
+	failures map[string]*stepUpFailures
+}
+
+type stepUpFailures struct {
+	count int
+	until time.Time
+}
+
+// NewStepUp step-up valid for 10 minutes
+func NewStepUp(key []byte, secret func(ctx context.Context, subject string) (string, error)) *StepUp {
+	return &StepUp{
+		Key:    key,
+		Secret: secret,
+		MaxAge: 10 * time.Minute,
+		Cookie: "stepup",
+		Skew:   1,
+		used:   make(map[string]int64),
+	}
+}
+
+// Verify check code for subject and record the second factor in the
+// step-up cookie. After MaxFailures wrong codes the subject gets
+// ErrSecondFactorLocked for Lockout.
+func (s *StepUp) Verify(ctx context.Context, w http.ResponseWriter, subject, code string) error {
+	secret, err := s.Secret(ctx, subject)
+	if err != nil {
+		return err
+	}
+	now := ClockFrom(ctx).Now()
+	// the failure is counted before the code is checked, so parallel
+	// guesses can not get past MaxFailures
+	if !s.reserve(subject, now) {
+		return ErrSecondFactorLocked
+	}
+	counter, ok := VerifyTOTP(secret, code, now, s.Skew)
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	s.mu.Lock()
+	if last, seen := s.used[subject]; seen && counter <= last {
+		s.mu.Unlock()
+		return ErrInvalidCredentials
+	}
+	delete(s.failures, subject)
+	if s.used == nil {
+		s.used = make(map[string]int64)
+	}
+	s.used[subject] = counter
+	s.mu.Unlock()
+	at := strconv.FormatInt(now.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.Cookie,
+		Value:    at + "." + s.sign(subject, at),
+		Path:     "/",
+		MaxAge:   int(s.MaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// reserve count a failure for subject, false while it is locked out
+func (s *StepUp) reserve(subject string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures == nil {
+		s.failures = make(map[string]*stepUpFailures)
+	}
+	f, ok := s.failures[subject]
+	if !ok {
+		f = &stepUpFailures{}
+		s.failures[subject] = f
+	}
+	if now.Before(f.until) {
+		return false
+	}
+	max := s.MaxFailures
+	if max <= 0 {
+		max = 5
+	}
+	if f.count++; f.count >= max {
+		lockout := s.Lockout
+		if lockout <= 0 {
+			lockout = 5 * time.Minute
+		}
+		f.count, f.until = 0, now.Add(lockout)
+	}
+	return true
+}
+
+// lockedFor time subject stays locked out at now
+func (s *StepUp) lockedFor(subject string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.failures[subject]; ok && now.Before(f.until) {
+		return f.until.Sub(now)
+	}
+	return 0
+}
+
+func (s *StepUp) sign(subject, at string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(subject + "|" + at))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verified when subject last passed the second factor according to the
+// step-up cookie of r
+func (s *StepUp) Verified(r *http.Request, subject string) (time.Time, bool) {
+	c, err := r.Cookie(s.Cookie)
+	if err != nil {
+		return time.Time{}, false
+	}
+	i := strings.IndexByte(c.Value, '.')
+	if i < 0 {
+		return time.Time{}, false
+	}
+	at, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.sign(subject, at))) {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// Decorate EndPointDecorator answering 403 unless the identity passed the
+// second factor within MaxAge
+func (s *StepUp) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFrom(ctx)
+		if !ok {
+			NoAccess(w)
+			return
+		}
+		at, ok := s.Verified(r, id.Subject)
+		if !ok || ClockFrom(ctx).Now().Sub(at) > s.MaxAge {
+			res := JSONResult{
+				Success:    false,
+				StatusCode: http.StatusForbidden,
+				Error:      ErrSecondFactor.Error(),
+			}
+			res.Write(w)
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+// EndPoint verify {"code"} for the identity in the context, mount it
+// behind the auth decorator. Locked out subjects get 429.
+func (s *StepUp) EndPoint(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id, ok := IdentityFrom(ctx)
+	if !ok {
+		NoAccess(w)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := DecodeBody(r, &req); err != nil {
+		BadRequest(w, err)
+		return
+	}
+	err := s.Verify(ctx, w, id.Subject, req.Code)
+	if err == ErrSecondFactorLocked {
+		left := s.lockedFor(id.Subject, ClockFrom(ctx).Now())
+		w.Header().Set("Retry-After", strconv.Itoa(int((left+time.Second-1)/time.Second)))
+		res := JSONResult{
+			Success:    false,
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err.Error(),
+		}
+		res.Write(w)
+		return
+	}
+	if err != nil {
+		authError(w, err)
+		return
+	}
+	ResultResponse(w, nil)
+}
@@ -0,0 +1,463 @@
+package net
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tus protocol constants
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,expiration,termination"
+	TusExpiry     = 24 * time.Hour
+)
+
+// TusUpload state of a resumable upload
+type TusUpload struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Expires  time.Time         `json:"expires"`
+	// Key of the assembled blob once the upload completed
+	Key   string  `json:"key,omitempty"`
+	Parts []int64 `json:"parts,omitempty"`
+}
+
+// Complete reports whether every byte was received
+func (u *TusUpload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// Tus resumable uploads following the tus 1.0 protocol. Every PATCH is
+// stored as a part in the blob store, completed uploads are assembled into
+// a single blob. A PATCH interrupted midway is discarded, the client
+// resumes from the last offset it gets from HEAD.
+type Tus struct {
+	Store BlobStore
+	// MaxSize largest upload accepted, 0 means no limit
+	MaxSize int64
+	// Expiry of incomplete uploads
+	Expiry time.Duration
+	// Key names the assembled blob, defaults to the upload id
+	Key func(u *TusUpload) string
+	// OnComplete is called once an upload is assembled
+	OnComplete func(ctx context.Context, u *TusUpload)
+
+	mu      sync.Mutex
+	uploads map[string]*TusUpload
+	locks   map[string]*tusLock
+}
+
+// tusLock serializes requests on one upload, dropped once none holds it
+type tusLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewTus resumable uploads into store
+func NewTus(store BlobStore) *Tus {
+	return &Tus{
+		Store:   store,
+		Expiry:  TusExpiry,
+		uploads: make(map[string]*TusUpload),
+		locks:   make(map[string]*tusLock),
+	}
+}
+
+// MountTus mount the tus endpoints at prefix, uploads are created at
+// prefix and live at prefix/:id
+func (s *Server) MountTus(prefix string, t *Tus) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	s.AddEndPoint(http.MethodOptions, prefix, t.options)
+	s.AddEndPoint(http.MethodPost, prefix, t.tusVersion(t.create))
+	s.AddEndPoint(http.MethodHead, prefix+"/:id", t.tusVersion(t.head))
+	s.AddEndPoint(http.MethodPatch, prefix+"/:id", t.tusVersion(t.patch))
+	s.AddEndPoint(http.MethodDelete, prefix+"/:id", t.tusVersion(t.terminate))
+}
+
+func tusPartKey(id string, offset int64) string {
+	return fmt.Sprintf("tus/%s/%020d", id, offset)
+}
+
+func tusInfoKey(id string) string {
+	return "tus/" + id + "/info"
+}
+
+func (t *Tus) options(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set("Tus-Resumable", TusVersion)
+	h.Set("Tus-Version", TusVersion)
+	h.Set("Tus-Extension", TusExtensions)
+	if t.MaxSize > 0 {
+		h.Set("Tus-Max-Size", strconv.FormatInt(t.MaxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusVersion reject clients speaking another protocol version
+func (t *Tus) tusVersion(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", TusVersion)
+		if r.Header.Get("Tus-Resumable") != TusVersion {
+			w.Header().Set("Tus-Version", TusVersion)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+func (t *Tus) create(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		BadRequest(w, fmt.Errorf("invalid Upload-Length"))
+		return
+	}
+	if t.MaxSize > 0 && length > t.MaxSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	meta, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		BadRequest(w, err)
+		return
+	}
+	u := &TusUpload{
+		ID:       newRequestID(),
+		Length:   length,
+		Metadata: meta,
+		Expires:  time.Now().Add(t.Expiry).UTC(),
+	}
+	if u.Complete() {
+		err = t.assemble(ctx, u)
+	}
+	if err == nil {
+		err = t.save(ctx, u)
+	}
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+u.ID)
+	w.Header().Set("Upload-Expires", u.Expires.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (t *Tus) head(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	u, unlock, status := t.acquire(ctx, r)
+	if u == nil {
+		w.WriteHeader(status)
+		return
+	}
+	defer unlock()
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if len(u.Metadata) > 0 {
+		h.Set("Upload-Metadata", formatTusMetadata(u.Metadata))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (t *Tus) patch(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		BadRequest(w, fmt.Errorf("invalid Upload-Offset"))
+		return
+	}
+	u, unlock, status := t.acquire(ctx, r)
+	if u == nil {
+		w.WriteHeader(status)
+		return
+	}
+	defer unlock()
+	if offset != u.Offset {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	left := u.Length - u.Offset
+	if r.ContentLength > left {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	info, err := t.Store.Put(ctx, tusPartKey(u.ID, offset), io.LimitReader(r.Body, left), "")
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	if info.Size > 0 {
+		u.Parts = append(u.Parts, offset)
+		u.Offset += info.Size
+	}
+	if u.Complete() {
+		err = t.assemble(ctx, u)
+	}
+	if err == nil {
+		err = t.save(ctx, u)
+	}
+	if err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	if !u.Complete() {
+		w.Header().Set("Upload-Expires", u.Expires.Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *Tus) terminate(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	u, unlock, status := t.acquire(ctx, r)
+	if u == nil {
+		w.WriteHeader(status)
+		return
+	}
+	defer unlock()
+	if err := t.remove(ctx, u); err != nil {
+		ErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// find the upload of the request, falling back to the stored state for
+// uploads created before a restart or completed ones
+func (t *Tus) find(ctx context.Context, r *http.Request) (*TusUpload, int) {
+	params, _ := Params(ctx)
+	id := params.ByName("id")
+	t.mu.Lock()
+	u, ok := t.uploads[id]
+	t.mu.Unlock()
+	if !ok {
+		if validBlobKey(tusInfoKey(id)) != nil {
+			return nil, http.StatusNotFound
+		}
+		rc, _, err := t.Store.Get(ctx, tusInfoKey(id))
+		if err != nil {
+			return nil, http.StatusNotFound
+		}
+		defer rc.Close()
+		u = &TusUpload{}
+		if err := json.NewDecoder(rc).Decode(u); err != nil {
+			return nil, http.StatusNotFound
+		}
+		if !u.Complete() {
+			t.mu.Lock()
+			t.uploads[id] = u
+			t.mu.Unlock()
+		}
+	}
+	if !u.Complete() && time.Now().After(u.Expires) {
+		return nil, http.StatusGone
+	}
+	return u, http.StatusOK
+}
+
+// acquire find the upload of the request and lock it, ids of unknown
+// uploads never get a lock
+func (t *Tus) acquire(ctx context.Context, r *http.Request) (*TusUpload, func(), int) {
+	if u, status := t.find(ctx, r); u == nil {
+		return nil, nil, status
+	}
+	params, _ := Params(ctx)
+	unlock := t.lock(params.ByName("id"))
+	// the upload may have completed or been terminated while waiting
+	u, status := t.find(ctx, r)
+	if u == nil {
+		unlock()
+		return nil, nil, status
+	}
+	return u, unlock, status
+}
+
+// lock id, the returned func unlocks and drops the lock once no request
+// holds or waits for it
+func (t *Tus) lock(id string) func() {
+	t.mu.Lock()
+	l, ok := t.locks[id]
+	if !ok {
+		l = &tusLock{}
+		t.locks[id] = l
+	}
+	l.refs++
+	t.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		t.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(t.locks, id)
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *Tus) save(ctx context.Context, u *TusUpload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	if _, err := t.Store.Put(ctx, tusInfoKey(u.ID), strings.NewReader(string(data)), "application/json"); err != nil {
+		return err
+	}
+	// completed uploads are served from the store, only incomplete ones
+	// stay in memory
+	t.mu.Lock()
+	if u.Complete() {
+		delete(t.uploads, u.ID)
+	} else {
+		t.uploads[u.ID] = u
+	}
+	t.mu.Unlock()
+	return nil
+}
+
+// assemble concatenate the parts into the final blob
+func (t *Tus) assemble(ctx context.Context, u *TusUpload) error {
+	key := u.ID
+	if t.Key != nil {
+		key = t.Key(u)
+	}
+	if _, err := t.Store.Put(ctx, key, &partsReader{ctx: ctx, store: t.Store, id: u.ID, parts: u.Parts}, u.Metadata["filetype"]); err != nil {
+		return err
+	}
+	for _, offset := range u.Parts {
+		t.Store.Delete(ctx, tusPartKey(u.ID, offset))
+	}
+	u.Key = key
+	u.Parts = nil
+	if t.OnComplete != nil {
+		t.OnComplete(ctx, u)
+	}
+	return nil
+}
+
+func (t *Tus) remove(ctx context.Context, u *TusUpload) error {
+	for _, offset := range u.Parts {
+		if err := t.Store.Delete(ctx, tusPartKey(u.ID, offset)); err != nil {
+			return err
+		}
+	}
+	if err := t.Store.Delete(ctx, tusInfoKey(u.ID)); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	delete(t.uploads, u.ID)
+	t.mu.Unlock()
+	return nil
+}
+
+// Cleanup delete expired incomplete uploads known to this process
+func (t *Tus) Cleanup(ctx context.Context) {
+	now := time.Now()
+	t.mu.Lock()
+	var expired []*TusUpload
+	for _, u := range t.uploads {
+		if !u.Complete() && now.After(u.Expires) {
+			expired = append(expired, u)
+		}
+	}
+	t.mu.Unlock()
+	for _, u := range expired {
+		t.remove(ctx, u)
+	}
+}
+
+// Run clean up expired uploads every interval, a minute when not positive,
+// until ctx is done
+func (t *Tus) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			t.Cleanup(ctx)
+		}
+	}
+}
+
+// partsReader reads the parts of an upload in order, opening one at a
+// time
+type partsReader struct {
+	ctx   context.Context
+	store BlobStore
+	id    string
+	parts []int64
+	cur   io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.parts) == 0 {
+				return 0, io.EOF
+			}
+			rc, _, err := p.store.Get(p.ctx, tusPartKey(p.id, p.parts[0]))
+			if err != nil {
+				return 0, err
+			}
+			p.cur, p.parts = rc, p.parts[1:]
+		}
+		n, err := p.cur.Read(b)
+		if err == io.EOF {
+			p.cur.Close()
+			p.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// parseTusMetadata decode "key base64value,key2 base64value2"
+func parseTusMetadata(header string) (map[string]string, error) {
+	if header == "" {
+		return nil, nil
+	}
+	ret := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("invalid Upload-Metadata")
+		}
+		if len(kv) == 1 {
+			ret[kv[0]] = ""
+			continue
+		}
+		val, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata %s: %s", kv[0], err)
+		}
+		ret[kv[0]] = string(val)
+	}
+	return ret, nil
+}
+
+func formatTusMetadata(meta map[string]string) string {
+	parts := make([]string, 0, len(meta))
+	for k, v := range meta {
+		parts = append(parts, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	return strings.Join(parts, ",")
+}
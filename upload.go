@@ -0,0 +1,217 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// upload errors
+var (
+	ErrUploadTooLarge  = fmt.Errorf("upload too large")
+	ErrTooManyUploads  = fmt.Errorf("too many files")
+	ErrNotMultipart    = fmt.Errorf("request is not multipart/form-data")
+	ErrUploadFieldSize = fmt.Errorf("form field too large")
+	ErrTooManyFields   = fmt.Errorf("too many form fields")
+)
+
+// UploadMaxFields default cap of plain form fields per upload
+const UploadMaxFields = 1000
+
+// UploadedFile file stored from a multipart upload
+type UploadedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// UploadResult files and plain fields of a multipart upload
+type UploadResult struct {
+	Files  []UploadedFile      `json:"files"`
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// Uploader streams multipart file parts straight into a BlobStore, so
+// uploads are never buffered in memory
+type Uploader struct {
+	Store BlobStore
+	// MaxSize of the whole request body, 0 means no limit
+	MaxSize int64
+	// MaxFiles per request, 0 means no limit
+	MaxFiles int
+	// MaxFields plain form fields per request, UploadMaxFields when 0
+	MaxFields int
+	// MaxFieldBytes total size of the plain form fields, READLIMIT when 0
+	MaxFieldBytes int64
+	// Key names the blob for an uploaded filename, defaults to a random
+	// key keeping the extension
+	Key func(ctx context.Context, filename string) string
+	// Policy files have to pass before they are stored, nil accepts all
+	Policy *UploadPolicy
+}
+
+// NewUploader uploader into store
+func NewUploader(store BlobStore) *Uploader {
+	return &Uploader{Store: store}
+}
+
+// Receive store every file of the multipart request r. When a part fails
+// the files stored so far are deleted again.
+func (u *Uploader) Receive(ctx context.Context, r *http.Request) (*UploadResult, error) {
+	if u.MaxSize > 0 && r.ContentLength > u.MaxSize {
+		return nil, ErrUploadTooLarge
+	}
+	if u.MaxSize > 0 {
+		r.Body = &limitedBody{ReadCloser: r.Body, left: u.MaxSize}
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, ErrNotMultipart
+	}
+	res := &UploadResult{Fields: make(map[string][]string)}
+	maxFields, fieldBytes := u.MaxFields, u.MaxFieldBytes
+	if maxFields <= 0 {
+		maxFields = UploadMaxFields
+	}
+	if fieldBytes <= 0 {
+		fieldBytes = READLIMIT
+	}
+	fields := 0
+	fail := func(err error) (*UploadResult, error) {
+		for _, f := range res.Files {
+			u.Store.Delete(context.Background(), f.Key)
+		}
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return fail(uploadError(err))
+		}
+		if part.FileName() == "" {
+			if fields++; fields > maxFields {
+				return fail(ErrTooManyFields)
+			}
+			// fields share one budget, whatever MaxSize allows
+			val, err := ioutil.ReadAll(io.LimitReader(part, fieldBytes+1))
+			if err != nil {
+				return fail(uploadError(err))
+			}
+			if fieldBytes -= int64(len(val)); fieldBytes < 0 {
+				return fail(ErrUploadFieldSize)
+			}
+			res.Fields[part.FormName()] = append(res.Fields[part.FormName()], string(val))
+			continue
+		}
+		if u.MaxFiles > 0 && len(res.Files) >= u.MaxFiles {
+			return fail(ErrTooManyUploads)
+		}
+		file, err := u.store(ctx, part.FormName(), part.FileName(), part.Header.Get("Content-Type"), part)
+		if err != nil {
+			return fail(uploadError(err))
+		}
+		res.Files = append(res.Files, file)
+	}
+}
+
+func (u *Uploader) store(ctx context.Context, field, filename, contentType string, r io.Reader) (UploadedFile, error) {
+	filename = path.Base(strings.Replace(filename, `\`, "/", -1))
+	if u.Policy != nil {
+		var err error
+		if r, contentType, err = u.Policy.check(ctx, filename, r); err != nil {
+			return UploadedFile{}, err
+		}
+		if c, ok := r.(io.Closer); ok {
+			defer c.Close()
+		}
+	}
+	key := u.key(ctx, filename)
+	info, err := u.Store.Put(ctx, key, r, contentType)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	return UploadedFile{
+		Field:       field,
+		Filename:    filename,
+		Key:         info.Key,
+		Size:        info.Size,
+		ContentType: contentType,
+	}, nil
+}
+
+func (u *Uploader) key(ctx context.Context, filename string) string {
+	if u.Key != nil {
+		return u.Key(ctx, filename)
+	}
+	return newRequestID() + strings.ToLower(path.Ext(filename))
+}
+
+// EndPoint endpoint receiving an upload and answering with the result
+func (u *Uploader) EndPoint(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	res, err := u.Receive(ctx, r)
+	if rejected, ok := err.(*UploadRejected); ok {
+		res := JSONResult{
+			Success:    false,
+			StatusCode: http.StatusUnprocessableEntity,
+			Error:      rejected.Error(),
+		}
+		res.Write(w)
+		return
+	}
+	switch err {
+	case nil:
+		ResultResponse(w, res)
+	case ErrUploadTooLarge:
+		SizeResponse(w, err)
+	case ErrNotMultipart, ErrTooManyUploads, ErrUploadFieldSize, ErrTooManyFields:
+		BadRequest(w, err)
+	default:
+		ErrorResponse(w, err)
+	}
+}
+
+// limitedBody fails reads past the limit instead of truncating silently
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// at the limit, only more data is an error
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrUploadTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+// uploadError unwrap the limit and policy errors readers and stores wrap
+func uploadError(err error) error {
+	if errors.Is(err, ErrUploadTooLarge) {
+		return ErrUploadTooLarge
+	}
+	var rejected *UploadRejected
+	if errors.As(err, &rejected) {
+		return rejected
+	}
+	return err
+}
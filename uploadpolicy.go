@@ -0,0 +1,219 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// UploadRejected a file refused by an UploadPolicy
+type UploadRejected struct {
+	Filename string
+	Reason   string
+}
+
+func (e *UploadRejected) Error() string {
+	return fmt.Sprintf("%s rejected: %s", e.Filename, e.Reason)
+}
+
+// UploadScanner inspects file content, e.g. an antivirus, an error
+// rejects the file
+type UploadScanner interface {
+	Scan(ctx context.Context, filename, contentType string, r io.Reader) error
+}
+
+// UploadScannerFunc func adapter for UploadScanner
+type UploadScannerFunc func(ctx context.Context, filename, contentType string, r io.Reader) error
+
+// Scan calls f
+func (f UploadScannerFunc) Scan(ctx context.Context, filename, contentType string, r io.Reader) error {
+	return f(ctx, filename, contentType, r)
+}
+
+// UploadPolicy rules files must pass before they are stored. The content
+// type is sniffed from the content, the type the client claims is ignored.
+type UploadPolicy struct {
+	// Types allowed mime types, "image/*" allows a whole family, empty
+	// allows every type
+	Types []string
+	// Extensions allowed lower case extensions with dot, empty allows all
+	Extensions []string
+	// MatchExtension requires the extension to be registered for the
+	// sniffed type, so a script renamed to .jpg is refused
+	MatchExtension bool
+	// MaxSizes size limit per mime type or family, "*" for the rest
+	MaxSizes map[string]int64
+	// Scanner sees the content while it streams to storage, the blob is
+	// only committed once it passed. A scanner returning nil before the
+	// end accepts the rest unscanned.
+	Scanner UploadScanner
+}
+
+// sniffLen bytes http.DetectContentType looks at
+const sniffLen = 512
+
+// check sniff r and check the policy, the returned reader yields the full
+// content and fails once a size limit or the scanner rejects the file
+func (p *UploadPolicy) check(ctx context.Context, filename string, r io.Reader) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+	ctype := http.DetectContentType(head)
+	base, _, _ := mime.ParseMediaType(ctype)
+	ext := strings.ToLower(path.Ext(filename))
+	reject := func(reason string) (io.Reader, string, error) {
+		return nil, "", &UploadRejected{Filename: filename, Reason: reason}
+	}
+	if len(p.Types) > 0 && matchType(p.Types, base) == "" {
+		return reject("type " + base + " not allowed")
+	}
+	if len(p.Extensions) > 0 && !containsString(p.Extensions, ext) {
+		return reject("extension " + ext + " not allowed")
+	}
+	if p.MatchExtension && !extensionOf(base, ext) {
+		return reject("extension " + ext + " does not match type " + base)
+	}
+	var out io.Reader = br
+	if limit, ok := p.maxSize(base); ok {
+		out = &sizeLimit{r: out, left: limit, filename: filename}
+	}
+	if p.Scanner != nil {
+		out = newScanReader(ctx, p.Scanner, filename, base, out)
+	}
+	return out, base, nil
+}
+
+func (p *UploadPolicy) maxSize(ctype string) (int64, bool) {
+	if len(p.MaxSizes) == 0 {
+		return 0, false
+	}
+	keys := make([]string, 0, len(p.MaxSizes))
+	for k := range p.MaxSizes {
+		keys = append(keys, k)
+	}
+	if match := matchType(keys, ctype); match != "" {
+		return p.MaxSizes[match], true
+	}
+	limit, ok := p.MaxSizes["*"]
+	return limit, ok
+}
+
+// matchType most specific pattern matching ctype, empty when none does
+func matchType(patterns []string, ctype string) string {
+	family := ""
+	for _, p := range patterns {
+		if p == ctype {
+			return p
+		}
+		if strings.HasSuffix(p, "/*") && strings.HasPrefix(ctype, p[:len(p)-1]) {
+			family = p
+		}
+	}
+	return family
+}
+
+func extensionOf(ctype, ext string) bool {
+	exts, _ := mime.ExtensionsByType(ctype)
+	return containsString(exts, ext)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeLimit fails reads once more than left bytes were read
+type sizeLimit struct {
+	r        io.Reader
+	left     int64
+	filename string
+}
+
+func (s *sizeLimit) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.left -= int64(n)
+	if s.left < 0 {
+		return 0, &UploadRejected{Filename: s.filename, Reason: "too large"}
+	}
+	return n, err
+}
+
+// scanReader tees content into a scanner, EOF is held back until the
+// scanner is done so storage only commits scanned content. A scanner
+// accepting before the end leaves the rest to pass through unscanned.
+type scanReader struct {
+	r      io.Reader
+	pw     *io.PipeWriter
+	result chan error
+	err    error
+	passed bool
+}
+
+func newScanReader(ctx context.Context, scanner UploadScanner, filename, ctype string, r io.Reader) *scanReader {
+	pr, pw := io.Pipe()
+	s := &scanReader{r: r, pw: pw, result: make(chan error, 1)}
+	go func() {
+		err := scanner.Scan(ctx, filename, ctype, pr)
+		if err != nil {
+			err = &UploadRejected{Filename: filename, Reason: err.Error()}
+		}
+		// unblock writes the scanner did not read
+		pr.CloseWithError(io.ErrClosedPipe)
+		s.result <- err
+	}()
+	return s
+}
+
+func (s *scanReader) Read(p []byte) (int, error) {
+	if s.passed {
+		return s.r.Read(p)
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.r.Read(p)
+	if n > 0 {
+		if _, werr := s.pw.Write(p[:n]); werr != nil {
+			// the scanner returned early
+			if s.err = <-s.result; s.err != nil {
+				return 0, s.err
+			}
+			s.passed = true
+			return n, err
+		}
+	}
+	if err == io.EOF {
+		s.pw.Close()
+		if s.err = <-s.result; s.err == nil {
+			s.err = io.EOF
+		}
+		return n, s.err
+	}
+	if err != nil {
+		s.pw.CloseWithError(err)
+		<-s.result
+		s.err = err
+	}
+	return n, err
+}
+
+// Close stop the scanner when storage gave up before the end
+func (s *scanReader) Close() error {
+	if s.err == nil && !s.passed {
+		s.pw.CloseWithError(io.ErrUnexpectedEOF)
+		<-s.result
+		s.err = io.ErrClosedPipe
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+// UserAgentMode how patterns of a UserAgentFilter are applied
+type UserAgentMode int
+
+// user agent filter modes
+const (
+	// BlockUserAgents rejects agents matching any pattern
+	BlockUserAgents UserAgentMode = iota
+	// AllowUserAgents rejects agents matching none of the patterns
+	AllowUserAgents
+)
+
+// UserAgentFilter rejects requests based on the User-Agent header
+type UserAgentFilter struct {
+	mode     UserAgentMode
+	patterns []*regexp.Regexp
+	// BlockEmpty also rejects requests without a User-Agent
+	BlockEmpty bool
+
+	mu      sync.Mutex
+	blocked map[string]uint64
+}
+
+// NewUserAgentFilter compile patterns into a filter
+func NewUserAgentFilter(mode UserAgentMode, patterns ...string) (*UserAgentFilter, error) {
+	f := &UserAgentFilter{
+		mode:    mode,
+		blocked: make(map[string]uint64),
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+// match reason for blocking ua, empty when allowed
+func (f *UserAgentFilter) match(ua string) string {
+	if ua == "" {
+		if f.BlockEmpty {
+			return "empty"
+		}
+		return ""
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(ua) {
+			if f.mode == BlockUserAgents {
+				return re.String()
+			}
+			return ""
+		}
+	}
+	if f.mode == AllowUserAgents {
+		return "not allowed"
+	}
+	return ""
+}
+
+// Blocked rejected request counts by matching pattern
+func (f *UserAgentFilter) Blocked() map[string]uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret := make(map[string]uint64, len(f.blocked))
+	for k, v := range f.blocked {
+		ret[k] = v
+	}
+	return ret
+}
+
+func (f *UserAgentFilter) allow(r *http.Request) bool {
+	reason := f.match(r.UserAgent())
+	if reason == "" {
+		return true
+	}
+	f.mu.Lock()
+	f.blocked[reason]++
+	f.mu.Unlock()
+	return false
+}
+
+// Decorate EndPointDecorator rejecting filtered agents
+func (f *UserAgentFilter) Decorate(e EndPoint) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if !f.allow(r) {
+			forbidden(w)
+			return
+		}
+		e(ctx, w, r)
+	}
+}
+
+// Handler wrap handler so filtered agents never reach the router
+func (f *UserAgentFilter) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.allow(r) {
+			forbidden(w)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func forbidden(w http.ResponseWriter) {
+	res := JSONResult{
+		Success:    false,
+		StatusCode: http.StatusForbidden,
+		Error:      "Forbidden",
+	}
+	res.Write(w)
+}
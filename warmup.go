@@ -0,0 +1,124 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// WarmUpTimeout default time a warmer may take
+const WarmUpTimeout = 30 * time.Second
+
+// Warmer prepares a dependency before the server takes traffic, e.g. a
+// database ping or priming a cache
+type Warmer func(ctx context.Context) error
+
+type warmer struct {
+	name    string
+	timeout time.Duration
+	fn      Warmer
+}
+
+type warmUp struct {
+	mu      sync.Mutex
+	warmers []warmer
+	started bool
+	done    bool
+	results map[string]CheckStatus
+}
+
+// AddWarmer register fn to run once the server listens, readiness fails
+// until every warmer succeeded. timeout 0 is WarmUpTimeout.
+func (s *Server) AddWarmer(name string, timeout time.Duration, fn Warmer) {
+	if timeout <= 0 {
+		timeout = WarmUpTimeout
+	}
+	s.warmUp.mu.Lock()
+	first := len(s.warmUp.warmers) == 0
+	s.warmUp.warmers = append(s.warmUp.warmers, warmer{name: name, timeout: timeout, fn: fn})
+	s.warmUp.mu.Unlock()
+	if first {
+		s.OnStart(func() {
+			go s.WarmUp(context.Background())
+		})
+	}
+}
+
+// WarmUp run the warmers concurrently, once; servers run it when they
+// start listening. It returns the first failure.
+func (s *Server) WarmUp(ctx context.Context) error {
+	s.warmUp.mu.Lock()
+	if s.warmUp.started {
+		s.warmUp.mu.Unlock()
+		return nil
+	}
+	s.warmUp.started = true
+	warmers := s.warmUp.warmers
+	s.warmUp.mu.Unlock()
+	results := make(map[string]CheckStatus, len(warmers))
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		err error
+	)
+	for _, w := range warmers {
+		wg.Add(1)
+		go func(w warmer) {
+			defer wg.Done()
+			status := runCheck(ctx, HealthCheck(w.fn), w.timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			results[w.name] = status
+			if status.Status != "ok" && err == nil {
+				err = fmt.Errorf("warm up %s: %s", w.name, status.Error)
+			}
+		}(w)
+	}
+	wg.Wait()
+	s.warmUp.mu.Lock()
+	s.warmUp.results = results
+	s.warmUp.done = true
+	s.warmUp.mu.Unlock()
+	return err
+}
+
+// warmUpReport results of the warmers, ready when they all succeeded
+func (s *Server) warmUpReport() (map[string]CheckStatus, bool) {
+	s.warmUp.mu.Lock()
+	defer s.warmUp.mu.Unlock()
+	if len(s.warmUp.warmers) == 0 {
+		return nil, true
+	}
+	if !s.warmUp.done {
+		ret := make(map[string]CheckStatus, len(s.warmUp.warmers))
+		for _, w := range s.warmUp.warmers {
+			ret[w.name] = CheckStatus{Status: "pending"}
+		}
+		return ret, false
+	}
+	ready := true
+	for _, r := range s.warmUp.results {
+		ready = ready && r.Status == "ok"
+	}
+	return s.warmUp.results, ready
+}
+
+// RouteWarmer warmer sending GET requests for paths through the server's
+// routes, priming lazily initialised handlers and caches. Responses with
+// a server error fail it.
+func (s *Server) RouteWarmer(paths ...string) Warmer {
+	return func(ctx context.Context) error {
+		for _, p := range paths {
+			r := httptest.NewRequest(http.MethodGet, p, nil).WithContext(ctx)
+			w := &bufferWriter{header: make(http.Header)}
+			s.route(&serverWriter{ResponseWriter: w, server: s, request: r}, r)
+			if w.Status() >= http.StatusInternalServerError {
+				return fmt.Errorf("%s: status %d", p, w.Status())
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,369 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhook headers set on every delivery
+const (
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhook defaults
+const (
+	WebhookQueueSize   = 1024
+	WebhookWorkers     = 4
+	WebhookMaxAttempts = 8
+	WebhookBackoff     = time.Second
+	WebhookMaxBackoff  = 5 * time.Minute
+	WebhookTimeout     = 10 * time.Second
+)
+
+// webhook errors
+var (
+	ErrWebhooksClosed   = fmt.Errorf("webhook: dispatcher closed")
+	ErrWebhookQueueFull = fmt.Errorf("webhook: queue full")
+)
+
+// WebhookDestination receiver of webhook events
+type WebhookDestination struct {
+	ID  string
+	URL string
+	// Secret signs payloads, see SignWebhook
+	Secret string
+	// Events types delivered to the destination, empty means all
+	Events []string
+}
+
+func (d WebhookDestination) wants(event string) bool {
+	if len(d.Events) == 0 {
+		return true
+	}
+	for _, e := range d.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent payload as posted to destinations
+type WebhookEvent struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	Time    time.Time   `json:"time"`
+	Payload interface{} `json:"payload"`
+}
+
+// WebhookDelivery a single event for a single destination
+type WebhookDelivery struct {
+	Destination WebhookDestination
+	Event       WebhookEvent
+	Attempts    int
+	body        []byte
+}
+
+// DeadLetterSink receives deliveries that exhausted their attempts, were
+// rejected by the destination or were pending at shutdown
+type DeadLetterSink interface {
+	DeadLetter(d WebhookDelivery, err error)
+}
+
+// DeadLetterFunc func adapter for DeadLetterSink
+type DeadLetterFunc func(d WebhookDelivery, err error)
+
+// DeadLetter calls f
+func (f DeadLetterFunc) DeadLetter(d WebhookDelivery, err error) {
+	f(d, err)
+}
+
+// Webhooks delivers events to registered destinations with exponential
+// backoff retries
+type Webhooks struct {
+	// Client used for deliveries, defaults to a client with WebhookTimeout
+	Client *http.Client
+	// MaxAttempts per delivery before it is dead lettered
+	MaxAttempts int
+	// Backoff first retry delay, doubled per attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// DeadLetter receives failed deliveries, nil logs nothing and drops
+	DeadLetter DeadLetterSink
+
+	mu           sync.RWMutex
+	destinations map[string]WebhookDestination
+	closing      bool
+
+	queue chan *WebhookDelivery
+	abort chan struct{}
+	wg    sync.WaitGroup
+	// queued deliveries plus slots reserved by publishers
+	qmu    sync.Mutex
+	queued int
+}
+
+// NewWebhooks dispatcher with workers delivering in parallel, pending
+// deliveries drain on server shutdown
+func NewWebhooks(s *Server, workers int) *Webhooks {
+	if workers <= 0 {
+		workers = WebhookWorkers
+	}
+	wh := &Webhooks{
+		Client:       &http.Client{Timeout: WebhookTimeout},
+		MaxAttempts:  WebhookMaxAttempts,
+		Backoff:      WebhookBackoff,
+		MaxBackoff:   WebhookMaxBackoff,
+		destinations: make(map[string]WebhookDestination),
+		queue:        make(chan *WebhookDelivery, WebhookQueueSize),
+		abort:        make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go wh.worker()
+	}
+	if s != nil {
+		s.OnShutdown(wh.Close)
+	}
+	return wh
+}
+
+// Register add or replace a destination
+func (wh *Webhooks) Register(d WebhookDestination) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	wh.destinations[d.ID] = d
+}
+
+// Remove remove destination id, queued deliveries are still attempted
+func (wh *Webhooks) Remove(id string) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	delete(wh.destinations, id)
+}
+
+// Publish queue event for every destination subscribed to it. When the
+// queue can not take the event for all of them it is queued for none and
+// ErrWebhookQueueFull returned, so retrying does not duplicate deliveries.
+func (wh *Webhooks) Publish(event string, payload interface{}) error {
+	ev := WebhookEvent{ID: newRequestID(), Type: event, Time: time.Now().UTC(), Payload: payload}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+	if wh.closing {
+		return ErrWebhooksClosed
+	}
+	var deliveries []*WebhookDelivery
+	for _, d := range wh.destinations {
+		if d.wants(event) {
+			deliveries = append(deliveries, &WebhookDelivery{Destination: d, Event: ev, body: body})
+		}
+	}
+	if !wh.reserve(len(deliveries)) {
+		return ErrWebhookQueueFull
+	}
+	wh.wg.Add(len(deliveries))
+	for _, d := range deliveries {
+		// never blocks, the slots are reserved
+		wh.queue <- d
+	}
+	return nil
+}
+
+// reserve queue slots for n deliveries, all or none
+func (wh *Webhooks) reserve(n int) bool {
+	wh.qmu.Lock()
+	defer wh.qmu.Unlock()
+	if wh.queued+n > cap(wh.queue) {
+		return false
+	}
+	wh.queued += n
+	return true
+}
+
+// dequeued free the slot of a delivery taken off the queue
+func (wh *Webhooks) dequeued() {
+	wh.qmu.Lock()
+	wh.queued--
+	wh.qmu.Unlock()
+}
+
+// Close stop accepting events and wait for queued deliveries, including
+// their retries, until ctx expires; whatever is left is dead lettered
+func (wh *Webhooks) Close(ctx context.Context) error {
+	wh.mu.Lock()
+	if wh.closing {
+		wh.mu.Unlock()
+		return nil
+	}
+	wh.closing = true
+	wh.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		wh.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		close(wh.abort)
+		return nil
+	case <-ctx.Done():
+		close(wh.abort)
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (wh *Webhooks) worker() {
+	for {
+		select {
+		case d := <-wh.queue:
+			wh.dequeued()
+			wh.deliver(d)
+			wh.wg.Done()
+		case <-wh.abort:
+			// drain what is left once closing gave up waiting
+			for {
+				select {
+				case d := <-wh.queue:
+					wh.dequeued()
+					wh.deadLetter(d, ErrWebhooksClosed)
+					wh.wg.Done()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (wh *Webhooks) deliver(d *WebhookDelivery) {
+	for {
+		select {
+		case <-wh.abort:
+			wh.deadLetter(d, ErrWebhooksClosed)
+			return
+		default:
+		}
+		d.Attempts++
+		retry, err := wh.post(d)
+		if err == nil {
+			return
+		}
+		if !retry || d.Attempts >= wh.MaxAttempts {
+			wh.deadLetter(d, err)
+			return
+		}
+		t := time.NewTimer(backoff(wh.Backoff, wh.MaxBackoff, d.Attempts))
+		select {
+		case <-t.C:
+		case <-wh.abort:
+			t.Stop()
+			wh.deadLetter(d, ErrWebhooksClosed)
+			return
+		}
+	}
+}
+
+// post attempt a delivery, retry reports whether a failure is transient
+func (wh *Webhooks) post(d *WebhookDelivery) (retry bool, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-wh.abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req, err := http.NewRequest(http.MethodPost, d.Destination.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, d.Event.ID)
+	req.Header.Set(WebhookEventHeader, d.Event.Type)
+	if d.Destination.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(d.Destination.Secret, time.Now(), d.body))
+	}
+	res, err := wh.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, READLIMIT))
+	res.Body.Close()
+	switch {
+	case res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return true, fmt.Errorf("webhook: %s answered %s", d.Destination.URL, res.Status)
+	}
+	return false, fmt.Errorf("webhook: %s rejected delivery: %s", d.Destination.URL, res.Status)
+}
+
+func (wh *Webhooks) deadLetter(d *WebhookDelivery, err error) {
+	if wh.DeadLetter != nil {
+		wh.DeadLetter.DeadLetter(*d, err)
+	}
+}
+
+// SignWebhook signature header value for body, formatted t=<unix>,v1=<hex
+// hmac-sha256 of "<unix>.<body>">
+func SignWebhook(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + webhookMAC(secret, ts, body)
+}
+
+// VerifyWebhook check a signature header made by SignWebhook, signatures
+// older than tolerance are rejected to prevent replays
+func VerifyWebhook(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sig = kv[1]
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("webhook: malformed signature")
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return fmt.Errorf("webhook: signature expired")
+	}
+	if !hmac.Equal([]byte(sig), []byte(webhookMAC(secret, ts, body))) {
+		return fmt.Errorf("webhook: signature mismatch")
+	}
+	return nil
+}
+
+func webhookMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,323 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocket defaults
+const (
+	WSQueueSize      = 64
+	WSWriteTimeout   = 10 * time.Second
+	WSPingInterval   = 30 * time.Second
+	WSIdleTimeout    = 60 * time.Second
+	WSMaxMessageSize = MB
+)
+
+// websocket close reasons, see Conn.Err
+var (
+	// ErrConnClosed send on a closed websocket connection, or closed by
+	// the server
+	ErrConnClosed = fmt.Errorf("websocket: connection closed")
+	// ErrSlowConsumer connection closed because its send queue was full
+	ErrSlowConsumer = fmt.Errorf("websocket: send queue full")
+	// ErrIdleTimeout no message or pong within the idle timeout
+	ErrIdleTimeout = fmt.Errorf("websocket: idle timeout")
+	// ErrMessageTooBig peer sent a message over the size limit
+	ErrMessageTooBig = fmt.Errorf("websocket: message too big")
+	// ErrPeerClosed peer closed the connection normally or going away
+	ErrPeerClosed = fmt.Errorf("websocket: closed by peer")
+	// ErrProtocol peer violated the protocol or closed abnormally
+	ErrProtocol = fmt.Errorf("websocket: protocol error")
+)
+
+// closeReason map a read error to a close reason and the close code to
+// answer with
+func closeReason(err error) (int, error) {
+	if ce, ok := err.(*websocket.CloseError); ok {
+		switch ce.Code {
+		case websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived:
+			return websocket.CloseNormalClosure, ErrPeerClosed
+		case websocket.CloseMessageTooBig:
+			return websocket.CloseMessageTooBig, ErrMessageTooBig
+		}
+		return websocket.CloseProtocolError, ErrProtocol
+	}
+	if err == websocket.ErrReadLimit {
+		return websocket.CloseMessageTooBig, ErrMessageTooBig
+	}
+	if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+		return websocket.CloseGoingAway, ErrIdleTimeout
+	}
+	return websocket.CloseAbnormalClosure, ErrProtocol
+}
+
+// CloseCode websocket close code matching a close reason
+func CloseCode(err error) int {
+	switch err {
+	case nil, ErrConnClosed, ErrPeerClosed:
+		return websocket.CloseNormalClosure
+	case ErrSlowConsumer:
+		return websocket.ClosePolicyViolation
+	case ErrIdleTimeout:
+		return websocket.CloseGoingAway
+	case ErrMessageTooBig:
+		return websocket.CloseMessageTooBig
+	}
+	return websocket.CloseProtocolError
+}
+
+// Conn realtime connection, websocket or server sent events, with a
+// bounded send queue; writes are done by a single writer goroutine
+type Conn struct {
+	tr   transport
+	hub  *Hub
+	ctx  context.Context
+	send chan wsFrame
+
+	mu     sync.Mutex
+	rooms  map[string]struct{}
+	closed chan struct{}
+	once   sync.Once
+	err    error
+}
+
+type wsFrame struct {
+	kind int
+	data []byte
+}
+
+// transport the wire a Conn writes to
+type transport interface {
+	write(f wsFrame) error
+	ping() error
+	close(code int, text string)
+}
+
+type wsTransport struct {
+	ws *websocket.Conn
+}
+
+func (t wsTransport) write(f wsFrame) error {
+	t.ws.SetWriteDeadline(time.Now().Add(WSWriteTimeout))
+	return t.ws.WriteMessage(f.kind, f.data)
+}
+
+func (t wsTransport) ping() error {
+	return t.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(WSWriteTimeout))
+}
+
+func (t wsTransport) close(code int, text string) {
+	msg := websocket.FormatCloseMessage(code, text)
+	t.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	t.ws.Close()
+}
+
+func newConn(ctx context.Context, tr transport, hub *Hub, queue int) *Conn {
+	return &Conn{
+		tr:     tr,
+		hub:    hub,
+		ctx:    ctx,
+		send:   make(chan wsFrame, queue),
+		rooms:  make(map[string]struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+// Context request context of the upgrade request, canceled on close
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// Send queue a text message, a full queue closes the connection
+func (c *Conn) Send(msg []byte) error {
+	return c.enqueue(wsFrame{kind: websocket.TextMessage, data: msg})
+}
+
+// SendBinary queue a binary message
+func (c *Conn) SendBinary(msg []byte) error {
+	return c.enqueue(wsFrame{kind: websocket.BinaryMessage, data: msg})
+}
+
+// SendJSON queue v as a json text message
+func (c *Conn) SendJSON(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(msg)
+}
+
+func (c *Conn) enqueue(f wsFrame) error {
+	select {
+	case <-c.closed:
+		return ErrConnClosed
+	default:
+	}
+	select {
+	case c.send <- f:
+		return nil
+	case <-c.closed:
+		return ErrConnClosed
+	default:
+		c.closeWith(ErrSlowConsumer, websocket.ClosePolicyViolation, "send queue full")
+		return ErrSlowConsumer
+	}
+}
+
+// Join add the connection to room
+func (c *Conn) Join(room string) {
+	if c.hub != nil {
+		c.hub.join(c, room)
+	}
+}
+
+// Leave remove the connection from room
+func (c *Conn) Leave(room string) {
+	if c.hub != nil {
+		c.hub.leave(c, room)
+	}
+}
+
+// Rooms the rooms the connection is in
+func (c *Conn) Rooms() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		ret = append(ret, room)
+	}
+	return ret
+}
+
+// Close close the connection normally
+func (c *Conn) Close() {
+	c.closeWith(ErrConnClosed, websocket.CloseNormalClosure, "")
+}
+
+// Done closed when the connection is closed
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Err reason the connection closed, nil while open
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Conn) closeWith(err error, code int, text string) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.closed)
+		c.tr.close(code, text)
+	})
+}
+
+// writer drain the send queue until the connection closes, pinging the
+// peer every ping interval
+func (c *Conn) writer(ping time.Duration) {
+	var tick <-chan time.Time
+	if ping > 0 {
+		t := time.NewTicker(ping)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-tick:
+			if err := c.tr.ping(); err != nil {
+				c.closeWith(err, websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case f := <-c.send:
+			if err := c.tr.write(f); err != nil {
+				c.closeWith(err, websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// WSHandler receives the events of a websocket connection
+type WSHandler struct {
+	// OnOpen is called after the upgrade, e.g. to join rooms
+	OnOpen func(c *Conn)
+	// OnMessage is called for every message read, in order
+	OnMessage func(c *Conn, kind int, msg []byte)
+	// OnClose is called once the connection is gone
+	OnClose func(c *Conn)
+}
+
+// WebSocket endpoint upgrading to a websocket connection managed by hub,
+// the endpoint returns when the connection closes
+func (h *Hub) WebSocket(handler WSHandler) EndPoint {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if h.isClosing() {
+			res := JSONResult{
+				Success:    false,
+				StatusCode: http.StatusServiceUnavailable,
+				Error:      "shutting down",
+			}
+			res.Write(w)
+			return
+		}
+		ws, err := h.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader already answered the request
+			return
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		c := newConn(ctx, wsTransport{ws}, h, h.QueueSize)
+		if !h.add(c) {
+			// closed while upgrading
+			c.closeWith(ErrConnClosed, websocket.CloseGoingAway, "server shutting down")
+			return
+		}
+		defer h.remove(c)
+		if h.MaxMessageSize > 0 {
+			ws.SetReadLimit(h.MaxMessageSize)
+		}
+		extend := func() {
+			if h.IdleTimeout > 0 {
+				ws.SetReadDeadline(time.Now().Add(h.IdleTimeout))
+			}
+		}
+		extend()
+		ws.SetPongHandler(func(string) error {
+			extend()
+			return nil
+		})
+		go c.writer(h.PingInterval)
+		if handler.OnOpen != nil {
+			handler.OnOpen(c)
+		}
+		for {
+			kind, msg, err := ws.ReadMessage()
+			if err != nil {
+				code, reason := closeReason(err)
+				c.closeWith(reason, code, "")
+				break
+			}
+			extend()
+			if handler.OnMessage != nil {
+				handler.OnMessage(c, kind, msg)
+			}
+		}
+		if handler.OnClose != nil {
+			handler.OnClose(c)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// worker pool defaults, see WithWorkers
+const (
+	Workers         = 16
+	WorkerQueueSize = 256
+)
+
+var (
+	// ErrWorkersBusy every worker is busy and the queue is full
+	ErrWorkersBusy = fmt.Errorf("workers busy")
+	// ErrWorkersClosed the server is shutting down
+	ErrWorkersClosed = fmt.Errorf("workers closed")
+)
+
+// WithWorkers run tasks started with Server.Go on n workers, queueing at
+// most queue tasks
+func WithWorkers(n, queue int) Option {
+	return func(s *Server) {
+		s.workers = newWorkerPool(s, n, queue)
+	}
+}
+
+// Go run fn on the worker pool instead of a bare goroutine. Its context is
+// cancelled on Shutdown, which waits for accepted tasks to return; tasks
+// still queued then start with the cancelled context. Panics are logged
+// and reported to the PanicReporter. The request context ends with the
+// request, pass values the task needs explicitly.
+func (s *Server) Go(fn func(ctx context.Context)) error {
+	return s.workers.submit(fn)
+}
+
+type workerPool struct {
+	server *Server
+	n      int
+	tasks  chan func(context.Context)
+	ctx    context.Context
+	cancel context.CancelFunc
+	start  sync.Once
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newWorkerPool(s *Server, n, queue int) *workerPool {
+	if n < 1 {
+		n = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workerPool{
+		server: s,
+		n:      n,
+		tasks:  make(chan func(context.Context), queue),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (p *workerPool) submit(fn func(context.Context)) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrWorkersClosed
+	}
+	p.start.Do(func() {
+		p.wg.Add(p.n)
+		for i := 0; i < p.n; i++ {
+			go p.work()
+		}
+	})
+	select {
+	case p.tasks <- fn:
+		return nil
+	default:
+		return ErrWorkersBusy
+	}
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for fn := range p.tasks {
+		p.run(fn)
+	}
+}
+
+func (p *workerPool) run(fn func(context.Context)) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("worker panic: %+v", v)
+			p.server.reportTaskPanic(v)
+		}
+	}()
+	fn(p.ctx)
+}
+
+// close cancel running tasks and wait for them until ctx is done
+func (p *workerPool) close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.tasks)
+	p.mu.Unlock()
+	p.cancel()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers: %s", ctx.Err())
+	}
+}
+
+func (s *Server) reportTaskPanic(v interface{}) {
+	if s.PanicReporter == nil {
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("panic reporter: %+v", err)
+		}
+	}()
+	s.PanicReporter.ReportPanic(PanicReport{
+		Value: v,
+		Stack: debug.Stack(),
+		Time:  time.Now(),
+	})
+}